@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// anomalyFactor is how far a price may be from the median of the
+	// product's history before it is flagged; OCR misreads such as 74.90
+	// for 7.49 are off by a factor of 10
+	anomalyFactor = 4
+	// minPriceHistory is how many earlier prices a product needs before
+	// its new prices are judged
+	minPriceHistory = 3
+)
+
+// Review states of a flagged price
+const (
+	ReviewPending   = "pending"
+	ReviewAccepted  = "accepted"  // the price is right after all
+	ReviewCorrected = "corrected" // the reviewer fixed a misread price
+	ReviewRejected  = "rejected"  // the offer is wrong and stays excluded
+)
+
+// PriceAnomaly marks a price far off the product's history
+type PriceAnomaly struct {
+	FlaggedPrice  float64    `json:"flaggedPrice"` // unit price when flagged
+	HistoryMedian float64    `json:"historyMedian"`
+	HistorySize   int        `json:"historySize"`
+	Review        string     `json:"review"`
+	ReviewedAt    *time.Time `json:"reviewedAt,omitempty"`
+}
+
+// Excluded reports whether a product is left out of price comparisons: it
+// was flagged and the review did not clear it
+func (p Product) Excluded() bool {
+	return p.Anomaly != nil && p.Anomaly.Review != ReviewAccepted && p.Anomaly.Review != ReviewCorrected
+}
+
+// priceHistory holds the unit prices seen per product and unit
+type priceHistory map[string][]float64
+
+func historyKey(p Product) string {
+	return productKey(p.Name) + "\x00" + p.Price.Unit
+}
+
+// loadPriceHistory collects the prices of the products of all canonical
+// newsletters but excludeID, leaving out excluded prices
+func loadPriceHistory(excludeID string) priceHistory {
+	h := priceHistory{}
+	for _, n := range withoutSuperseded(newsletters.List()) {
+		if n.ID == excludeID {
+			continue
+		}
+		for _, page := range n.Pages {
+			for _, p := range loadPageProducts(page) {
+				if unitPrice := p.Price.EffectiveUnitPrice(p.Price.Price); unitPrice > 0 && !p.Excluded() {
+					h[historyKey(p)] = append(h[historyKey(p)], unitPrice)
+				}
+			}
+		}
+	}
+	return h
+}
+
+// check returns an anomaly when the price of p is more than anomalyFactor
+// away from the median of its history
+func (h priceHistory) check(p Product) *PriceAnomaly {
+	prices := h[historyKey(p)]
+	unitPrice := p.Price.EffectiveUnitPrice(p.Price.Price)
+	if len(prices) < minPriceHistory || unitPrice <= 0 {
+		return nil
+	}
+	med := median(append([]float64{}, prices...))
+	if med <= 0 || (unitPrice <= med*anomalyFactor && unitPrice*anomalyFactor >= med) {
+		return nil
+	}
+	return &PriceAnomaly{FlaggedPrice: unitPrice, HistoryMedian: med, HistorySize: len(prices), Review: ReviewPending}
+}
+
+// flagAnomalies marks the products whose price is far off their history
+func (h priceHistory) flagAnomalies(products []Product) {
+	for i := range products {
+		if a := h.check(products[i]); a != nil {
+			products[i].Anomaly = a
+			slog.Info("flagged price for review", "product", products[i].Name, "page", products[i].PageNumber, "price", a.FlaggedPrice, "usual_price", a.HistoryMedian)
+		}
+	}
+}
+
+// ReviewItem is a flagged offer in the review queue
+type ReviewItem struct {
+	NewsletterID string  `json:"newsletterId"`
+	Store        string  `json:"store"`
+	PageNumber   int     `json:"pageNumber"`
+	Index        int     `json:"index"` // position of the product on its page
+	Product      Product `json:"product"`
+}
+
+// reviewQueue lists the flagged offers in the given review state
+func reviewQueue(state string) []ReviewItem {
+	items := []ReviewItem{}
+	for _, n := range withoutSuperseded(newsletters.List()) {
+		for _, page := range n.Pages {
+			for i, p := range loadPageProducts(page) {
+				if p.Anomaly != nil && p.Anomaly.Review == state {
+					p.NewsletterID, p.PageNumber = n.ID, page.PageNumber
+					items = append(items, ReviewItem{NewsletterID: n.ID, Store: n.Store, PageNumber: page.PageNumber, Index: i, Product: p})
+				}
+			}
+		}
+	}
+	return items
+}
+
+// reviewMu serializes review decisions, which rewrite product sidecars
+var reviewMu sync.Mutex
+
+// reviewRequest is the body of POST /api/admin/review/{id}/{page}/{index}
+type reviewRequest struct {
+	Decision string   `json:"decision"` // "accept", "correct" or "reject"
+	Price    *float64 `json:"price"`    // the corrected price label amount, for "correct"
+}
+
+// Validate checks the decision and that a correction carries a price
+func (req *reviewRequest) Validate() *ValidationError {
+	switch req.Decision {
+	case "accept", "reject":
+		if req.Price != nil {
+			return fieldError("price", "only allowed with decision correct")
+		}
+	case "correct":
+		if req.Price == nil || *req.Price <= 0 {
+			return fieldError("price", "must be a positive amount")
+		}
+	default:
+		return fieldError("decision", "must be accept, correct or reject")
+	}
+	return nil
+}
+
+// reviewProduct applies a review decision to a flagged product and saves
+// its page's sidecar
+func reviewProduct(n Newsletter, pageNumber, index int, req reviewRequest) (*Product, error) {
+	var page *Page
+	for i := range n.Pages {
+		if n.Pages[i].PageNumber == pageNumber {
+			page = &n.Pages[i]
+		}
+	}
+	if page == nil {
+		return nil, os.ErrNotExist
+	}
+	imagePath, ok := localImagePath(page.ImageURL)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	reviewMu.Lock()
+	defer reviewMu.Unlock()
+
+	products := loadPageProducts(*page)
+	if index < 0 || index >= len(products) || products[index].Anomaly == nil {
+		return nil, os.ErrNotExist
+	}
+	p := &products[index]
+	now := time.Now()
+	p.Anomaly.ReviewedAt = &now
+	switch req.Decision {
+	case "accept":
+		p.Anomaly.Review = ReviewAccepted
+	case "correct":
+		p.Anomaly.Review = ReviewCorrected
+		p.Price.Price = *req.Price
+	case "reject":
+		p.Anomaly.Review = ReviewRejected
+	}
+
+	if err := savePageProducts(imagePath, products); err != nil {
+		return nil, err
+	}
+	apiCache.invalidate()
+	p.NewsletterID, p.PageNumber = n.ID, pageNumber
+	return p, nil
+}
+
+// API Handlers
+
+func getReviewQueue(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("review")
+	if state == "" {
+		state = ReviewPending
+	}
+	switch state {
+	case ReviewPending, ReviewAccepted, ReviewCorrected, ReviewRejected:
+	default:
+		http.Error(w, "Invalid review state", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reviewQueue(state))
+}
+
+func reviewOffer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	newsletter, ok := newsletters.Get(vars["id"])
+	if !ok {
+		http.Error(w, "Newsletter not found", http.StatusNotFound)
+		return
+	}
+	pageNumber, err := strconv.Atoi(vars["page"])
+	if err != nil {
+		http.Error(w, "Invalid page", http.StatusBadRequest)
+		return
+	}
+	index, err := strconv.Atoi(vars["index"])
+	if err != nil {
+		http.Error(w, "Invalid index", http.StatusBadRequest)
+		return
+	}
+
+	var req reviewRequest
+	if err := decodeJSONBody(w, r, &req); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	product, err := reviewProduct(newsletter, pageNumber, index, req)
+	if os.IsNotExist(err) {
+		http.Error(w, "Flagged offer not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logFrom(r.Context()).Error("failed to save review", "newsletter", newsletter.ID, "page", pageNumber, "err", err)
+		http.Error(w, "Error saving review", http.StatusInternalServerError)
+		return
+	}
+	logFrom(r.Context()).Info("reviewed flagged price", "product", product.Name, "newsletter", newsletter.ID, "review", product.Anomaly.Review)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
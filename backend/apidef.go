@@ -0,0 +1,216 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// apiParam is a query parameter of an API endpoint
+type apiParam struct {
+	Name string
+	Type string // "string", "int" or "bool"
+	// Required parameters are arguments of the generated client methods,
+	// the others are fields of their params struct
+	Required bool
+}
+
+// apiEndpoint describes a public API route. The generated clients get a
+// method for each one (see gen-client) and the contract check requests it
+// from a running server (see contract).
+type apiEndpoint struct {
+	Name   string // method name in the generated clients
+	Doc    string
+	Method string
+	Path   string // below /api, with {param} placeholders
+	Query  []apiParam
+	// Request is the type of the JSON body, nil if there is none
+	Request interface{}
+	// Response is the type a successful response decodes to
+	Response interface{}
+	// Sample is the path the contract check requests, with {newsletter},
+	// {store} and {group} standing for ones the server has; empty skips
+	// endpoints that change data
+	Sample string
+}
+
+// newsletterFilters are the query parameters of newsletter listings
+var newsletterFilters = []apiParam{
+	{Name: "category", Type: "string"},
+	{Name: "theme", Type: "string"},
+	{Name: "store", Type: "string"},
+	{Name: "validOn", Type: "string"},
+	{Name: "activeOnly", Type: "bool"},
+	{Name: "superseded", Type: "bool"},
+}
+
+// apiEndpoints is the API the generated clients cover. Admin routes are
+// left out: they are for operators, not for the frontend and integrations.
+var apiEndpoints = []apiEndpoint{
+	{
+		Name: "ListNewsletters", Doc: "lists newsletters, filtered by the given params, all on one page",
+		Method: "GET", Path: "/newsletters", Query: newsletterFilters,
+		Response: NewsletterPage{}, Sample: "/newsletters",
+	},
+	{
+		Name: "ListNewslettersPage", Doc: "returns a page of newsletters; pass the previous page's NextCursor as cursor to get the next one",
+		Method: "GET", Path: "/newsletters",
+		Query: append([]apiParam{
+			{Name: "limit", Type: "int", Required: true},
+			{Name: "cursor", Type: "string"},
+		}, newsletterFilters...),
+		Response: NewsletterPage{}, Sample: "/newsletters?limit=1",
+	},
+	{
+		Name: "GetNewsletter", Doc: "returns a newsletter with its page summaries; include=pages,products and pageRange=N-M add more",
+		Method: "GET", Path: "/newsletters/{id}",
+		Query:    []apiParam{{Name: "include", Type: "string"}, {Name: "pageRange", Type: "string"}},
+		Response: NewsletterDetail{}, Sample: "/newsletters/{newsletter}?include=pages,products",
+	},
+	{
+		Name: "ListNewsletterProducts", Doc: "lists the products extracted from a newsletter, or from one of its pages",
+		Method: "GET", Path: "/newsletters/{id}/products",
+		Query:    []apiParam{{Name: "page", Type: "int"}},
+		Response: []Product{}, Sample: "/newsletters/{newsletter}/products",
+	},
+	{
+		Name: "StartScrape", Doc: "starts a scrape job for a config",
+		Method: "POST", Path: "/scrape/{config}",
+		Query: []apiParam{
+			{Name: "force", Type: "bool"},
+			{Name: "coverOnly", Type: "bool"},
+			{Name: "record", Type: "bool"},
+			{Name: "replay", Type: "bool"},
+		},
+		Response: ScrapeStarted{},
+	},
+	{
+		Name: "GetJob", Doc: "returns the progress of a scrape job",
+		Method: "GET", Path: "/jobs/{id}",
+		Response: Job{},
+	},
+	{
+		Name: "GetSchedule", Doc: "lists the scheduled scrapes",
+		Method: "GET", Path: "/schedule",
+		Response: []ScheduledScrape{}, Sample: "/schedule",
+	},
+	{
+		Name: "ListStores", Doc: "lists the stores and their configs",
+		Method: "GET", Path: "/stores",
+		Response: StoreList{}, Sample: "/stores",
+	},
+	{
+		Name: "GetStoreOverview", Doc: "returns the active and upcoming newsletters of a store",
+		Method: "GET", Path: "/stores/{store}/overview",
+		Response: StoreOverview{}, Sample: "/stores/{store}/overview",
+	},
+	{
+		Name: "ListStoreNewsletters", Doc: "lists the newsletters of a store",
+		Method: "GET", Path: "/stores/{store}/newsletters",
+		Query:    []apiParam{{Name: "superseded", Type: "bool"}},
+		Response: NewsletterPage{}, Sample: "/stores/{store}/newsletters",
+	},
+	{
+		Name: "ListGroups", Doc: "lists the store groups",
+		Method: "GET", Path: "/groups",
+		Response: []StoreGroup{}, Sample: "/groups",
+	},
+	{
+		Name: "GetGroup", Doc: "returns a store group",
+		Method: "GET", Path: "/groups/{id}",
+		Response: StoreGroup{}, Sample: "/groups/{group}",
+	},
+	{
+		Name: "ListGroupNewsletters", Doc: "lists the newsletters of the stores in a group",
+		Method: "GET", Path: "/groups/{id}/newsletters",
+		Query:    []apiParam{{Name: "superseded", Type: "bool"}},
+		Response: NewsletterPage{}, Sample: "/groups/{group}/newsletters",
+	},
+	{
+		Name: "Search", Doc: "searches the offers of active newsletters, cheapest unit price first",
+		Method: "GET", Path: "/search",
+		Query: []apiParam{
+			{Name: "q", Type: "string", Required: true},
+			{Name: "store", Type: "string"},
+			{Name: "limit", Type: "int"},
+			{Name: "includeFlagged", Type: "bool"},
+		},
+		Response: SearchResponse{}, Sample: "/search?q=lapte",
+	},
+	{
+		Name: "GetClientConfig", Doc: "returns the features, stores and locales the frontend should offer",
+		Method: "GET", Path: "/config/client",
+		Response: ClientConfig{}, Sample: "/config/client",
+	},
+	{
+		Name: "GetWidgetLatest", Doc: "returns the latest newsletters for the embeddable widget",
+		Method: "GET", Path: "/widget/latest",
+		Query:    []apiParam{{Name: "store", Type: "string"}, {Name: "limit", Type: "int"}},
+		Response: []WidgetLeaflet{}, Sample: "/widget/latest",
+	},
+	{
+		Name: "CreateShare", Doc: "creates a short link to a newsletter page",
+		Method: "POST", Path: "/share",
+		Request: createShareRequest{}, Response: ShareResponse{},
+	},
+}
+
+// pathParamRe matches the {param} placeholders of endpoint paths
+var pathParamRe = regexp.MustCompile(`\{(\w+)\}`)
+
+// pathParams returns the placeholder names of an endpoint path in order
+func (e apiEndpoint) pathParams() []string {
+	var names []string
+	for _, m := range pathParamRe.FindAllStringSubmatch(e.Path, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// jsonField is a struct field as encoding/json sees it
+type jsonField struct {
+	Name      string
+	OmitEmpty bool
+	Embedded  bool // an embedded struct whose fields are promoted
+	Field     reflect.StructField
+}
+
+// jsonFields lists the fields of struct type t that encoding/json writes
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, jsonField{Embedded: true, Field: f})
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, jsonField{Name: name, OmitEmpty: strings.Contains(","+opts+",", ",omitempty,"), Field: f})
+	}
+	return fields
+}
+
+// shadowedFields returns the fields of embedded struct type inner that
+// fields of their own in fields hide, as encoding/json resolves them
+func shadowedFields(fields []jsonField, inner reflect.Type) []string {
+	own := map[string]bool{}
+	for _, f := range fields {
+		if !f.Embedded {
+			own[f.Name] = true
+		}
+	}
+	var shadowed []string
+	for _, f := range jsonFields(inner) {
+		if !f.Embedded && own[f.Name] {
+			shadowed = append(shadowed, f.Name)
+		}
+	}
+	return shadowed
+}
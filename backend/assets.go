@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxAssetSize = 10 << 20
+
+var assetCacheDir = dataPath(".assets")
+
+// assetFetches serializes concurrent fetches of the same asset
+var assetFetches sync.Map
+
+// proxiedAssetURL returns the backend URL serving a remote asset from cache
+func proxiedAssetURL(remote string) string {
+	if remote == "" {
+		return ""
+	}
+	return "/api/assets?url=" + url.QueryEscape(remote)
+}
+
+// assetHosts returns the hosts the proxy may fetch from: every host referenced
+// by a scraper config plus any listed in ASSET_PROXY_HOSTS
+func assetHosts() map[string]bool {
+	hosts := map[string]bool{}
+	for _, h := range strings.Split(os.Getenv("ASSET_PROXY_HOSTS"), ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts[h] = true
+		}
+	}
+
+	configs, err := ListAvailableConfigs()
+	if err != nil {
+		return hosts
+	}
+	for _, name := range configs {
+		config, err := LoadScraperConfig(configFile(name))
+		if err != nil {
+			continue
+		}
+		for _, raw := range []string{config.CoverImage, config.FirstPage, config.LogoURL} {
+			if u, err := url.Parse(raw); err == nil && u.Host != "" {
+				hosts[u.Host] = true
+			}
+		}
+	}
+	return hosts
+}
+
+// assetCachePath returns where a remote asset is cached on disk
+func assetCachePath(remote string) string {
+	sum := sha256.Sum256([]byte(remote))
+	return filepath.Join(assetCacheDir, hex.EncodeToString(sum[:]))
+}
+
+// fetchAsset downloads a remote image into the cache
+func fetchAsset(remote, path string) error {
+	mu, _ := assetFetches.LoadOrStore(path, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	// Another request may have fetched it while we waited
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	resp, err := http.Get(remote)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "image/") {
+		return fmt.Errorf("not an image: %s", ct)
+	}
+
+	if err := os.MkdirAll(assetCacheDir, dirPerm); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	out, err := createFile(tmp)
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(out, io.LimitReader(resp.Body, maxAssetSize+1))
+	out.Close()
+	if err == nil && n > maxAssetSize {
+		err = fmt.Errorf("asset larger than %d bytes", maxAssetSize)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// API Handlers
+
+func getAsset(w http.ResponseWriter, r *http.Request) {
+	remote := r.URL.Query().Get("url")
+	u, err := url.Parse(remote)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "Invalid asset URL", http.StatusBadRequest)
+		return
+	}
+	if !assetHosts()[u.Host] {
+		http.Error(w, "Asset host not allowed", http.StatusForbidden)
+		return
+	}
+
+	path := assetCachePath(remote)
+	if _, err := os.Stat(path); err != nil {
+		if err := fetchAsset(remote, path); err != nil {
+			logFrom(r.Context()).Error("failed to fetch asset", "url", remote, "err", err)
+			http.Error(w, "Error fetching asset", http.StatusBadGateway)
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("Expires", time.Now().Add(24*time.Hour).UTC().Format(http.TimeFormat))
+	http.ServeFile(w, r, path)
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultBackfillBatch = 20
+	defaultBackfillPause = 30 * time.Second
+)
+
+// Backfill run states
+const (
+	BackfillRunning   = "running"
+	BackfillFinished  = "finished"
+	BackfillCancelled = "cancelled"
+)
+
+// BackfillProgress reports a run of the OCR backfill
+type BackfillProgress struct {
+	Status           string     `json:"status"`
+	Store            string     `json:"store,omitempty"`
+	NewslettersTotal int        `json:"newslettersTotal"`
+	NewslettersDone  int        `json:"newslettersDone"`
+	PagesTotal       int        `json:"pagesTotal"`
+	PagesDone        int        `json:"pagesDone"`
+	PagesFailed      int        `json:"pagesFailed"`
+	ProductsFound    int        `json:"productsFound"`
+	StartedAt        time.Time  `json:"startedAt"`
+	FinishedAt       *time.Time `json:"finishedAt,omitempty"`
+}
+
+// backfill is the current or last run; only one runs at a time
+var (
+	backfillMu sync.Mutex
+	backfill   *BackfillProgress
+)
+
+var errBackfillRunning = errors.New("a backfill is already running")
+
+// backfillTarget is a newsletter with stored pages that have no products
+type backfillTarget struct {
+	newsletter Newsletter
+	pages      []Page
+}
+
+// backfillTargets lists the canonical newsletters, oldest first, whose
+// stored page images were never run through OCR. An empty store means all;
+// newsletters past the offer retention are left out.
+func backfillTargets(store string) []backfillTarget {
+	list := withoutSuperseded(newsletters.List())
+	sort.SliceStable(list, func(i, j int) bool { return list[i].ValidFrom < list[j].ValidFrom })
+	offerRetention := retentionPolicy(DataOffers, defaultRetentionDays(DataOffers))
+	today := time.Now()
+
+	targets := []backfillTarget{}
+	for _, n := range list {
+		if (store != "" && n.Store != store) || optOuts.IsOptedOut(n.Store) || expired(n, offerRetention(n.Store), today) {
+			continue
+		}
+		t := backfillTarget{newsletter: n}
+		for _, page := range n.Pages {
+			imagePath, ok := localImagePath(page.ImageURL)
+			if !ok {
+				continue
+			}
+			if _, err := os.Stat(imagePath); err != nil {
+				continue
+			}
+			if _, err := os.Stat(productsPath(imagePath)); os.IsNotExist(err) {
+				t.pages = append(t.pages, page)
+			}
+		}
+		if len(t.pages) > 0 {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+// backfillSettings reads BACKFILL_BATCH (pages per batch, default 20) and
+// BACKFILL_PAUSE (pause between batches, default 30s)
+func backfillSettings() (int, time.Duration) {
+	batch := defaultBackfillBatch
+	if v := os.Getenv("BACKFILL_BATCH"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			batch = n
+		} else {
+			slog.Warn("invalid BACKFILL_BATCH, using the default", "value", v, "default", batch)
+		}
+	}
+	pause := defaultBackfillPause
+	if v := os.Getenv("BACKFILL_PAUSE"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			pause = d
+		} else {
+			slog.Warn("invalid BACKFILL_PAUSE, using the default", "value", v, "default", pause)
+		}
+	}
+	return batch, pause
+}
+
+// startBackfill registers a new run for the given targets
+func startBackfill(store string, targets []backfillTarget) (*BackfillProgress, error) {
+	backfillMu.Lock()
+	defer backfillMu.Unlock()
+	if backfill != nil && backfill.Status == BackfillRunning {
+		return nil, errBackfillRunning
+	}
+
+	backfill = &BackfillProgress{Status: BackfillRunning, Store: store, NewslettersTotal: len(targets), StartedAt: time.Now()}
+	for _, t := range targets {
+		backfill.PagesTotal += len(t.pages)
+	}
+	return backfill, nil
+}
+
+// updateBackfill changes the current run under the lock
+func updateBackfill(change func(p *BackfillProgress)) {
+	backfillMu.Lock()
+	change(backfill)
+	backfillMu.Unlock()
+}
+
+// backfillProgress returns a copy of the current or last run
+func backfillProgress() (BackfillProgress, bool) {
+	backfillMu.Lock()
+	defer backfillMu.Unlock()
+	if backfill == nil {
+		return BackfillProgress{}, false
+	}
+	return *backfill, true
+}
+
+// runBackfill extracts the products of the targets' pages in batches,
+// pausing between batches so OCR doesn't starve the server. Prices are
+// checked against the history like during scrapes, and each processed
+// catalog joins the history of the next. Cancelling ctx stops the run
+// after the current page.
+func runBackfill(ctx context.Context, engine OCREngine, targets []backfillTarget) {
+	inFlight.Add(1)
+	defer inFlight.Done()
+
+	batch, pause := backfillSettings()
+	history := loadPriceHistory("")
+
+	status := BackfillFinished
+	inBatch := 0
+run:
+	for _, t := range targets {
+		n := t.newsletter
+		for _, page := range t.pages {
+			if inBatch == batch {
+				p, _ := backfillProgress()
+				slog.Info("backfill progress", "pages_done", p.PagesDone, "pages", p.PagesTotal, "newsletters_done", p.NewslettersDone, "newsletters", p.NewslettersTotal, "products", p.ProductsFound)
+				select {
+				case <-time.After(pause):
+				case <-ctx.Done():
+				}
+				inBatch = 0
+			}
+			if ctx.Err() != nil {
+				status = BackfillCancelled
+				break run
+			}
+			inBatch++
+
+			imagePath, _ := localImagePath(page.ImageURL)
+			products, err := extractPageProducts(engine, history, n.ID, page.PageNumber, imagePath)
+			if err != nil {
+				slog.Warn("backfill failed to extract products", "newsletter", n.ID, "page", page.PageNumber, "err", err)
+				updateBackfill(func(p *BackfillProgress) { p.PagesDone++; p.PagesFailed++ })
+				continue
+			}
+			for _, product := range products {
+				if unitPrice := product.Price.EffectiveUnitPrice(product.Price.Price); unitPrice > 0 && !product.Excluded() {
+					history[historyKey(product)] = append(history[historyKey(product)], unitPrice)
+				}
+			}
+			updateBackfill(func(p *BackfillProgress) { p.PagesDone++; p.ProductsFound += len(products) })
+		}
+		apiCache.invalidate()
+		updateBackfill(func(p *BackfillProgress) { p.NewslettersDone++ })
+	}
+
+	updateBackfill(func(p *BackfillProgress) {
+		now := time.Now()
+		p.Status, p.FinishedAt = status, &now
+	})
+	p, _ := backfillProgress()
+	slog.Info("backfill finished", "status", status, "pages_done", p.PagesDone, "pages", p.PagesTotal, "pages_failed", p.PagesFailed, "products", p.ProductsFound)
+}
+
+// runBackfillCommand runs the OCR backfill from the command line:
+// backfill-ocr [-store name] [-dry-run]
+func runBackfillCommand(args []string) error {
+	fs := flag.NewFlagSet("backfill-ocr", flag.ExitOnError)
+	store := fs.String("store", "", "only backfill this store")
+	dryRun := fs.Bool("dry-run", false, "only print the newsletters to process")
+	fs.Parse(args)
+
+	if err := warmup(); err != nil {
+		return err
+	}
+	if ocrEngine == nil {
+		return fmt.Errorf("OCR is disabled (OCR_PROVIDER=none)")
+	}
+
+	targets := backfillTargets(*store)
+	for _, t := range targets {
+		slog.Info("backfill", "newsletter", t.newsletter.ID, "pages", len(t.pages))
+	}
+	if *dryRun || len(targets) == 0 {
+		return nil
+	}
+
+	if _, err := startBackfill(*store, targets); err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	runBackfill(ctx, ocrEngine, targets)
+
+	if p, _ := backfillProgress(); p.PagesFailed > 0 {
+		return fmt.Errorf("%d of %d pages failed", p.PagesFailed, p.PagesTotal)
+	}
+	return nil
+}
+
+// API Handlers
+
+func getBackfill(w http.ResponseWriter, r *http.Request) {
+	progress, ok := backfillProgress()
+	if !ok {
+		http.Error(w, "No backfill has run", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(progress)
+}
+
+func startBackfillHandler(w http.ResponseWriter, r *http.Request) {
+	if ocrEngine == nil {
+		http.Error(w, "OCR is disabled", http.StatusServiceUnavailable)
+		return
+	}
+	store := r.URL.Query().Get("store")
+	if store != "" && !knownStore(store) {
+		http.Error(w, "Store not found", http.StatusNotFound)
+		return
+	}
+
+	targets := backfillTargets(store)
+	progress, err := startBackfill(store, targets)
+	if err == errBackfillRunning {
+		http.Error(w, "A backfill is already running", http.StatusConflict)
+		return
+	}
+	snapshot := *progress
+	go runBackfill(background, ocrEngine, targets)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/admin/backfill")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(snapshot)
+}
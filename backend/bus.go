@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scrape lifecycle and offer event types, published straight to the bus
+const (
+	EventScrapeStarted  = "scrape.started"
+	EventScrapeFinished = "scrape.finished"
+	EventOfferIndexed   = "offer.indexed"
+)
+
+const busDialTimeout = 5 * time.Second
+
+// EventPublisher sends events to an external bus
+type EventPublisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// eventBus is the configured publisher, nil when no bus is configured
+var eventBus EventPublisher
+
+// busPrefix is prepended to every subject/channel
+var busPrefix = "bestdeal"
+
+// NewEventPublisher returns the publisher for EVENT_BUS_URL: nats://host:port
+// or redis://[:password@]host:port. It returns nil when the variable is unset.
+func NewEventPublisher() (EventPublisher, error) {
+	raw := os.Getenv("EVENT_BUS_URL")
+	if raw == "" {
+		return nil, nil
+	}
+	if prefix := os.Getenv("EVENT_BUS_PREFIX"); prefix != "" {
+		busPrefix = prefix
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EVENT_BUS_URL: %v", err)
+	}
+	switch u.Scheme {
+	case "nats":
+		return &natsPublisher{addr: hostWithPort(u, "4222")}, nil
+	case "redis":
+		password, _ := u.User.Password()
+		return &redisPublisher{addr: hostWithPort(u, "6379"), password: password}, nil
+	default:
+		return nil, fmt.Errorf("unsupported event bus scheme %q", u.Scheme)
+	}
+}
+
+func hostWithPort(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
+
+// publishEvent publishes a transient event, logging failures
+func publishEvent(eventType string, payload interface{}) {
+	if eventBus == nil {
+		return
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"type":      eventType,
+		"payload":   payload,
+		"createdAt": time.Now(),
+	})
+	if err != nil {
+		return
+	}
+	if err := eventBus.Publish(busPrefix+"."+eventType, data); err != nil {
+		slog.Warn("failed to publish event", "type", eventType, "err", err)
+	}
+}
+
+// busEventHandler forwards outbox events to the bus, so newsletter events
+// are retried until the bus accepted them
+type busEventHandler struct {
+	publisher EventPublisher
+}
+
+func (busEventHandler) Name() string { return "bus" }
+
+func (h busEventHandler) Handle(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return h.publisher.Publish(busPrefix+"."+e.Type, data)
+}
+
+// natsPublisher speaks the NATS text protocol over a single connection
+type natsPublisher struct {
+	addr string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (p *natsPublisher) connect() error {
+	conn, err := net.DialTimeout("tcp", p.addr, busDialTimeout)
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(conn)
+
+	// The server greets with INFO before accepting commands
+	conn.SetReadDeadline(time.Now().Add(busDialTimeout))
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO") {
+		conn.Close()
+		return fmt.Errorf("unexpected NATS greeting %q: %v", line, err)
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	if _, err := conn.Write([]byte("CONNECT {\"verbose\":false,\"name\":\"bestdeal\"}\r\n")); err != nil {
+		conn.Close()
+		return err
+	}
+
+	// Answer server keep-alives so the connection isn't dropped
+	go func() {
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if strings.HasPrefix(line, "PING") {
+				p.mu.Lock()
+				conn.Write([]byte("PONG\r\n"))
+				p.mu.Unlock()
+			} else if strings.HasPrefix(line, "-ERR") {
+				slog.Warn("NATS error", "message", strings.TrimSpace(line))
+			}
+		}
+	}()
+
+	p.conn = conn
+	return nil
+}
+
+// Publish implements EventPublisher
+func (p *natsPublisher) Publish(subject string, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+	msg := fmt.Sprintf("PUB %s %d\r\n%s\r\n", subject, len(data), data)
+	if _, err := p.conn.Write([]byte(msg)); err != nil {
+		p.conn.Close()
+		p.conn = nil
+		return err
+	}
+	return nil
+}
+
+// redisPublisher issues PUBLISH commands over RESP
+type redisPublisher struct {
+	addr     string
+	password string
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func respCommand(args ...string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	return []byte(b.String())
+}
+
+// roundTrip sends a command and reads a single-line reply
+func (p *redisPublisher) roundTrip(args ...string) error {
+	p.conn.SetDeadline(time.Now().Add(busDialTimeout))
+	defer p.conn.SetDeadline(time.Time{})
+
+	if _, err := p.conn.Write(respCommand(args...)); err != nil {
+		return err
+	}
+	line, err := p.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(line, "-") {
+		return fmt.Errorf("redis: %s", strings.TrimSpace(line[1:]))
+	}
+	return nil
+}
+
+// Publish implements EventPublisher
+func (p *redisPublisher) Publish(channel string, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		conn, err := net.DialTimeout("tcp", p.addr, busDialTimeout)
+		if err != nil {
+			return err
+		}
+		p.conn, p.r = conn, bufio.NewReader(conn)
+		if p.password != "" {
+			if err := p.roundTrip("AUTH", p.password); err != nil {
+				p.conn.Close()
+				p.conn = nil
+				return err
+			}
+		}
+	}
+
+	if err := p.roundTrip("PUBLISH", channel, string(data)); err != nil {
+		p.conn.Close()
+		p.conn = nil
+		return err
+	}
+	return nil
+}
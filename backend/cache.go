@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// responseCacheTTL keeps hot responses just long enough to absorb bursts,
+// e.g. right after a notification blast
+const responseCacheTTL = 500 * time.Millisecond
+
+// cachedResponse is a captured handler response
+type cachedResponse struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// inflight is a handler call other identical requests wait on
+type inflight struct {
+	done chan struct{}
+	resp *cachedResponse
+}
+
+// responseCache caches GET responses briefly and coalesces concurrent
+// identical requests into a single handler call
+type responseCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedResponse
+	calls   map[string]*inflight
+}
+
+var apiCache = &responseCache{
+	entries: make(map[string]*cachedResponse),
+	calls:   make(map[string]*inflight),
+}
+
+// invalidate drops every cached response; called whenever data changes
+func (c *responseCache) invalidate() {
+	c.mu.Lock()
+	c.entries = make(map[string]*cachedResponse)
+	c.mu.Unlock()
+}
+
+// responseRecorder captures what a handler writes
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header { return r.header }
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(b)
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+// do returns a fresh cached response for key, or runs fn once for all
+// concurrent callers
+func (c *responseCache) do(key string, fn func() *cachedResponse) *cachedResponse {
+	c.mu.Lock()
+	if resp, ok := c.entries[key]; ok && time.Now().Before(resp.expires) {
+		c.mu.Unlock()
+		return resp
+	}
+	if call, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		<-call.done
+		return call.resp
+	}
+	call := &inflight{done: make(chan struct{})}
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	call.resp = fn()
+
+	c.mu.Lock()
+	delete(c.calls, key)
+	if call.resp.status == http.StatusOK {
+		c.entries[key] = call.resp
+	}
+	c.mu.Unlock()
+	close(call.done)
+
+	return call.resp
+}
+
+// cached wraps a GET handler with the shared response cache
+func cached(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Streamed responses go straight to the client
+		if wantsNDJSON(r) {
+			h(w, r)
+			return
+		}
+
+		// Responses may hold absolute links to the host they were requested from
+		key := baseURL(r) + r.URL.String() + "|" + r.Header.Get("Accept-Language")
+
+		resp := apiCache.do(key, func() *cachedResponse {
+			rec := &responseRecorder{header: make(http.Header)}
+			h(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			return &cachedResponse{
+				status:  rec.status,
+				header:  rec.header,
+				body:    rec.body.Bytes(),
+				expires: time.Now().Add(responseCacheTTL),
+			}
+		})
+
+		for k, v := range resp.header {
+			// Middleware like CORS already added its own Vary values
+			if k == "Vary" {
+				for _, value := range v {
+					w.Header().Add(k, value)
+				}
+				continue
+			}
+			w.Header()[k] = v
+		}
+		// Checked here rather than in h, so a 304 is never shared with
+		// coalesced requests
+		if resp.status == http.StatusOK && notModified(r, resp.header) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(resp.status)
+		w.Write(resp.body)
+	}
+}
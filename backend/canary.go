@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+const defaultCanaryInterval = 24 * time.Hour
+
+// CanaryConfig describes a cheap structural check of a store's website
+type CanaryConfig struct {
+	ListPage    string `json:"list_page"`
+	LinkPattern string `json:"link_pattern"`
+	ExpectedMin int    `json:"expected_min"`
+	ExpectedMax int    `json:"expected_max"`
+}
+
+// CanaryResult is the outcome of the last canary check for a store
+type CanaryResult struct {
+	Store       string    `json:"store"`
+	CheckedAt   time.Time `json:"checkedAt"`
+	LinksFound  int       `json:"linksFound"`
+	ExpectedMin int       `json:"expectedMin"`
+	ExpectedMax int       `json:"expectedMax"`
+	OK          bool      `json:"ok"`
+	Error       string    `json:"error,omitempty"`
+}
+
+var (
+	canaryMu      sync.Mutex
+	canaryResults = map[string]CanaryResult{}
+)
+
+// canaryConfigs returns the canary config of each store, taking the first
+// scraper config of a store that defines one
+func canaryConfigs() map[string]*CanaryConfig {
+	result := map[string]*CanaryConfig{}
+
+	configs, err := ListAvailableConfigs()
+	if err != nil {
+		return result
+	}
+	for _, name := range configs {
+		config, err := LoadScraperConfig(configFile(name))
+		if err != nil || config.Canary == nil {
+			continue
+		}
+		if _, ok := result[config.StoreName()]; !ok {
+			result[config.StoreName()] = config.Canary
+		}
+	}
+	return result
+}
+
+// countCatalogLinks loads a list page in the browser and counts the unique
+// links matching pattern
+func countCatalogLinks(ctx context.Context, canary *CanaryConfig) (int, error) {
+	re, err := regexp.Compile(canary.LinkPattern)
+	if err != nil {
+		return 0, fmt.Errorf("invalid link pattern: %v", err)
+	}
+
+	var links []string
+	err = chromedp.Run(ctx,
+		chromedp.Navigate(canary.ListPage),
+		chromedp.WaitReady("body"),
+		chromedp.Sleep(3*time.Second),
+		chromedp.Evaluate(`Array.from(document.querySelectorAll('a[href]')).map(a => a.href)`, &links),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	unique := map[string]bool{}
+	for _, link := range links {
+		if re.MatchString(link) {
+			unique[link] = true
+		}
+	}
+	return len(unique), nil
+}
+
+// runCanary checks one store and records the result
+func runCanary(store string, canary *CanaryConfig) CanaryResult {
+	ctx, cancel := context.WithTimeout(background, 60*time.Second)
+	defer cancel()
+	browserCtx, browserCancel := newBrowserContext(ctx)
+	defer browserCancel()
+
+	result := CanaryResult{
+		Store:       store,
+		CheckedAt:   time.Now(),
+		ExpectedMin: canary.ExpectedMin,
+		ExpectedMax: canary.ExpectedMax,
+	}
+
+	found, err := countCatalogLinks(browserCtx, canary)
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.LinksFound = found
+		result.OK = found >= canary.ExpectedMin && (canary.ExpectedMax == 0 || found <= canary.ExpectedMax)
+		if !result.OK {
+			result.Error = fmt.Sprintf("found %d catalog links, expected %d-%d", found, canary.ExpectedMin, canary.ExpectedMax)
+		}
+	}
+
+	canaryMu.Lock()
+	canaryResults[store] = result
+	canaryMu.Unlock()
+
+	if !result.OK {
+		alertMaintainers(fmt.Sprintf("Canary for %s failed: %s", store, result.Error))
+	}
+	return result
+}
+
+// runCanaries checks every store with a canary config
+func runCanaries() []CanaryResult {
+	results := []CanaryResult{}
+	for store, canary := range canaryConfigs() {
+		results = append(results, runCanary(store, canary))
+	}
+	return results
+}
+
+// startCanaryLoop runs the canaries periodically. CANARY_INTERVAL (a Go
+// duration, default 24h) sets the period; "off" disables the loop.
+func startCanaryLoop() {
+	interval := defaultCanaryInterval
+	if v := os.Getenv("CANARY_INTERVAL"); v != "" {
+		if v == "off" {
+			return
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			slog.Warn("invalid CANARY_INTERVAL, using the default", "value", v, "default", interval)
+		} else {
+			interval = d
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			runCanaries()
+		}
+	}()
+}
+
+// alertMaintainers logs an alert and posts it to ALERT_WEBHOOK_URL if set
+func alertMaintainers(message string) {
+	slog.Error("ALERT", "message", message)
+
+	webhook := os.Getenv("ALERT_WEBHOOK_URL")
+	if webhook == "" {
+		return
+	}
+	body, _ := json.Marshal(map[string]string{"text": message})
+	resp, err := http.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		slog.Warn("failed to send alert", "err", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// API Handlers
+
+func getCanaryResults(w http.ResponseWriter, r *http.Request) {
+	canaryMu.Lock()
+	results := make([]CanaryResult, 0, len(canaryResults))
+	for _, result := range canaryResults {
+		results = append(results, result)
+	}
+	canaryMu.Unlock()
+	sort.Slice(results, func(i, j int) bool { return results[i].Store < results[j].Store })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+func runCanariesNow(w http.ResponseWriter, r *http.Request) {
+	go runCanaries()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Canary checks started in background.",
+		"status":  "processing",
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// Newsletter categories
+const (
+	CategoryWeeklyFood = "weekly-food"
+	CategoryNonFood    = "non-food"
+	CategorySeasonal   = "seasonal"
+)
+
+const defaultLocale = "ro"
+
+// seasonalThemes maps a theme to the title keywords announcing it, per locale.
+// Keywords are matched against the lowercased title without diacritics.
+var seasonalThemes = map[string]map[string][]string{
+	"ro": {
+		"christmas":      {"craciun", "sarbatori de iarna", "sarbatorile de iarna"},
+		"easter":         {"de paste", "pastele", "paste fericit"},
+		"back-to-school": {"inapoi la scoala", "back to school", "rechizite"},
+		"valentines":     {"valentine", "dragobete"},
+		"black-friday":   {"black friday"},
+	},
+	"en": {
+		"christmas":      {"christmas", "xmas", "holiday season"},
+		"easter":         {"easter"},
+		"back-to-school": {"back to school"},
+		"valentines":     {"valentine"},
+		"black-friday":   {"black friday"},
+	},
+}
+
+// nonFoodKeywords announce catalogs without groceries, per locale
+var nonFoodKeywords = map[string][]string{
+	"ro": {"non-food", "nonfood", "bricolaj", "gradina", "electrocasnice", "textile", "parkside", "silvercrest"},
+	"en": {"non-food", "nonfood", "diy", "garden", "home & living", "electronics"},
+}
+
+var diacritics = strings.NewReplacer(
+	"ă", "a", "â", "a", "î", "i", "ș", "s", "ş", "s", "ț", "t", "ţ", "t",
+)
+
+// normalizeTitle lowercases a title and strips Romanian diacritics
+func normalizeTitle(title string) string {
+	return diacritics.Replace(strings.ToLower(title))
+}
+
+// ClassifyNewsletter returns the category and, for seasonal catalogs, the
+// theme of a newsletter based on its title
+func ClassifyNewsletter(title, locale string) (category, theme string) {
+	if _, ok := seasonalThemes[locale]; !ok {
+		locale = defaultLocale
+	}
+	t := normalizeTitle(title)
+
+	themes := make([]string, 0, len(seasonalThemes[locale]))
+	for theme := range seasonalThemes[locale] {
+		themes = append(themes, theme)
+	}
+	sort.Strings(themes)
+
+	for _, theme := range themes {
+		for _, k := range seasonalThemes[locale][theme] {
+			if strings.Contains(t, k) {
+				return CategorySeasonal, theme
+			}
+		}
+	}
+	for _, k := range nonFoodKeywords[locale] {
+		if strings.Contains(t, k) {
+			return CategoryNonFood, ""
+		}
+	}
+	return CategoryWeeklyFood, ""
+}
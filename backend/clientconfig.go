@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// demoMode is set when the server runs with -demo
+var demoMode bool
+
+// ClientStore is a store the frontend can show
+type ClientStore struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Country     string `json:"country,omitempty"`
+	LogoURL     string `json:"logoUrl,omitempty"`
+}
+
+// ClientFeatures tells the frontend which parts of the API this deployment
+// serves, so it can hide what would only return empty results
+type ClientFeatures struct {
+	// Search and Offers need products, extracted with OCR for stores
+	// whose configs set extract_products
+	Search   bool `json:"search"`
+	Offers   bool `json:"offers"`
+	Datasets bool `json:"datasets"`
+	Share    bool `json:"share"`
+	Widget   bool `json:"widget"`
+	Demo     bool `json:"demo"`
+}
+
+// ClientConfig is what a static frontend needs to adapt to the deployment
+type ClientConfig struct {
+	Features      ClientFeatures `json:"features"`
+	Stores        []ClientStore  `json:"stores"`
+	Locales       []string       `json:"locales"`
+	DefaultLocale string         `json:"defaultLocale"`
+	// Base URLs; relative ones are on this server
+	APIBaseURL      string `json:"apiBaseUrl"`
+	ImageBaseURL    string `json:"imageBaseUrl"`
+	AssetBaseURL    string `json:"assetBaseUrl"`
+	DatasetsBaseURL string `json:"datasetsBaseUrl"`
+}
+
+// clientConfig describes this deployment. Opted-out stores are left out,
+// and images are loaded from the CDN when CDN_PREWARM_URL is set.
+func clientConfig() (*ClientConfig, error) {
+	stores, err := ListAvailableStores()
+	if err != nil {
+		return nil, err
+	}
+	configs, err := ListAvailableConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	products := false
+	for _, name := range configs {
+		config, err := LoadScraperConfig(configFile(name))
+		if err == nil && config.ExtractProducts && !optOuts.IsOptedOut(config.StoreName()) {
+			products = true
+			break
+		}
+	}
+
+	c := &ClientConfig{
+		Features: ClientFeatures{
+			Search:   products && ocrEngine != nil,
+			Offers:   products && ocrEngine != nil,
+			Datasets: os.Getenv("DATASET_INTERVAL") != "off",
+			Share:    true,
+			Widget:   true,
+			Demo:     demoMode,
+		},
+		Stores:          []ClientStore{},
+		Locales:         supportedLanguages,
+		DefaultLocale:   defaultLocale,
+		APIBaseURL:      "/api",
+		ImageBaseURL:    strings.TrimSuffix(os.Getenv("CDN_PREWARM_URL"), "/") + "/newsletters/",
+		AssetBaseURL:    "/api/assets",
+		DatasetsBaseURL: "/datasets/",
+	}
+	for _, s := range stores {
+		if optOuts.IsOptedOut(s.Name) {
+			continue
+		}
+		c.Stores = append(c.Stores, ClientStore{
+			Name:        s.Name,
+			DisplayName: s.DisplayName,
+			Country:     s.Country,
+			LogoURL:     proxiedAssetURL(s.LogoURL),
+		})
+	}
+	return c, nil
+}
+
+// API Handlers
+
+func getClientConfig(w http.ResponseWriter, r *http.Request) {
+	c, err := clientConfig()
+	if err != nil {
+		http.Error(w, "Error loading configs", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
@@ -0,0 +1,596 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// clientModule is the module path of the generated Go client
+const clientModule = "github.com/domolitom/bestDeal/client"
+
+const generatedHeader = `// Code generated by "go run . gen-client"; DO NOT EDIT.`
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// apiTypes collects the named types the API definitions reach, in the
+// order they are first reached
+type apiTypes struct {
+	order []reflect.Type
+	names map[string]reflect.Type
+}
+
+// collectAPITypes walks the request and response types of apiEndpoints
+func collectAPITypes() (*apiTypes, error) {
+	at := &apiTypes{names: map[string]reflect.Type{}}
+	for _, e := range apiEndpoints {
+		for _, v := range []interface{}{e.Response, e.Request} {
+			if v == nil {
+				continue
+			}
+			if err := at.add(reflect.TypeOf(v)); err != nil {
+				return nil, fmt.Errorf("%s: %v", e.Name, err)
+			}
+		}
+	}
+	return at, nil
+}
+
+func (at *apiTypes) add(t reflect.Type) error {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return at.add(t.Elem())
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return fmt.Errorf("map %s has no string keys", t)
+		}
+		return at.add(t.Elem())
+	}
+	if !isLocalType(t) {
+		return nil
+	}
+
+	name := exportedName(t.Name())
+	if prev, ok := at.names[name]; ok {
+		if prev != t {
+			return fmt.Errorf("types %s and %s both become %s", prev, t, name)
+		}
+		return nil
+	}
+	at.names[name] = t
+	at.order = append(at.order, t)
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	for _, f := range jsonFields(t) {
+		if err := at.add(f.Field.Type); err != nil {
+			return fmt.Errorf("%s.%s: %v", t.Name(), f.Field.Name, err)
+		}
+	}
+	return nil
+}
+
+// isLocalType reports whether t is a named type of this package
+func isLocalType(t reflect.Type) bool {
+	return t.Name() != "" && t.PkgPath() == localPkgPath
+}
+
+// localPkgPath is the package path of this program's types
+var localPkgPath = reflect.TypeOf(Newsletter{}).PkgPath()
+
+// exportedName capitalizes unexported type names such as createShareRequest
+func exportedName(name string) string {
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// lowerFirst turns a Go method name into a TypeScript one
+func lowerFirst(name string) string {
+	r := []rune(name)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
+
+// Go client
+
+// goTypeExpr renders t as a type of the Go client
+func goTypeExpr(t reflect.Type) string {
+	switch {
+	case t == timeType:
+		return "time.Time"
+	case isLocalType(t):
+		return exportedName(t.Name())
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + goTypeExpr(t.Elem())
+	case reflect.Slice:
+		return "[]" + goTypeExpr(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), goTypeExpr(t.Elem()))
+	case reflect.Map:
+		return "map[string]" + goTypeExpr(t.Elem())
+	case reflect.Interface:
+		return "interface{}"
+	default:
+		return t.Kind().String()
+	}
+}
+
+// goParamValue renders the expression that formats a query parameter
+func goParamValue(p apiParam, v string) string {
+	switch p.Type {
+	case "int":
+		return "strconv.Itoa(" + v + ")"
+	case "bool":
+		return "strconv.FormatBool(" + v + ")"
+	default:
+		return v
+	}
+}
+
+// goZeroCheck renders the condition under which an optional parameter is sent
+func goZeroCheck(p apiParam, v string) string {
+	switch p.Type {
+	case "int":
+		return v + " != 0"
+	case "bool":
+		return v
+	default:
+		return v + ` != ""`
+	}
+}
+
+// goPathExpr renders the request path of an endpoint with its parameters escaped
+func goPathExpr(e apiEndpoint) string {
+	var parts []string
+	rest := "/api" + e.Path
+	for {
+		loc := pathParamRe.FindStringSubmatchIndex(rest)
+		if loc == nil {
+			break
+		}
+		if loc[0] > 0 {
+			parts = append(parts, fmt.Sprintf("%q", rest[:loc[0]]))
+		}
+		parts = append(parts, "url.PathEscape("+rest[loc[2]:loc[3]]+")")
+		rest = rest[loc[1]:]
+	}
+	if rest != "" {
+		parts = append(parts, fmt.Sprintf("%q", rest))
+	}
+	return strings.Join(parts, " + ")
+}
+
+// generateGoClient renders the Go client package
+func generateGoClient(at *apiTypes) ([]byte, error) {
+	var types bytes.Buffer
+	for _, t := range at.order {
+		name := exportedName(t.Name())
+		if t.Kind() != reflect.Struct {
+			fmt.Fprintf(&types, "\ntype %s %s\n", name, t.Kind())
+			continue
+		}
+		fmt.Fprintf(&types, "\ntype %s struct {\n", name)
+		for _, f := range jsonFields(t) {
+			if f.Embedded {
+				fmt.Fprintf(&types, "\t%s\n", goTypeExpr(f.Field.Type))
+				continue
+			}
+			tag := f.Name
+			if f.OmitEmpty {
+				tag += ",omitempty"
+			}
+			fmt.Fprintf(&types, "\t%s %s `json:%q`\n", f.Field.Name, goTypeExpr(f.Field.Type), tag)
+		}
+		types.WriteString("}\n")
+	}
+
+	imports := []string{"bytes", "context", "encoding/json", "io", "net/http", "net/url", "strconv", "strings"}
+	if strings.Contains(types.String(), "time.Time") {
+		imports = append(imports, "time")
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s\n\n", generatedHeader)
+	b.WriteString("// Package client is a typed client for the bestDeal API.\npackage client\n\nimport (\n")
+	for _, imp := range imports {
+		fmt.Fprintf(&b, "\t%q\n", imp)
+	}
+	b.WriteString(`)
+
+// Client calls the API of the server at BaseURL, such as http://localhost:8080
+type Client struct {
+	BaseURL string
+	// Token is sent as a bearer token when set
+	Token string
+	// HTTPClient defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// New returns a client for the server at baseURL
+func New(baseURL string) *Client {
+	return &Client{BaseURL: baseURL}
+}
+
+// Error is returned for responses with a non-2xx status
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return "bestdeal: HTTP " + strconv.Itoa(e.StatusCode) + ": " + e.Message
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	u := strings.TrimSuffix(c.BaseURL, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+`)
+	b.Write(types.Bytes())
+
+	for _, e := range apiEndpoints {
+		var optional []apiParam
+		args := []string{"ctx context.Context"}
+		for _, name := range e.pathParams() {
+			args = append(args, name+" string")
+		}
+		for _, p := range e.Query {
+			if p.Required {
+				args = append(args, p.Name+" "+p.Type)
+			} else {
+				optional = append(optional, p)
+			}
+		}
+		if e.Request != nil {
+			args = append(args, "body *"+goTypeExpr(reflect.TypeOf(e.Request)))
+		}
+		if len(optional) > 0 {
+			fmt.Fprintf(&b, "\n// %sParams are the optional parameters of %s\ntype %sParams struct {\n", e.Name, e.Name, e.Name)
+			for _, p := range optional {
+				fmt.Fprintf(&b, "\t%s %s\n", exportedName(p.Name), p.Type)
+			}
+			b.WriteString("}\n")
+			args = append(args, fmt.Sprintf("params *%sParams", e.Name))
+		}
+
+		resp := reflect.TypeOf(e.Response)
+		result, ret, fail := "*"+goTypeExpr(resp), "&out", "nil"
+		if resp.Kind() == reflect.Slice {
+			result, ret = goTypeExpr(resp), "out"
+		}
+
+		fmt.Fprintf(&b, "\n// %s %s\nfunc (c *Client) %s(%s) (%s, error) {\n", e.Name, e.Doc, e.Name, strings.Join(args, ", "), result)
+		b.WriteString("\tquery := url.Values{}\n")
+		for _, p := range e.Query {
+			if p.Required {
+				fmt.Fprintf(&b, "\tquery.Set(%q, %s)\n", p.Name, goParamValue(p, p.Name))
+			}
+		}
+		if len(optional) > 0 {
+			b.WriteString("\tif params != nil {\n")
+			for _, p := range optional {
+				v := "params." + exportedName(p.Name)
+				fmt.Fprintf(&b, "\t\tif %s {\n\t\t\tquery.Set(%q, %s)\n\t\t}\n", goZeroCheck(p, v), p.Name, goParamValue(p, v))
+			}
+			b.WriteString("\t}\n")
+		}
+		body := "nil"
+		if e.Request != nil {
+			body = "body"
+		}
+		fmt.Fprintf(&b, "\tvar out %s\n", goTypeExpr(resp))
+		fmt.Fprintf(&b, "\tif err := c.do(ctx, %q, %s, query, %s, &out); err != nil {\n\t\treturn %s, err\n\t}\n", e.Method, goPathExpr(e), body, fail)
+		fmt.Fprintf(&b, "\treturn %s, nil\n}\n", ret)
+	}
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated Go client doesn't parse: %v", err)
+	}
+	return src, nil
+}
+
+// TypeScript client
+
+// tsTypeExpr renders t as a type of the TypeScript client
+func tsTypeExpr(t reflect.Type) string {
+	switch {
+	case t == timeType:
+		return "string"
+	case isLocalType(t):
+		return exportedName(t.Name())
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return tsTypeExpr(t.Elem()) + " | null"
+	case reflect.Slice, reflect.Array:
+		elem := tsTypeExpr(t.Elem())
+		if strings.Contains(elem, " ") {
+			elem = "(" + elem + ")"
+		}
+		return elem + "[]"
+	case reflect.Map:
+		return "Record<string, " + tsTypeExpr(t.Elem()) + ">"
+	case reflect.Interface:
+		return "unknown"
+	default:
+		return tsBasicType(t.Kind())
+	}
+}
+
+// tsBasicType maps a Go kind to a TypeScript primitive
+func tsBasicType(k reflect.Kind) string {
+	switch k {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	default:
+		return "unknown"
+	}
+}
+
+// tsParamType maps an apiParam type to a TypeScript one
+func tsParamType(p apiParam) string {
+	if p.Type == "int" {
+		return "number"
+	}
+	if p.Type == "bool" {
+		return "boolean"
+	}
+	return "string"
+}
+
+// generateTSClient renders the TypeScript client module
+func generateTSClient(at *apiTypes) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s\n", generatedHeader)
+
+	for _, t := range at.order {
+		name := exportedName(t.Name())
+		if t.Kind() != reflect.Struct {
+			fmt.Fprintf(&b, "\nexport type %s = %s;\n", name, tsBasicType(t.Kind()))
+			continue
+		}
+		var extends []string
+		var lines []string
+		fields := jsonFields(t)
+		for _, f := range fields {
+			if f.Embedded {
+				base := tsTypeExpr(f.Field.Type)
+				if shadowed := shadowedFields(fields, f.Field.Type); len(shadowed) > 0 {
+					// TypeScript rejects overriding a property with another type
+					base = fmt.Sprintf(`Omit<%s, "%s">`, base, strings.Join(shadowed, `" | "`))
+				}
+				extends = append(extends, base)
+				continue
+			}
+			optional := ""
+			if f.OmitEmpty {
+				optional = "?"
+			}
+			lines = append(lines, fmt.Sprintf("  %s%s: %s;", f.Name, optional, tsTypeExpr(f.Field.Type)))
+		}
+		fmt.Fprintf(&b, "\nexport interface %s ", name)
+		if len(extends) > 0 {
+			fmt.Fprintf(&b, "extends %s ", strings.Join(extends, ", "))
+		}
+		b.WriteString("{\n")
+		for _, line := range lines {
+			b.WriteString(line + "\n")
+		}
+		b.WriteString("}\n")
+	}
+
+	b.WriteString(`
+/** Thrown for responses with a non-2xx status */
+export class ApiError extends Error {
+  constructor(readonly status: number, message: string) {
+    super(message);
+    this.name = "ApiError";
+  }
+}
+
+export interface ClientOptions {
+  /** Sent as a bearer token when set */
+  token?: string;
+  /** Defaults to the global fetch */
+  fetch?: typeof fetch;
+}
+
+type Query = Record<string, string | number | boolean | undefined>;
+
+/** A typed client for the bestDeal API */
+export class BestDealClient {
+  /** baseUrl is the server, such as http://localhost:8080; empty calls the page's origin */
+  constructor(private readonly baseUrl: string = "", private readonly options: ClientOptions = {}) {}
+
+  private async request<T>(method: string, path: string, query: Query = {}, body?: unknown): Promise<T> {
+    const params = new URLSearchParams();
+    for (const [key, value] of Object.entries(query)) {
+      if (value !== undefined && value !== "" && value !== 0 && value !== false) {
+        params.set(key, String(value));
+      }
+    }
+    const search = params.toString();
+    const headers: Record<string, string> = { Accept: "application/json" };
+    if (body !== undefined) {
+      headers["Content-Type"] = "application/json";
+    }
+    if (this.options.token) {
+      headers["Authorization"] = ` + "`Bearer ${this.options.token}`" + `;
+    }
+    const doFetch = this.options.fetch ?? fetch;
+    const response = await doFetch(this.baseUrl.replace(/\/$/, "") + path + (search ? "?" + search : ""), {
+      method,
+      headers,
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    if (!response.ok) {
+      throw new ApiError(response.status, (await response.text()).trim());
+    }
+    return (await response.json()) as T;
+  }
+`)
+
+	for _, e := range apiEndpoints {
+		var args, required, optional []string
+		path := "/api" + e.Path
+		for _, name := range e.pathParams() {
+			args = append(args, name+": string")
+			path = strings.Replace(path, "{"+name+"}", "${encodeURIComponent("+name+")}", 1)
+		}
+		for _, p := range e.Query {
+			if p.Required {
+				args = append(args, p.Name+": "+tsParamType(p))
+				required = append(required, p.Name)
+			} else {
+				optional = append(optional, p.Name+"?: "+tsParamType(p))
+			}
+		}
+		if e.Request != nil {
+			args = append(args, "body: "+tsTypeExpr(reflect.TypeOf(e.Request)))
+		}
+
+		query := "{}"
+		switch {
+		case len(optional) > 0 && len(required) > 0:
+			query = "{ ...params, " + strings.Join(required, ", ") + " }"
+		case len(optional) > 0:
+			query = "params"
+		case len(required) > 0:
+			query = "{ " + strings.Join(required, ", ") + " }"
+		}
+		if len(optional) > 0 {
+			args = append(args, "params: { "+strings.Join(optional, "; ")+" } = {}")
+		}
+		call := fmt.Sprintf("%q, `%s`", e.Method, path)
+		if query != "{}" || e.Request != nil {
+			call += ", " + query
+		}
+		if e.Request != nil {
+			call += ", body"
+		}
+
+		resp := tsTypeExpr(reflect.TypeOf(e.Response))
+		name := lowerFirst(e.Name)
+		fmt.Fprintf(&b, "\n  /** %s %s */\n", name, e.Doc)
+		fmt.Fprintf(&b, "  %s(%s): Promise<%s> {\n", name, strings.Join(args, ", "), resp)
+		fmt.Fprintf(&b, "    return this.request<%s>(%s);\n  }\n", resp, call)
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+// generatedClientFiles renders every file of the client directory
+func generatedClientFiles() (map[string][]byte, error) {
+	at, err := collectAPITypes()
+	if err != nil {
+		return nil, err
+	}
+	goSrc, err := generateGoClient(at)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{
+		"go.mod":      []byte("module " + clientModule + "\n\ngo 1.24\n"),
+		"client.go":   goSrc,
+		"bestdeal.ts": generateTSClient(at),
+	}, nil
+}
+
+// runGenClient writes the Go and TypeScript clients generated from
+// apiEndpoints, or with -check only reports the files that are out of date
+func runGenClient(args []string) error {
+	fs := flag.NewFlagSet("gen-client", flag.ExitOnError)
+	out := fs.String("out", filepath.Join("..", "client"), "directory to write the clients to")
+	check := fs.Bool("check", false, "fail if the clients in -out are out of date instead of writing them")
+	fs.Parse(args)
+
+	files, err := generatedClientFiles()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if *check {
+		var stale []string
+		for _, name := range names {
+			current, err := os.ReadFile(filepath.Join(*out, name))
+			if err != nil || !bytes.Equal(current, files[name]) {
+				stale = append(stale, filepath.Join(*out, name))
+			}
+		}
+		if len(stale) > 0 {
+			return fmt.Errorf("out of date, run gen-client: %s", strings.Join(stale, ", "))
+		}
+		fmt.Printf("Clients in %s are up to date\n", *out)
+		return nil
+	}
+
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(*out, name), files[name], 0644); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s\n", filepath.Join(*out, name))
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// minTileOverlap is the intersection-over-union above which two tiles are
+// considered the same slot on both pages
+const minTileOverlap = 0.3
+
+// ComparedPage describes one side of a page comparison
+type ComparedPage struct {
+	NewsletterID string `json:"newsletterId"`
+	Store        string `json:"store"`
+	Title        string `json:"title"`
+	ValidFrom    string `json:"validFrom"`
+	ValidUntil   string `json:"validUntil"`
+	PageNumber   int    `json:"pageNumber"`
+	ImageURL     string `json:"imageUrl"`
+}
+
+// RelativeTile is a tile in page-relative coordinates (0..1), so pages of
+// different resolutions can be compared
+type RelativeTile struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// TilePair is a product slot found on one or both compared pages
+type TilePair struct {
+	A *RelativeTile `json:"a"`
+	B *RelativeTile `json:"b"`
+}
+
+// parsePageRef parses a "{id}/{page}" reference
+func parsePageRef(ref string) (Newsletter, Page, error) {
+	i := strings.LastIndex(ref, "/")
+	if i < 0 {
+		return Newsletter{}, Page{}, fmt.Errorf("expected {id}/{page}, got %q", ref)
+	}
+	pageNum, err := strconv.Atoi(ref[i+1:])
+	if err != nil {
+		return Newsletter{}, Page{}, fmt.Errorf("invalid page number in %q", ref)
+	}
+
+	newsletter, ok := newsletters.Get(ref[:i])
+	if !ok {
+		return Newsletter{}, Page{}, fmt.Errorf("newsletter %s not found", ref[:i])
+	}
+	for _, page := range newsletter.Pages {
+		if page.PageNumber == pageNum {
+			return newsletter, page, nil
+		}
+	}
+	return Newsletter{}, Page{}, fmt.Errorf("page %d not found in %s", pageNum, newsletter.ID)
+}
+
+// loadRelativeTiles reads the tile sidecar of a page, if tile detection ran for it
+func loadRelativeTiles(page Page) []RelativeTile {
+	imagePath, ok := localImagePath(page.ImageURL)
+	if !ok {
+		return nil
+	}
+	data, err := os.ReadFile(tilesPath(imagePath))
+	if err != nil {
+		return nil
+	}
+	var tiles []Tile
+	if err := json.Unmarshal(data, &tiles); err != nil {
+		return nil
+	}
+
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil || cfg.Width == 0 || cfg.Height == 0 {
+		return nil
+	}
+
+	rel := make([]RelativeTile, len(tiles))
+	for i, t := range tiles {
+		rel[i] = RelativeTile{
+			X:      float64(t.X) / float64(cfg.Width),
+			Y:      float64(t.Y) / float64(cfg.Height),
+			Width:  float64(t.Width) / float64(cfg.Width),
+			Height: float64(t.Height) / float64(cfg.Height),
+		}
+	}
+	return rel
+}
+
+func overlap(a, b RelativeTile) float64 {
+	w := min(a.X+a.Width, b.X+b.Width) - max(a.X, b.X)
+	h := min(a.Y+a.Height, b.Y+b.Height) - max(a.Y, b.Y)
+	if w <= 0 || h <= 0 {
+		return 0
+	}
+	inter := w * h
+	return inter / (a.Width*a.Height + b.Width*b.Height - inter)
+}
+
+// alignTiles pairs the tiles of two pages by greatest overlap; unmatched
+// tiles are returned with an empty counterpart
+func alignTiles(a, b []RelativeTile) []TilePair {
+	type candidate struct {
+		i, j  int
+		score float64
+	}
+	var candidates []candidate
+	for i := range a {
+		for j := range b {
+			if s := overlap(a[i], b[j]); s >= minTileOverlap {
+				candidates = append(candidates, candidate{i, j, s})
+			}
+		}
+	}
+	sort.Slice(candidates, func(x, y int) bool { return candidates[x].score > candidates[y].score })
+
+	usedA := make([]bool, len(a))
+	usedB := make([]bool, len(b))
+	pairs := []TilePair{}
+	for _, c := range candidates {
+		if usedA[c.i] || usedB[c.j] {
+			continue
+		}
+		usedA[c.i], usedB[c.j] = true, true
+		pairs = append(pairs, TilePair{A: &a[c.i], B: &b[c.j]})
+	}
+	for i := range a {
+		if !usedA[i] {
+			pairs = append(pairs, TilePair{A: &a[i]})
+		}
+	}
+	for j := range b {
+		if !usedB[j] {
+			pairs = append(pairs, TilePair{B: &b[j]})
+		}
+	}
+	return pairs
+}
+
+func comparedPage(n Newsletter, p Page) ComparedPage {
+	return ComparedPage{
+		NewsletterID: n.ID,
+		Store:        n.Store,
+		Title:        n.Title,
+		ValidFrom:    n.ValidFrom,
+		ValidUntil:   n.ValidUntil,
+		PageNumber:   p.PageNumber,
+		ImageURL:     p.ImageURL,
+	}
+}
+
+// comparePages returns two catalog pages side by side with their product
+// tiles aligned, e.g. this week's and last week's page 3 of the same store
+func comparePages(w http.ResponseWriter, r *http.Request) {
+	newsletterA, pageA, err := parsePageRef(r.URL.Query().Get("a"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid page a: %v", err), http.StatusBadRequest)
+		return
+	}
+	newsletterB, pageB, err := parsePageRef(r.URL.Query().Get("b"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid page b: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"a":     comparedPage(newsletterA, pageA),
+		"b":     comparedPage(newsletterB, pageB),
+		"tiles": alignTiles(loadRelativeTiles(pageA), loadRelativeTiles(pageB)),
+	})
+}
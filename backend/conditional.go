@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// setValidators sets the ETag and Last-Modified of a response built from
+// list. The ETag hashes the ID and LastUpdated of every newsletter, so it
+// changes when one is scraped again, added or removed, plus variant, what
+// else the body depends on such as its language, and the current hour, as
+// validities count down. Last-Modified is the newest LastUpdated. Clients
+// must revalidate before reusing the response.
+func setValidators(w http.ResponseWriter, list []Newsletter, variant string) {
+	h := sha256.New()
+	h.Write([]byte(variant + " " + time.Now().UTC().Format("2006-01-02T15")))
+	var modified time.Time
+	for _, n := range list {
+		h.Write([]byte("\n" + n.ID + " " + n.LastUpdated.UTC().Format(time.RFC3339Nano)))
+		if n.LastUpdated.After(modified) {
+			modified = n.LastUpdated
+		}
+	}
+
+	w.Header().Set("ETag", `W/"`+hex.EncodeToString(h.Sum(nil)[:16])+`"`)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+}
+
+// notModified reports whether the client already has the response with the
+// validators in header: its If-None-Match lists the ETag or, when it sends
+// no If-None-Match, its If-Modified-Since is not before Last-Modified
+func notModified(r *http.Request, header http.Header) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		etag := strings.TrimPrefix(header.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !modified.After(since)
+}
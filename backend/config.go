@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 )
 
 // ScraperConfig defines the configuration for a store scraper
@@ -12,6 +14,69 @@ type ScraperConfig struct {
 	CoverImage string `json:"cover_image"`
 	FirstPage  string `json:"first_page"`
 	LastPage   string `json:"last_page"`
+
+	// Newsletter metadata; store defaults to the ID prefix and title to the ID
+	Store      string `json:"store,omitempty"`
+	Title      string `json:"title,omitempty"`
+	ValidFrom  string `json:"valid_from,omitempty"`
+	ValidUntil string `json:"valid_until,omitempty"`
+	LogoURL    string `json:"logo_url,omitempty"`
+	Locale     string `json:"locale,omitempty"`
+	// Timezone is an IANA name like Europe/Bucharest, the default; the
+	// days newsletters are valid are counted in it
+	Timezone string `json:"timezone,omitempty"`
+
+	// Store metadata; the first config of a store that sets a field wins
+	DisplayName string `json:"display_name,omitempty"`
+	Country     string `json:"country,omitempty"`
+	// RetentionDays is how many days after expiry newsletters are kept;
+	// 0 keeps them forever, unset uses RETENTION_DAYS
+	RetentionDays *int `json:"retention_days,omitempty"`
+	// Budget caps what one scrape of the store may use, aborting it when it
+	// goes over: Chrome CPU seconds, bytes downloaded and pages Chrome
+	// navigated to. 0 is unlimited.
+	BudgetCPUSeconds float64 `json:"budget_cpu_seconds,omitempty"`
+	BudgetBytes      int64   `json:"budget_bytes,omitempty"`
+	BudgetPages      int     `json:"budget_pages,omitempty"`
+
+	// Cover detection, used when cover_image is empty or "auto"
+	LogoTemplate    string `json:"logo_template,omitempty"`
+	CoverCandidates int    `json:"cover_candidates,omitempty"`
+
+	// Canary is an optional cheap structural check of the store's website
+	Canary *CanaryConfig `json:"canary,omitempty"`
+
+	// Strategy is how the catalog's pages are found, see StrategyPageByPage;
+	// API configures StrategyAPI and PDF StrategyPDF
+	Strategy string     `json:"strategy,omitempty"`
+	API      *APIConfig `json:"api,omitempty"`
+	PDF      *PDFConfig `json:"pdf,omitempty"`
+
+	// Extractor finds the page image in the store's viewer, see
+	// ExtractorGeneric
+	Extractor string `json:"extractor,omitempty"`
+
+	// Scripts are JavaScript snippets reading the viewer's own data, used
+	// instead of parsing the page when set
+	Scripts *ScriptConfig `json:"scripts,omitempty"`
+
+	// DetectTiles segments each downloaded page into product tiles
+	DetectTiles bool `json:"detect_tiles,omitempty"`
+
+	// ExtractProducts reads product names and prices from each downloaded
+	// page with OCR
+	ExtractProducts bool `json:"extract_products,omitempty"`
+
+	// ArchiveProvenance saves the source URL, retrieval time and original
+	// image URL of every download in provenance.json
+	ArchiveProvenance bool `json:"archive_provenance,omitempty"`
+
+	// How the newsletter ID is generated, see NewsletterID
+	IDStrategy string `json:"id_strategy,omitempty"`
+	IDTemplate string `json:"id_template,omitempty"`
+
+	// Schedule is a cron expression for automatic scrapes, see ParseSchedule
+	Schedule string `json:"schedule,omitempty"`
 }
 
 // LoadScraperConfig loads the scraper configuration from a specific config file
@@ -29,14 +94,22 @@ func LoadScraperConfig(configPath string) (*ScraperConfig, error) {
 	return &config, nil
 }
 
+// StoreName returns the store the config scrapes
+func (c *ScraperConfig) StoreName() string {
+	if c.Store != "" {
+		return c.Store
+	}
+	return storeFromID(c.ID)
+}
+
 // ListAvailableConfigs returns all available config files
 func ListAvailableConfigs() ([]string, error) {
-	files, err := os.ReadDir("configs")
+	files, err := os.ReadDir(serverConfig.ConfigDir)
 	if err != nil {
 		return nil, err
 	}
 
-	var configs []string
+	configs := []string{}
 	for _, file := range files {
 		if !file.IsDir() && filepath.Ext(file.Name()) == ".json" {
 			configs = append(configs, file.Name())
@@ -45,3 +118,69 @@ func ListAvailableConfigs() ([]string, error) {
 
 	return configs, nil
 }
+
+// StoreConfig is a store as described by its scraper configs
+type StoreConfig struct {
+	Name        string   `json:"name"`
+	DisplayName string   `json:"displayName"`
+	LogoURL     string   `json:"logoUrl,omitempty"`
+	Country     string   `json:"country,omitempty"`
+	Timezone    string   `json:"timezone,omitempty"`
+	Configs     []string `json:"configs"`
+
+	RetentionDays *int `json:"retentionDays,omitempty"`
+}
+
+// ListAvailableStores returns every store with a config, sorted by name.
+// The display name defaults to the capitalized store name and the country
+// to the region of a locale such as "ro-RO".
+func ListAvailableStores() ([]StoreConfig, error) {
+	configs, err := ListAvailableConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	byName := map[string]*StoreConfig{}
+	for _, name := range configs {
+		config, err := LoadScraperConfig(configFile(name))
+		if err != nil {
+			continue
+		}
+		store, ok := byName[config.StoreName()]
+		if !ok {
+			store = &StoreConfig{Name: config.StoreName()}
+			byName[store.Name] = store
+		}
+		store.Configs = append(store.Configs, strings.TrimSuffix(name, ".json"))
+
+		if store.DisplayName == "" {
+			store.DisplayName = config.DisplayName
+		}
+		if store.LogoURL == "" {
+			store.LogoURL = config.LogoURL
+		}
+		if store.RetentionDays == nil {
+			store.RetentionDays = config.RetentionDays
+		}
+		if store.Timezone == "" {
+			store.Timezone = config.Timezone
+		}
+		if store.Country == "" {
+			store.Country = config.Country
+			if _, region, ok := strings.Cut(config.Locale, "-"); ok && store.Country == "" {
+				store.Country = region
+			}
+		}
+	}
+
+	stores := make([]StoreConfig, 0, len(byName))
+	for _, store := range byName {
+		if store.DisplayName == "" && store.Name != "" {
+			store.DisplayName = strings.ToUpper(store.Name[:1]) + store.Name[1:]
+		}
+		store.Country = strings.ToUpper(store.Country)
+		stores = append(stores, *store)
+	}
+	sort.Slice(stores, func(i, j int) bool { return stores[i].Name < stores[j].Name })
+	return stores, nil
+}
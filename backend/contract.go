@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// contractClient requests the API of a running server for the contract check
+type contractClient struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+// get requests an API path and returns the body of a 200 JSON response
+func (c *contractClient) get(path string) ([]byte, error) {
+	req, err := http.NewRequest("GET", c.base+"/api"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		return nil, fmt.Errorf("Content-Type is %q, expected application/json", ct)
+	}
+	return body, nil
+}
+
+// waitReady polls /readyz, so the check can run right after starting the server
+func (c *contractClient) waitReady(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := c.http.Get(c.base + "/readyz")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s isn't ready after %s", c.base, timeout)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// samples picks a newsletter, store and group of the server to request
+// the endpoints that take one
+func (c *contractClient) samples() map[string]string {
+	samples := map[string]string{}
+	var list NewsletterPage
+	if body, err := c.get("/newsletters"); err == nil && json.Unmarshal(body, &list) == nil && len(list.Items) > 0 {
+		samples["newsletter"] = list.Items[0].ID
+	}
+	var stores StoreList
+	if body, err := c.get("/stores"); err == nil && json.Unmarshal(body, &stores) == nil && len(stores.Stores) > 0 {
+		samples["store"] = stores.Stores[0].Name
+	}
+	var groups []StoreGroup
+	if body, err := c.get("/groups"); err == nil && json.Unmarshal(body, &groups) == nil && len(groups) > 0 {
+		samples["group"] = groups[0].ID
+	}
+	return samples
+}
+
+// check requests the sample path of an endpoint and compares the response
+// with the endpoint's definition
+func (c *contractClient) check(e apiEndpoint, samples map[string]string) doctorCheck {
+	t := reflect.TypeOf(e.Response)
+	check := doctorCheck{Name: e.Name, Detail: "matches " + strings.ReplaceAll(t.String(), "main.", "")}
+
+	var unresolved string
+	path := pathParamRe.ReplaceAllStringFunc(e.Sample, func(m string) string {
+		name := strings.Trim(m, "{}")
+		if samples[name] == "" {
+			unresolved = name
+		}
+		return url.PathEscape(samples[name])
+	})
+	if unresolved != "" {
+		check.Detail = fmt.Sprintf("skipped, the server has no %s to request", unresolved)
+		return check
+	}
+
+	body, err := c.get(path)
+	if err == nil {
+		err = checkResponse(body, t)
+	}
+	if err != nil {
+		check.Err = fmt.Errorf("GET /api%s: %v", path, err)
+	}
+	return check
+}
+
+// checkResponse compares a JSON response with type t both ways: fields t
+// doesn't have fail the decode, and fields encoding/json always writes for
+// t must be in the response
+func checkResponse(body []byte, t reflect.Type) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(reflect.New(t).Interface()); err != nil {
+		return err
+	}
+
+	var raw interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, name := range missingFields(t, raw, "") {
+		seen[name] = true
+	}
+	if len(seen) == 0 {
+		return nil
+	}
+	missing := make([]string, 0, len(seen))
+	for name := range seen {
+		missing = append(missing, name)
+	}
+	sort.Strings(missing)
+	return fmt.Errorf("missing fields %s", strings.Join(missing, ", "))
+}
+
+// missingFields lists the fields without omitempty that v, decoded from
+// JSON, lacks. Elements of lists and maps are reported as name[].
+func missingFields(t reflect.Type, v interface{}, path string) []string {
+	if v == nil || t == timeType {
+		return nil
+	}
+	var missing []string
+	switch t.Kind() {
+	case reflect.Ptr:
+		return missingFields(t.Elem(), v, path)
+	case reflect.Slice, reflect.Array:
+		items, _ := v.([]interface{})
+		for _, item := range items {
+			missing = append(missing, missingFields(t.Elem(), item, path+"[]")...)
+		}
+	case reflect.Map:
+		items, _ := v.(map[string]interface{})
+		for _, item := range items {
+			missing = append(missing, missingFields(t.Elem(), item, path+"[]")...)
+		}
+	case reflect.Struct:
+		obj, _ := v.(map[string]interface{})
+		fields := jsonFields(t)
+		for _, f := range fields {
+			if f.Embedded {
+				// Fields of the outer struct hide the ones they shadow
+				inner := make(map[string]interface{}, len(obj))
+				for k, item := range obj {
+					inner[k] = item
+				}
+				for _, name := range shadowedFields(fields, f.Field.Type) {
+					inner[name] = nil
+				}
+				missing = append(missing, missingFields(f.Field.Type, inner, path)...)
+				continue
+			}
+			name := strings.TrimPrefix(path+"."+f.Name, ".")
+			value, ok := obj[f.Name]
+			if !ok {
+				if !f.OmitEmpty {
+					missing = append(missing, name)
+				}
+				continue
+			}
+			missing = append(missing, missingFields(f.Field.Type, value, name)...)
+		}
+	}
+	return missing
+}
+
+// runContract checks the responses of a running server against
+// apiEndpoints, the definitions the clients are generated from
+func runContract(args []string) error {
+	fs := flag.NewFlagSet("contract", flag.ExitOnError)
+	server := fs.String("url", "http://localhost:8080", "server to check")
+	token := fs.String("token", "", "API token, if the server requires one")
+	fs.Parse(args)
+
+	c := &contractClient{
+		base:  strings.TrimSuffix(*server, "/"),
+		token: *token,
+		http:  &http.Client{Timeout: 30 * time.Second},
+	}
+	if err := c.waitReady(time.Minute); err != nil {
+		return err
+	}
+
+	samples := c.samples()
+	var checks []doctorCheck
+	for _, e := range apiEndpoints {
+		if e.Sample != "" {
+			checks = append(checks, c.check(e, samples))
+		}
+	}
+	return reportChecks(checks)
+}
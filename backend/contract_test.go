@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// seedContractData gives the endpoints of the contract something to list:
+// a store config and an active newsletter of that store
+func seedContractData(t *testing.T) {
+	t.Helper()
+	config := `{"id": "lidl-contract", "store": "lidl", "first_page": "https://example.com/1", "last_page": "https://example.com/2"}`
+	path := configFile("lidl-contract.json")
+	if err := os.WriteFile(path, []byte(config), filePerm); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(path) })
+
+	today := time.Now()
+	withNewsletters(t, []Newsletter{{
+		ID:            "lidl-contract",
+		ConfigID:      "lidl-contract",
+		Store:         "lidl",
+		Title:         "Catalog",
+		OriginalTitle: "Catalog",
+		ValidFrom:     today.AddDate(0, 0, -2).Format("2006-01-02"),
+		ValidUntil:    today.AddDate(0, 0, 4).Format("2006-01-02"),
+		CoverImage:    "/newsletters/lidl-contract/cover-image.jpg",
+		PageCount:     2,
+		Pages: []Page{
+			{PageNumber: 1, ImageURL: "/newsletters/lidl-contract/pages/page-001.jpg"},
+			{PageNumber: 2, ImageURL: "/newsletters/lidl-contract/pages/page-002.jpg"},
+		},
+		LastUpdated: today,
+	}})
+}
+
+// checkContract requests the sample path of every endpoint the clients are
+// generated from and compares the responses with their definitions
+func checkContract(t *testing.T, wantSkipped bool) {
+	server := httptest.NewServer(testServer)
+	defer server.Close()
+	c := &contractClient{base: server.URL, http: server.Client()}
+
+	samples := c.samples()
+	for _, e := range apiEndpoints {
+		if e.Sample == "" {
+			continue
+		}
+		t.Run(e.Name, func(t *testing.T) {
+			check := c.check(e, samples)
+			if check.Err != nil {
+				t.Fatal(check.Err)
+			}
+			if skipped := strings.HasPrefix(check.Detail, "skipped"); skipped && !wantSkipped {
+				t.Fatal(check.Detail)
+			}
+		})
+	}
+}
+
+func TestContract(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		withNewsletters(t, []Newsletter{})
+		checkContract(t, true)
+	})
+	t.Run("seeded", func(t *testing.T) {
+		seedContractData(t)
+		checkContract(t, false)
+	})
+}
+
+func TestCheckResponse(t *testing.T) {
+	type item struct {
+		Name string `json:"name"`
+		Note string `json:"note,omitempty"`
+	}
+	type envelope struct {
+		Items []item `json:"items"`
+		Total int    `json:"total"`
+	}
+
+	tests := []struct {
+		body string
+		ok   bool
+	}{
+		{`{"items": [], "total": 0}`, true},
+		{`{"items": [{"name": "a", "note": "b"}, {"name": "c"}], "total": 2}`, true},
+		{`{"items": null, "total": 0}`, true},
+		{`{"items": []}`, false},                          // total missing
+		{`{"items": [{"note": "b"}], "total": 1}`, false}, // items[].name missing
+		{`{"items": [], "total": 0, "extra": 1}`, false},  // unknown field
+		{`{"items": [], "total": "0"}`, false},            // wrong type
+		{`[]`, false},
+	}
+	for _, tt := range tests {
+		err := checkResponse([]byte(tt.body), reflect.TypeOf(envelope{}))
+		if (err == nil) != tt.ok {
+			t.Errorf("checkResponse(%s) = %v, want ok: %v", tt.body, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy describes which cross-origin requests a group of routes accepts
+type CORSPolicy struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// allowsOrigin reports whether origin may call routes under this policy
+func (p *CORSPolicy) allowsOrigin(origin string) bool {
+	for _, o := range p.AllowedOrigins {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// apply sets the CORS headers for origin, if the policy allows it
+func (p *CORSPolicy) apply(w http.ResponseWriter, origin string) {
+	w.Header().Add("Vary", "Origin")
+	if origin == "" || !p.allowsOrigin(origin) {
+		return
+	}
+
+	// Credentials can't be combined with a wildcard origin
+	if p.allowsOrigin("*") && !p.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(p.AllowedMethods, ", "))
+	w.Header().Set("Access-Control-Allow-Headers", strings.Join(p.AllowedHeaders, ", "))
+	if p.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+	}
+}
+
+// splitList splits a comma separated env value, falling back to def when unset
+func splitList(value, def string) []string {
+	if value == "" {
+		value = def
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// LoadCORSPolicies builds the policies for public read routes and for
+// restricted routes (admin, widget and everything that mutates) from env.
+// Restricted routes accept the origins of ServerConfig.
+//
+//	CORS_PUBLIC_ORIGINS     origins allowed to read the public API (default *)
+//	CORS_ALLOWED_HEADERS    request headers allowed (default Content-Type, Authorization)
+//	CORS_ALLOW_CREDENTIALS  "true" to allow cookies on restricted routes
+//	CORS_MAX_AGE            how long browsers may cache preflights (Go duration, default 10m)
+func LoadCORSPolicies() (public, restricted *CORSPolicy) {
+	headers := splitList(os.Getenv("CORS_ALLOWED_HEADERS"), "Content-Type, Authorization")
+
+	maxAge := 10 * time.Minute
+	if v := os.Getenv("CORS_MAX_AGE"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			maxAge = d
+		}
+	}
+
+	public = &CORSPolicy{
+		AllowedOrigins: splitList(os.Getenv("CORS_PUBLIC_ORIGINS"), "*"),
+		AllowedMethods: []string{"GET", "HEAD", "OPTIONS"},
+		AllowedHeaders: headers,
+		MaxAge:         maxAge,
+	}
+	restricted = &CORSPolicy{
+		AllowedOrigins:   serverConfig.AllowedOrigins,
+		AllowedMethods:   []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   headers,
+		AllowCredentials: os.Getenv("CORS_ALLOW_CREDENTIALS") == "true",
+		MaxAge:           maxAge,
+	}
+	return public, restricted
+}
+
+// restrictedRoute reports whether a request needs the restricted CORS policy
+func restrictedRoute(r *http.Request) bool {
+	method := r.Method
+	if method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+		method = r.Header.Get("Access-Control-Request-Method")
+	}
+	if method != "GET" && method != "HEAD" {
+		return true
+	}
+	return strings.HasPrefix(r.URL.Path, "/api/admin") || strings.HasPrefix(r.URL.Path, "/api/widget")
+}
+
+// CORS middleware applying the public or restricted policy per route
+func enableCORS(next http.Handler) http.Handler {
+	public, restricted := LoadCORSPolicies()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := public
+		if restrictedRoute(r) {
+			policy = restricted
+		}
+		policy.apply(w, r.Header.Get("Origin"))
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
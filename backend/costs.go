@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+var costsFile = dataPath("scrape-costs.json")
+
+// maxRecentCosts is how many runs are kept per store; totals count all of them
+const maxRecentCosts = 20
+
+// cpuSampleInterval is how often Chrome's CPU time is read during a scrape
+const cpuSampleInterval = 5 * time.Second
+
+// errOverBudget aborts scrapes that used more than their store's budget
+var errOverBudget = errors.New("scrape budget exceeded")
+
+// Budgets a scrape can go over
+const (
+	BudgetCPUSeconds = "cpuSeconds"
+	BudgetBytes      = "bytes"
+	BudgetPages      = "pages"
+)
+
+// ScrapeBudget caps the resources one scrape of a store may use; 0 is unlimited
+type ScrapeBudget struct {
+	CPUSeconds float64 `json:"cpuSeconds,omitempty"`
+	Bytes      int64   `json:"bytes,omitempty"`
+	Pages      int     `json:"pages,omitempty"`
+}
+
+// ScrapeCost is what one scrape used
+type ScrapeCost struct {
+	Config     string    `json:"config"`
+	Store      string    `json:"store"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	// CPUSeconds is the CPU time of Chrome and its renderers, 0 where it
+	// can't be measured
+	CPUSeconds float64 `json:"cpuSeconds"`
+	// BytesDownloaded counts what Chrome received over the network and the
+	// images, PDFs and API responses fetched directly
+	BytesDownloaded int64 `json:"bytesDownloaded"`
+	// PagesNavigated counts the pages Chrome loaded, not catalog pages
+	PagesNavigated int    `json:"pagesNavigated"`
+	Succeeded      bool   `json:"succeeded"`
+	OverBudget     string `json:"overBudget,omitempty"` // the budget that aborted the run
+}
+
+// StoreCosts sums the scrapes of a store
+type StoreCosts struct {
+	Store           string        `json:"store"`
+	Runs            int           `json:"runs"`
+	Aborted         int           `json:"aborted"`
+	CPUSeconds      float64       `json:"cpuSeconds"`
+	BytesDownloaded int64         `json:"bytesDownloaded"`
+	PagesNavigated  int           `json:"pagesNavigated"`
+	Budget          *ScrapeBudget `json:"budget,omitempty"`
+	Recent          []ScrapeCost  `json:"recent"` // newest first
+}
+
+// CostRegistry holds the costs of scrapes per store and persists them to disk
+type CostRegistry struct {
+	mu     sync.Mutex
+	path   string
+	stores map[string]*StoreCosts
+}
+
+var scrapeCosts *CostRegistry
+
+// LoadCostRegistry loads scrape costs from path, starting empty if it doesn't exist
+func LoadCostRegistry(path string) (*CostRegistry, error) {
+	reg := &CostRegistry{path: path, stores: make(map[string]*StoreCosts)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return reg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*StoreCosts
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	for _, c := range list {
+		reg.stores[c.Store] = c
+	}
+	return reg, nil
+}
+
+// save writes the costs of all stores to disk; the caller must hold mu
+func (r *CostRegistry) save() error {
+	list := make([]*StoreCosts, 0, len(r.stores))
+	for _, c := range r.stores {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Store < list[j].Store })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, data, filePerm)
+}
+
+// Record adds a finished scrape to the totals of its store
+func (r *CostRegistry) Record(cost ScrapeCost) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.stores[cost.Store]
+	if !ok {
+		c = &StoreCosts{Store: cost.Store}
+		r.stores[cost.Store] = c
+	}
+	c.Runs++
+	if cost.OverBudget != "" {
+		c.Aborted++
+	}
+	c.CPUSeconds += cost.CPUSeconds
+	c.BytesDownloaded += cost.BytesDownloaded
+	c.PagesNavigated += cost.PagesNavigated
+	c.Recent = append([]ScrapeCost{cost}, c.Recent...)
+	if len(c.Recent) > maxRecentCosts {
+		c.Recent = c.Recent[:maxRecentCosts]
+	}
+	return r.save()
+}
+
+// List returns the costs of all stores sorted by store
+func (r *CostRegistry) List() []StoreCosts {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]StoreCosts, 0, len(r.stores))
+	for _, c := range r.stores {
+		copied := *c
+		copied.Recent = append([]ScrapeCost{}, c.Recent...)
+		list = append(list, copied)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Store < list[j].Store })
+	return list
+}
+
+// storeBudgets returns the budget of every store that has one, read from
+// its configs; the first config of a store that sets a limit wins
+func storeBudgets() map[string]ScrapeBudget {
+	budgets := map[string]ScrapeBudget{}
+	configs, _ := ListAvailableConfigs()
+	for _, name := range configs {
+		config, err := LoadScraperConfig(configFile(name))
+		if err != nil {
+			continue
+		}
+		b := budgets[config.StoreName()]
+		if b.CPUSeconds == 0 {
+			b.CPUSeconds = config.BudgetCPUSeconds
+		}
+		if b.Bytes == 0 {
+			b.Bytes = config.BudgetBytes
+		}
+		if b.Pages == 0 {
+			b.Pages = config.BudgetPages
+		}
+		if b != (ScrapeBudget{}) {
+			budgets[config.StoreName()] = b
+		}
+	}
+	return budgets
+}
+
+// costMeter measures what a scrape uses and aborts it when it goes over
+// its store's budget
+type costMeter struct {
+	budget ScrapeBudget
+	abort  context.CancelCauseFunc
+
+	mu   sync.Mutex
+	cost ScrapeCost
+	pid  int // Chrome's, 0 until the browser started
+	over error
+}
+
+// newCostMeter starts measuring a scrape of config; abort cancels it
+func newCostMeter(config *ScraperConfig, abort context.CancelCauseFunc) *costMeter {
+	return &costMeter{
+		budget: storeBudgets()[config.StoreName()],
+		abort:  abort,
+		cost:   ScrapeCost{Config: config.ID, Store: config.StoreName(), StartedAt: time.Now()},
+	}
+}
+
+// watch counts the traffic and navigations of the browser in ctx and
+// samples its CPU time until ctx is done
+func (m *costMeter) watch(ctx context.Context) {
+	chromedp.ListenTarget(ctx, func(ev any) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.pid == 0 {
+			if b := chromedp.FromContext(ctx).Browser; b != nil && b.Process() != nil {
+				m.pid = b.Process().Pid
+			}
+		}
+		switch e := ev.(type) {
+		case *network.EventLoadingFinished:
+			m.cost.BytesDownloaded += int64(e.EncodedDataLength)
+		case *page.EventFrameNavigated:
+			if e.Frame.ParentID == "" {
+				m.cost.PagesNavigated++
+			}
+		default:
+			return
+		}
+		m.check()
+	})
+
+	go func() {
+		ticker := time.NewTicker(cpuSampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.sampleCPU()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// countDownload adds a file fetched outside the browser
+func (m *costMeter) countDownload(filePath string) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cost.BytesDownloaded += info.Size()
+	m.check()
+}
+
+// sampleCPU reads the CPU time Chrome used so far
+func (m *costMeter) sampleCPU() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pid == 0 {
+		return
+	}
+	// A renderer that exited but wasn't reaped yet counts for neither
+	// itself nor its parent, so keep the highest total
+	if cpu, err := processTreeCPU(m.pid); err == nil && cpu > m.cost.CPUSeconds {
+		m.cost.CPUSeconds = cpu
+	}
+	m.check()
+}
+
+// check aborts the scrape when it is over budget; the caller must hold mu
+func (m *costMeter) check() {
+	if m.over != nil {
+		return
+	}
+	var over string
+	var used, limit any
+	switch {
+	case m.budget.CPUSeconds > 0 && m.cost.CPUSeconds > m.budget.CPUSeconds:
+		over, used, limit = BudgetCPUSeconds, fmt.Sprintf("%.1f", m.cost.CPUSeconds), m.budget.CPUSeconds
+	case m.budget.Bytes > 0 && m.cost.BytesDownloaded > m.budget.Bytes:
+		over, used, limit = BudgetBytes, m.cost.BytesDownloaded, m.budget.Bytes
+	case m.budget.Pages > 0 && m.cost.PagesNavigated > m.budget.Pages:
+		over, used, limit = BudgetPages, m.cost.PagesNavigated, m.budget.Pages
+	default:
+		return
+	}
+	m.cost.OverBudget = over
+	m.over = fmt.Errorf("%w: used %v %s of %v", errOverBudget, used, over, limit)
+	m.abort(m.over)
+}
+
+// err returns why the scrape was aborted, nil while it is within budget
+func (m *costMeter) err() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.over
+}
+
+// finish takes a last CPU sample, which must happen before the browser
+// exits, and records the cost of the scrape
+func (m *costMeter) finish(ctx context.Context, err error) {
+	m.sampleCPU()
+	m.mu.Lock()
+	cost := m.cost
+	m.mu.Unlock()
+
+	cost.FinishedAt = time.Now()
+	cost.Succeeded = err == nil
+	if cost.OverBudget != "" {
+		budgetAborts.inc(cost.Store, cost.OverBudget)
+	}
+	if err := scrapeCosts.Record(cost); err != nil {
+		logFrom(ctx).Warn("failed to save scrape cost", "err", err)
+	}
+	logFrom(ctx).Info("scrape cost", "cpu_seconds", cost.CPUSeconds, "bytes", cost.BytesDownloaded, "navigations", cost.PagesNavigated)
+}
+
+// API Handlers
+
+func getCosts(w http.ResponseWriter, r *http.Request) {
+	store := r.URL.Query().Get("store")
+	budgets := storeBudgets()
+	list := []StoreCosts{}
+	for _, c := range scrapeCosts.List() {
+		if store != "" && c.Store != store {
+			continue
+		}
+		if b, ok := budgets[c.Store]; ok {
+			c.Budget = &b
+		}
+		list = append(list, c)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
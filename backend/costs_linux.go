@@ -0,0 +1,67 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// clockTicks is USER_HZ, the unit of CPU times in /proc, 100 on every
+// architecture Linux supports today
+const clockTicks = 100
+
+// processTreeCPU returns the CPU seconds pid and its descendants used,
+// including children that already exited, read from /proc
+func processTreeCPU(pid int) (float64, error) {
+	stats, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		return 0, err
+	}
+
+	parents := map[int]int{}
+	ticks := map[int]int64{}
+	for _, path := range stats {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue // the process exited
+		}
+		// The command in parentheses may contain spaces, the fields after
+		// it don't: state ppid ... utime(14) stime cutime cstime(17)
+		s := string(data)
+		end := strings.LastIndexByte(s, ')')
+		if end < 0 {
+			continue
+		}
+		fields := strings.Fields(s[end+1:])
+		if len(fields) < 15 {
+			continue
+		}
+		p, err := strconv.Atoi(filepath.Base(filepath.Dir(path)))
+		if err != nil {
+			continue
+		}
+		parents[p], _ = strconv.Atoi(fields[1])
+		for _, f := range fields[11:15] {
+			n, _ := strconv.ParseInt(f, 10, 64)
+			ticks[p] += n
+		}
+	}
+	if _, ok := ticks[pid]; !ok {
+		return 0, fmt.Errorf("process %d not found", pid)
+	}
+
+	var total int64
+	for p, t := range ticks {
+		for q := p; q > 0; q = parents[q] {
+			if q == pid {
+				total += t
+				break
+			}
+		}
+	}
+	return float64(total) / clockTicks, nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// processTreeCPU can't read CPU times on this platform; scrapes report 0
+// CPU seconds and CPU budgets never abort them
+func processTreeCPU(pid int) (float64, error) {
+	return 0, errors.New("measuring CPU time is not supported on this platform")
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"os"
+)
+
+const (
+	// coverAuto makes the scraper pick the cover from the downloaded pages
+	coverAuto = "auto"
+	// defaultCoverCandidates is how many leading pages are considered as cover
+	defaultCoverCandidates = 5
+	// coverSampleWidth is the width pages are downscaled to before scoring
+	coverSampleWidth = 96
+)
+
+// logoScales are the logo widths tried, as a fraction of the page width
+var logoScales = []float64{0.12, 0.18, 0.25, 0.35}
+
+// grayImage is a small grayscale raster used for cover scoring
+type grayImage struct {
+	w, h int
+	pix  []float64
+}
+
+func (g *grayImage) at(x, y int) float64 {
+	return g.pix[y*g.w+x]
+}
+
+// maxImagePixels caps the size of images decoded from disk. A small file
+// can declare huge dimensions and take gigabytes to decode.
+const maxImagePixels = 50_000_000
+
+// decodeImageFile decodes a JPEG or PNG image from disk, refusing images
+// over maxImagePixels before decoding them
+func decodeImageFile(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, fmt.Errorf("image of %dx%d pixels is too large", config.Width, config.Height)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// toGray downscales an image to the given width (keeping the aspect ratio)
+// by box-averaging the luminance of the source pixels
+func toGray(img image.Image, width int) *grayImage {
+	b := img.Bounds()
+	if width > b.Dx() {
+		width = b.Dx()
+	}
+	height := int(math.Round(float64(b.Dy()) * float64(width) / float64(b.Dx())))
+	if width < 1 || height < 1 {
+		return &grayImage{}
+	}
+
+	g := &grayImage{w: width, h: height, pix: make([]float64, width*height)}
+	for y := 0; y < height; y++ {
+		y0 := b.Min.Y + y*b.Dy()/height
+		y1 := b.Min.Y + (y+1)*b.Dy()/height
+		for x := 0; x < width; x++ {
+			x0 := b.Min.X + x*b.Dx()/width
+			x1 := b.Min.X + (x+1)*b.Dx()/width
+
+			var sum float64
+			var n int
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					r, gr, bl, _ := img.At(sx, sy).RGBA()
+					sum += (0.299*float64(r) + 0.587*float64(gr) + 0.114*float64(bl)) / 65535
+					n++
+				}
+			}
+			if n > 0 {
+				g.pix[y*width+x] = sum / float64(n)
+			}
+		}
+	}
+	return g
+}
+
+// matchTemplate returns the best normalized cross-correlation of tmpl
+// against img, searching only rows above maxY
+func matchTemplate(img, tmpl *grayImage, maxY int) float64 {
+	if tmpl.w == 0 || tmpl.h == 0 || tmpl.w > img.w || tmpl.h > img.h {
+		return 0
+	}
+	if maxY > img.h-tmpl.h {
+		maxY = img.h - tmpl.h
+	}
+
+	n := float64(tmpl.w * tmpl.h)
+	var tMean float64
+	for _, v := range tmpl.pix {
+		tMean += v
+	}
+	tMean /= n
+	var tVar float64
+	for _, v := range tmpl.pix {
+		tVar += (v - tMean) * (v - tMean)
+	}
+	if tVar == 0 {
+		return 0
+	}
+
+	best := -1.0
+	for y := 0; y <= maxY; y++ {
+		for x := 0; x <= img.w-tmpl.w; x++ {
+			var pMean float64
+			for ty := 0; ty < tmpl.h; ty++ {
+				for tx := 0; tx < tmpl.w; tx++ {
+					pMean += img.at(x+tx, y+ty)
+				}
+			}
+			pMean /= n
+
+			var cross, pVar float64
+			for ty := 0; ty < tmpl.h; ty++ {
+				for tx := 0; tx < tmpl.w; tx++ {
+					p := img.at(x+tx, y+ty) - pMean
+					cross += p * (tmpl.at(tx, ty) - tMean)
+					pVar += p * p
+				}
+			}
+			if pVar == 0 {
+				continue
+			}
+			if score := cross / math.Sqrt(tVar*pVar); score > best {
+				best = score
+			}
+		}
+	}
+	return best
+}
+
+// headerEnergy scores the top quarter of a page by its horizontal gradient
+// energy; covers carry the large headline and validity dates up there
+func headerEnergy(img *grayImage) float64 {
+	rows := img.h / 4
+	if rows == 0 || img.w < 2 {
+		return 0
+	}
+
+	var sum float64
+	for y := 0; y < rows; y++ {
+		for x := 1; x < img.w; x++ {
+			sum += math.Abs(img.at(x, y) - img.at(x-1, y))
+		}
+	}
+	return sum / float64(rows*(img.w-1))
+}
+
+// detectCoverPage picks the page that most likely is the catalog cover.
+// With a logo template the page whose upper half best matches the logo wins,
+// otherwise the page with the busiest header band is chosen.
+func detectCoverPage(pagePaths []string, logoPath string) (string, error) {
+	if len(pagePaths) == 0 {
+		return "", fmt.Errorf("no pages to choose a cover from")
+	}
+
+	var logo image.Image
+	if logoPath != "" {
+		var err error
+		logo, err = decodeImageFile(logoPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to load logo template: %v", err)
+		}
+	}
+
+	bestPath := ""
+	bestScore := math.Inf(-1)
+	for _, path := range pagePaths {
+		img, err := decodeImageFile(path)
+		if err != nil {
+			continue
+		}
+		page := toGray(img, coverSampleWidth)
+
+		var score float64
+		if logo != nil {
+			score = -1
+			for _, scale := range logoScales {
+				tmpl := toGray(logo, int(math.Round(scale*float64(page.w))))
+				if s := matchTemplate(page, tmpl, page.h/2); s > score {
+					score = s
+				}
+			}
+		} else {
+			score = headerEnergy(page)
+		}
+
+		if score > bestScore {
+			bestScore = score
+			bestPath = path
+		}
+	}
+
+	if bestPath == "" {
+		return "", fmt.Errorf("none of the %d candidate pages could be decoded", len(pagePaths))
+	}
+	return bestPath, nil
+}
+
+// copyFile copies src to dst, overwriting dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := createFile(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
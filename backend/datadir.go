@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Data directory layouts, selected by DATA_LAYOUT
+const (
+	// LayoutFlat stores every newsletter in ../newsletters/{id} (the default)
+	LayoutFlat = "flat"
+	// LayoutSharded stores newsletters in ../newsletters/{store}/{year}/{id},
+	// which keeps directories small once there are thousands of newsletters
+	LayoutSharded = "sharded"
+)
+
+// dataLayout returns the configured layout
+func dataLayout() string {
+	if os.Getenv("DATA_LAYOUT") == LayoutSharded {
+		return LayoutSharded
+	}
+	return LayoutFlat
+}
+
+// newsletterDir returns where a newsletter's files are stored in layout.
+// Image URLs stay /newsletters/{id}/... whatever the layout.
+func newsletterDir(layout, store, id, validFrom string) string {
+	if layout != LayoutSharded {
+		return filepath.Join(newslettersDir, id)
+	}
+	year := "undated"
+	if len(validFrom) >= 4 {
+		year = validFrom[:4]
+	}
+	return filepath.Join(newslettersDir, store, year, id)
+}
+
+// dataDir returns the directory of a stored newsletter
+func dataDir(n Newsletter) string {
+	return newsletterDir(dataLayout(), n.Store, n.ID, n.ValidFrom)
+}
+
+// dataDirByID returns the directory of the newsletter with the given ID,
+// falling back to the flat layout for files without a record
+func dataDirByID(id string) string {
+	if n, ok := newsletters.Get(id); ok {
+		return dataDir(n)
+	}
+	return filepath.Join(newslettersDir, id)
+}
+
+// localImagePath maps a served image URL like /newsletters/{id}/pages/page-001.jpg
+// back to its file on disk
+func localImagePath(imageURL string) (string, bool) {
+	rel, ok := strings.CutPrefix(imageURL, "/newsletters/")
+	if !ok {
+		return "", false
+	}
+	rel = path.Clean("/" + rel)[1:]
+	id, rest, ok := strings.Cut(rel, "/")
+	if !ok || id == "" || strings.HasPrefix(id, ".") {
+		return "", false
+	}
+	return filepath.Join(dataDirByID(id), filepath.FromSlash(rest)), true
+}
+
+// runMigrateLayout moves newsletter directories into the layout selected by
+// DATA_LAYOUT. It must run while the server is stopped.
+func runMigrateLayout(args []string) error {
+	fs := flag.NewFlagSet("migrate-layout", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "only print the planned moves")
+	fs.Parse(args)
+
+	list, err := LoadNewsletters()
+	if err != nil {
+		return fmt.Errorf("failed to load newsletters: %v", err)
+	}
+
+	layout := dataLayout()
+	moved := 0
+	for _, n := range list {
+		to := newsletterDir(layout, n.Store, n.ID, n.ValidFrom)
+		for _, from := range []string{
+			newsletterDir(LayoutFlat, n.Store, n.ID, n.ValidFrom),
+			newsletterDir(LayoutSharded, n.Store, n.ID, n.ValidFrom),
+		} {
+			if from == to {
+				continue
+			}
+			if _, err := os.Stat(from); err != nil {
+				continue
+			}
+			if _, err := os.Stat(to); err == nil {
+				return fmt.Errorf("cannot move %s: %s already exists", from, to)
+			}
+
+			slog.Info("move", "from", from, "to", to)
+			if *dryRun {
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(to), dirPerm); err != nil {
+				return err
+			}
+			if err := os.Rename(from, to); err != nil {
+				return fmt.Errorf("failed to move %s: %v", from, err)
+			}
+			moved++
+		}
+	}
+	if !*dryRun {
+		slog.Info("moved newsletters", "count", moved, "layout", layout)
+		// Rollback snapshots point at the old paths
+		os.RemoveAll(rollbackDir)
+	}
+	return nil
+}
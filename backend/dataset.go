@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var datasetsDir = dataPath("datasets")
+
+const (
+	// datasetSchemaVersion changes only when columns are removed or change meaning
+	datasetSchemaVersion   = 1
+	defaultDatasetInterval = 24 * time.Hour
+)
+
+// datasetColumns is the header of every weekly price file
+var datasetColumns = []string{
+	"week", "week_start", "store", "product", "unit", "currency",
+	"offers", "min_unit_price", "median_unit_price", "max_unit_price",
+}
+
+// DatasetFile describes one published weekly file
+type DatasetFile struct {
+	Week      string `json:"week"`
+	File      string `json:"file"`
+	Rows      int    `json:"rows"`
+	WeekStart string `json:"weekStart"`
+}
+
+// DatasetIndex is published as index.json next to the weekly files
+type DatasetIndex struct {
+	SchemaVersion int           `json:"schemaVersion"`
+	Columns       []string      `json:"columns"`
+	GeneratedAt   time.Time     `json:"generatedAt"`
+	Files         []DatasetFile `json:"files"`
+}
+
+// priceGroup collects the unit prices of one product in one store and week
+type priceGroup struct {
+	week, weekStart, store, product, unit, currency string
+	prices                                          []float64
+}
+
+// isoWeek returns the ISO week of a date ("2026-W07") and its Monday
+func isoWeek(date string) (string, string, bool) {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return "", "", false
+	}
+	year, week := t.ISOWeek()
+	monday := t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+	return fmt.Sprintf("%d-W%02d", year, week), monday.Format("2006-01-02"), true
+}
+
+// productKey normalizes a product name so OCR variants of the same name
+// aggregate together
+func productKey(name string) string {
+	return strings.Join(strings.Fields(normalizeTitle(name)), " ")
+}
+
+// aggregatePrices groups the extracted products of all canonical
+// newsletters by ISO week of validity start, store, product and unit,
+// leaving out prices flagged as anomalies. Only aggregates are published,
+// never single offers or page references.
+func aggregatePrices(list []Newsletter) map[string][]*priceGroup {
+	groups := map[string]*priceGroup{}
+	for _, n := range withoutSuperseded(list) {
+		week, weekStart, ok := isoWeek(n.ValidFrom)
+		if !ok {
+			continue
+		}
+		for _, page := range n.Pages {
+			for _, p := range loadPageProducts(page) {
+				product := productKey(p.Name)
+				unitPrice := p.Price.EffectiveUnitPrice(p.Price.Price)
+				if product == "" || unitPrice <= 0 || p.Excluded() {
+					continue
+				}
+				key := strings.Join([]string{week, n.Store, product, p.Price.Unit, p.Price.Currency}, "\x00")
+				g, ok := groups[key]
+				if !ok {
+					g = &priceGroup{week: week, weekStart: weekStart, store: n.Store, product: product, unit: p.Price.Unit, currency: p.Price.Currency}
+					groups[key] = g
+				}
+				g.prices = append(g.prices, unitPrice)
+			}
+		}
+	}
+
+	byWeek := map[string][]*priceGroup{}
+	for _, g := range groups {
+		byWeek[g.week] = append(byWeek[g.week], g)
+	}
+	for _, week := range byWeek {
+		sort.Slice(week, func(i, j int) bool {
+			if week[i].store != week[j].store {
+				return week[i].store < week[j].store
+			}
+			if week[i].product != week[j].product {
+				return week[i].product < week[j].product
+			}
+			return week[i].unit < week[j].unit
+		})
+	}
+	return byWeek
+}
+
+// median returns the median of prices, sorting them
+func median(prices []float64) float64 {
+	sort.Float64s(prices)
+	mid := len(prices) / 2
+	if len(prices)%2 == 0 {
+		return (prices[mid-1] + prices[mid]) / 2
+	}
+	return prices[mid]
+}
+
+// writeFileAtomic writes a file through a temporary one, so readers never
+// see a partial dataset
+func writeFileAtomic(path string, write func(*os.File) error) error {
+	tmp := path + ".tmp"
+	f, err := createFile(tmp)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// writeWeekCSV writes one week of aggregates as CSV
+func writeWeekCSV(path string, groups []*priceGroup) error {
+	return writeFileAtomic(path, func(f *os.File) error {
+		w := csv.NewWriter(f)
+		w.Write(datasetColumns)
+		for _, g := range groups {
+			prices := append([]float64{}, g.prices...)
+			sort.Float64s(prices)
+			w.Write([]string{
+				g.week, g.weekStart, g.store, g.product, g.unit, g.currency,
+				strconv.Itoa(len(prices)),
+				strconv.FormatFloat(prices[0], 'f', 2, 64),
+				strconv.FormatFloat(median(prices), 'f', 2, 64),
+				strconv.FormatFloat(prices[len(prices)-1], 'f', 2, 64),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	})
+}
+
+// publishDatasets writes a CSV of aggregated prices per ISO week and an
+// index.json describing them to ../newsletters/datasets
+func publishDatasets() (*DatasetIndex, error) {
+	if err := os.MkdirAll(datasetsDir, dirPerm); err != nil {
+		return nil, err
+	}
+
+	index := &DatasetIndex{
+		SchemaVersion: datasetSchemaVersion,
+		Columns:       datasetColumns,
+		GeneratedAt:   time.Now(),
+		Files:         []DatasetFile{},
+	}
+	for week, groups := range aggregatePrices(newsletters.List()) {
+		file := fmt.Sprintf("prices-%s.csv", week)
+		if err := writeWeekCSV(filepath.Join(datasetsDir, file), groups); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %v", file, err)
+		}
+		index.Files = append(index.Files, DatasetFile{Week: week, File: file, Rows: len(groups), WeekStart: groups[0].weekStart})
+	}
+	sort.Slice(index.Files, func(i, j int) bool { return index.Files[i].Week < index.Files[j].Week })
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	err = writeFileAtomic(filepath.Join(datasetsDir, "index.json"), func(f *os.File) error {
+		_, err := f.Write(data)
+		return err
+	})
+	return index, err
+}
+
+// startDatasetLoop publishes the datasets now and then periodically.
+// DATASET_INTERVAL (a Go duration, default 24h) sets the period; "off"
+// disables publishing.
+func startDatasetLoop() {
+	interval := defaultDatasetInterval
+	if v := os.Getenv("DATASET_INTERVAL"); v != "" {
+		if v == "off" {
+			return
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			slog.Warn("invalid DATASET_INTERVAL, using the default", "value", v, "default", interval)
+		} else {
+			interval = d
+		}
+	}
+
+	publish := func() {
+		index, err := publishDatasets()
+		if err != nil {
+			slog.Error("failed to publish datasets", "err", err)
+			return
+		}
+		slog.Info("published price datasets", "weeks", len(index.Files))
+	}
+
+	go func() {
+		publish()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			publish()
+		}
+	}()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// pageIndex maps the SHA-256 of page images of earlier catalog versions to
+// their paths, so unchanged pages of a new version can share their files
+type pageIndex map[string]string
+
+// priorPages indexes the pages a scrape may repeat: those of the directory
+// the scrape replaced, kept in the rollback snapshot, and those of the
+// store's other newsletters whose validity overlaps the new catalog
+func priorPages(config *ScraperConfig, id string, snapshot *StoreSnapshot) pageIndex {
+	idx := pageIndex{}
+	add := func(path string) {
+		if hash, err := fileHash(path); err == nil {
+			if _, ok := idx[hash]; !ok {
+				idx[hash] = path
+			}
+		}
+	}
+
+	if snapshot.ReplacedDir != "" {
+		paths, _ := filepath.Glob(filepath.Join(snapshot.dir, "data", "pages", "*.jpg"))
+		for _, path := range paths {
+			if !isVariant(path) {
+				add(path)
+			}
+		}
+	}
+
+	probe := Newsletter{ValidFrom: config.ValidFrom, ValidUntil: config.ValidUntil}
+	for _, n := range newsletters.List() {
+		if n.Store != config.StoreName() || n.ID == id || !validityOverlaps(n, probe) {
+			continue
+		}
+		for _, page := range n.Pages {
+			if path, ok := localImagePath(page.ImageURL); ok {
+				add(path)
+			}
+		}
+	}
+	return idx
+}
+
+// linkUnchanged replaces a downloaded page with a hard link to an identical
+// page of an earlier version and returns that page's path, or "" when the
+// page changed. Links keep working when either version is deleted.
+func (idx pageIndex) linkUnchanged(path string) string {
+	hash, err := fileHash(path)
+	if err != nil {
+		return ""
+	}
+	prior, ok := idx[hash]
+	if !ok {
+		return ""
+	}
+	if !replaceWithLink(prior, path) {
+		return ""
+	}
+	return prior
+}
+
+// linkVariant links a size variant of an unchanged page from its earlier
+// version, reporting whether there was one to reuse. Variants are images
+// derived from the page and, like it, never change once written.
+func linkVariant(variant func(string) string, prior, path string) bool {
+	if prior == "" {
+		return false
+	}
+	if _, err := os.Stat(variant(prior)); err != nil {
+		return false
+	}
+	return replaceWithLink(variant(prior), variant(path))
+}
+
+// copySidecar copies the sidecar (tiles, products) of an unchanged page from
+// its earlier version, reporting whether there was one to reuse. Sidecars
+// are rewritten when a page is processed again, so each version gets its
+// own file rather than a link.
+func copySidecar(sidecar func(string) string, prior, path string) bool {
+	if prior == "" {
+		return false
+	}
+	data, err := os.ReadFile(sidecar(prior))
+	if err != nil {
+		return false
+	}
+	return replaceFile(sidecar(path), data, filePerm) == nil
+}
+
+// replaceWithLink atomically replaces dst with a hard link to src
+func replaceWithLink(src, dst string) bool {
+	tmp := dst + ".link"
+	os.Remove(tmp)
+	if err := os.Link(src, tmp); err != nil {
+		return false
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestReusedFilesStayPerVersion reuses the files of an unchanged page in a
+// new version, then processes the new version again; the earlier version
+// must keep its own files
+func TestReusedFilesStayPerVersion(t *testing.T) {
+	dir := t.TempDir()
+	prior := filepath.Join(dir, "v1", "page-001.jpg")
+	path := filepath.Join(dir, "v2", "page-001.jpg")
+	for _, p := range []string{prior, path} {
+		if err := os.MkdirAll(filepath.Dir(p), dirPerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeJPEG(prior, image.NewGray(image.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatal(err)
+	}
+	if err := generateVariants(prior); err != nil {
+		t.Fatal(err)
+	}
+	if err := savePageProducts(prior, []Product{{Name: "Lapte"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveTiles(prior, []Tile{{X: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyFile(prior, path); err != nil {
+		t.Fatal(err)
+	}
+
+	idx := pageIndex{}
+	hash, err := fileHash(prior)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx[hash] = prior
+	if idx.linkUnchanged(path) != prior {
+		t.Fatal("unchanged page not linked")
+	}
+	if err := storeVariants(path, prior); err != nil {
+		t.Fatal(err)
+	}
+	if !copySidecar(productsPath, prior, path) || !copySidecar(tilesPath, prior, path) {
+		t.Fatal("sidecars not reused")
+	}
+
+	snapshot := func() map[string]string {
+		files := map[string]string{}
+		for _, p := range []string{productsPath(prior), tilesPath(prior), variantPath(prior, SizeThumbnail)} {
+			data, err := os.ReadFile(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[p] = string(data)
+		}
+		return files
+	}
+	before := snapshot()
+
+	if err := savePageProducts(path, []Product{{Name: "Paine"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveTiles(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeJPEG(variantPath(path, SizeThumbnail), image.NewGray(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+
+	for p, data := range snapshot() {
+		if data != before[p] {
+			t.Errorf("%s changed when the other version was processed again", filepath.Base(p))
+		}
+	}
+}
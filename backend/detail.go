@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DetailPage is a page in GET /api/newsletters/{id}: only its number and
+// thumbnail, unless the client asked for more with ?include=
+type DetailPage struct {
+	PageNumber   int       `json:"pageNumber"`
+	ImageURL     string    `json:"imageUrl,omitempty"`
+	ThumbnailURL string    `json:"thumbnailUrl,omitempty"`
+	MediumURL    string    `json:"mediumUrl,omitempty"`
+	Products     []Product `json:"products,omitempty"`
+}
+
+// NewsletterDetail is the response of GET /api/newsletters/{id}; its pages
+// replace the full page list of the newsletter
+type NewsletterDetail struct {
+	Newsletter
+	Pages []DetailPage `json:"pages"`
+}
+
+// detailOptions are what a client asked GET /api/newsletters/{id} for
+type detailOptions struct {
+	pages    bool // every URL of the pages in range
+	products bool // the products extracted from the pages in range
+	from, to int  // page range, 0 when unbounded
+}
+
+// parseDetailOptions reads ?include=pages,products and ?pageRange=1-10
+func parseDetailOptions(r *http.Request) (detailOptions, error) {
+	var opts detailOptions
+	q := r.URL.Query()
+	if v := q.Get("include"); v != "" {
+		for _, part := range strings.Split(v, ",") {
+			switch strings.TrimSpace(part) {
+			case "pages":
+				opts.pages = true
+			case "products":
+				opts.products = true
+			default:
+				return opts, fmt.Errorf("Unknown include %q, expected pages or products", part)
+			}
+		}
+	}
+
+	v := q.Get("pageRange")
+	if v == "" {
+		return opts, nil
+	}
+	if !opts.pages && !opts.products {
+		return opts, fmt.Errorf("pageRange requires include=pages or include=products")
+	}
+	from, to, ranged := strings.Cut(v, "-")
+	first, err := strconv.Atoi(from)
+	last := first
+	if err == nil && ranged {
+		last, err = strconv.Atoi(to)
+	}
+	if err != nil || first < 1 || last < first {
+		return opts, fmt.Errorf("Invalid pageRange, expected N-M")
+	}
+	opts.from, opts.to = first, last
+	return opts, nil
+}
+
+// inRange reports whether a page number was asked for
+func (o detailOptions) inRange(page int) bool {
+	return o.from == 0 || (page >= o.from && page <= o.to)
+}
+
+// newsletterDetail builds the detail response of n. Every page is listed
+// by default with its thumbnail; asked-for details are added only to the
+// pages in range, and with a range only those pages are listed.
+func newsletterDetail(n Newsletter, opts detailOptions) NewsletterDetail {
+	d := NewsletterDetail{Newsletter: n, Pages: []DetailPage{}}
+	for _, page := range n.Pages {
+		if !opts.inRange(page.PageNumber) {
+			continue
+		}
+		p := DetailPage{PageNumber: page.PageNumber, ThumbnailURL: page.ThumbnailURL}
+		if opts.pages || page.ThumbnailURL == "" {
+			// Pages scraped before thumbnails existed only have the full image
+			p.ImageURL = page.ImageURL
+		}
+		if opts.pages {
+			p.MediumURL = page.MediumURL
+		}
+		if opts.products {
+			p.Products = []Product{}
+			for _, product := range loadPageProducts(page) {
+				product.NewsletterID, product.PageNumber = n.ID, page.PageNumber
+				p.Products = append(p.Products, product)
+			}
+		}
+		d.Pages = append(d.Pages, p)
+	}
+	return d
+}
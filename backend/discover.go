@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errNoCatalogLinks is returned when a list page has no links that look
+// like catalogs
+var errNoCatalogLinks = errors.New("no catalog links found")
+
+// catalogKeywords mark links to catalogs on Romanian and English store sites
+var catalogKeywords = []string{"catalog", "brosur", "broșur", "pliant", "revista", "flyer", "leaflet", "prospect", "oferte"}
+
+// discoverLinksJS lists the links of a catalog list page, each with the
+// structure around it: links in the same position of repeated cards share a
+// signature
+const discoverLinksJS = `
+	(() => {
+		const signature = el => {
+			const parts = [];
+			for (let e = el, i = 0; e && e !== document.body && i < 4; e = e.parentElement, i++) {
+				const classes = Array.from(e.classList).filter(c => !/\d/.test(c) && !/active|selected|current/i.test(c)).slice(0, 2);
+				parts.unshift(e.tagName.toLowerCase() + classes.map(c => '.' + c).join(''));
+			}
+			return parts.join(' > ');
+		};
+		const titleOf = a => {
+			const el = a.querySelector('h1, h2, h3, h4, h5, [class*="title" i], [class*="name" i]') ||
+				(a.parentElement && a.parentElement.querySelector('h1, h2, h3, h4, h5, [class*="title" i]'));
+			if (!el) return { text: '', selector: '' };
+			const cls = Array.from(el.classList).find(c => !/\d/.test(c));
+			return { text: (el.textContent || '').trim().replace(/\s+/g, ' ').slice(0, 200), selector: el.tagName.toLowerCase() + (cls ? '.' + cls : '') };
+		};
+		const links = [];
+		for (const a of document.querySelectorAll('a[href]')) {
+			if (!a.href.startsWith('http')) continue;
+			const title = titleOf(a);
+			links.push({
+				href: a.href,
+				text: ((a.textContent || '').trim().replace(/\s+/g, ' ') || a.title || a.getAttribute('aria-label') || '').slice(0, 200),
+				signature: signature(a),
+				titleText: title.text,
+				titleSelector: title.selector,
+				hasImage: !!a.querySelector('img'),
+			});
+		}
+		return { lang: document.documentElement.lang || '', links };
+	})()
+`
+
+// discoverViewerJS describes a catalog viewer: where it ended up, its links
+// to numbered pages, its large images and the page count it reports
+const discoverViewerJS = `
+	({
+		url: window.location.href,
+		pageLinks: Array.from(document.querySelectorAll('a[href]')).map(a => a.href).filter(h => /\/page\/\d+/.test(h)),
+		images: (` + galleryImagesJS + `).length,
+		schwarz: !!document.querySelector('img[src*="leaflets.schwarz"], img[srcset*="leaflets.schwarz"]'),
+		pageCount: ` + pageCountJS + `,
+	})
+`
+
+// discoveredLink is a link of a list page, see discoverLinksJS
+type discoveredLink struct {
+	Href          string `json:"href"`
+	Text          string `json:"text"`
+	Signature     string `json:"signature"`
+	TitleText     string `json:"titleText"`
+	TitleSelector string `json:"titleSelector"`
+	HasImage      bool   `json:"hasImage"`
+}
+
+// viewerInfo describes a catalog viewer, see discoverViewerJS
+type viewerInfo struct {
+	URL       string   `json:"url"`
+	PageLinks []string `json:"pageLinks"`
+	Images    int      `json:"images"`
+	Schwarz   bool     `json:"schwarz"`
+	PageCount int      `json:"pageCount"`
+}
+
+// DiscoveredCatalog is a catalog link found on a list page
+type DiscoveredCatalog struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+}
+
+// Discovery is a draft config for a new store, with what it was derived
+// from and what the operator still has to check
+type Discovery struct {
+	Config         ScraperConfig       `json:"config"`
+	Catalogs       []DiscoveredCatalog `json:"catalogs"`
+	TitleSelectors []string            `json:"titleSelectors"`
+	Notes          []string            `json:"notes"`
+}
+
+// hasCatalogKeyword reports whether text mentions a catalog
+func hasCatalogKeyword(text string) bool {
+	text = strings.ToLower(text)
+	for _, k := range catalogKeywords {
+		if strings.Contains(text, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// catalogLinks picks the links most likely to be the catalogs: among the
+// groups of links sharing a signature, the one scoring best on catalog
+// keywords, images and size. Single links only qualify by keyword.
+func catalogLinks(listURL string, links []discoveredLink) []discoveredLink {
+	groups := map[string][]discoveredLink{}
+	seen := map[string]bool{}
+	for _, l := range links {
+		u, err := url.Parse(l.Href)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		u.Fragment = ""
+		l.Href = u.String()
+		// Cards often link twice, from the image and from the title
+		if l.Href == listURL || seen[l.Signature+" "+l.Href] {
+			continue
+		}
+		seen[l.Signature+" "+l.Href] = true
+		groups[l.Signature] = append(groups[l.Signature], l)
+	}
+
+	signatures := make([]string, 0, len(groups))
+	for s := range groups {
+		signatures = append(signatures, s)
+	}
+	sort.Strings(signatures)
+
+	var best []discoveredLink
+	bestScore := 0
+	for _, s := range signatures {
+		group := groups[s]
+		score := 0
+		for _, l := range group {
+			if hasCatalogKeyword(l.Href + " " + l.Text + " " + l.TitleText) {
+				score += 3
+			}
+			if l.HasImage {
+				score++
+			}
+		}
+		if score < 3 {
+			continue
+		}
+		if score += len(group); score > bestScore {
+			best, bestScore = group, score
+		}
+	}
+	return best
+}
+
+var digitsRe = regexp.MustCompile(`\d+`)
+
+// linkPattern builds a regular expression matching the catalog links, for
+// the canary: their common prefix up to a slash, then anything, then their
+// common ending with numbers generalized
+func linkPattern(hrefs []string) string {
+	prefix := hrefs[0]
+	for _, h := range hrefs[1:] {
+		for !strings.HasPrefix(h, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	prefix = prefix[:strings.LastIndex(prefix, "/")+1]
+
+	var rests []string
+	for _, h := range hrefs {
+		rests = append(rests, digitsRe.ReplaceAllString(strings.TrimPrefix(h, prefix), "#"))
+	}
+	suffix := rests[0]
+	for _, r := range rests[1:] {
+		for !strings.HasSuffix(r, suffix) {
+			suffix = suffix[1:]
+		}
+	}
+	// Keep whole path segments, and leave something for the wildcard
+	if i := strings.Index(suffix, "/"); i >= 0 {
+		suffix = suffix[i:]
+	} else {
+		suffix = ""
+	}
+	for _, r := range rests {
+		if len(suffix) >= len(r) {
+			suffix = ""
+		}
+	}
+
+	pattern := "^" + regexp.QuoteMeta(prefix) + ".+"
+	if suffix != "" {
+		pattern += strings.ReplaceAll(regexp.QuoteMeta(suffix), "#", `\d+`) + "$"
+	}
+	return pattern
+}
+
+// validityRe finds validity periods such as "09.02 - 15.02.2026" or the
+// "09-02-15-02-2026" of a URL slug
+var validityRe = regexp.MustCompile(`(\d{1,2})[./-](\d{1,2})(?:[./-](\d{4}))?\s*(?:-|–|—|pana la|până la)?\s*(\d{1,2})[./-](\d{1,2})[./-](\d{4})`)
+
+// parseValidity reads a validity period from a catalog title or URL
+func parseValidity(text string) (time.Time, time.Time, bool) {
+	for _, m := range validityRe.FindAllStringSubmatch(text, -1) {
+		until, err := time.Parse("2-1-2006", m[4]+"-"+m[5]+"-"+m[6])
+		if err != nil {
+			continue
+		}
+		year := m[3]
+		if year == "" {
+			year = m[6]
+			// A catalog from late December to early January
+			if month, _ := strconv.Atoi(m[2]); month > int(until.Month()) {
+				year = strconv.Itoa(until.Year() - 1)
+			}
+		}
+		from, err := time.Parse("2-1-2006", m[1]+"-"+m[2]+"-"+year)
+		if err != nil || from.After(until) {
+			continue
+		}
+		return from, until, true
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// storeFromHost derives a store name from a site, e.g. penny from
+// www.penny.ro
+func storeFromHost(host string) string {
+	labels := strings.Split(strings.ToLower(host), ".")
+	name := labels[0]
+	if len(labels) >= 2 {
+		name = labels[len(labels)-2]
+	}
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return -1
+	}, name)
+}
+
+// titleSelectors lists the title selectors of the catalog links, most
+// common first
+func titleSelectors(links []discoveredLink) []string {
+	counts := map[string]int{}
+	for _, l := range links {
+		if l.TitleSelector != "" {
+			counts[l.TitleSelector]++
+		}
+	}
+	selectors := make([]string, 0, len(counts))
+	for s := range counts {
+		selectors = append(selectors, s)
+	}
+	sort.Slice(selectors, func(i, j int) bool {
+		if counts[selectors[i]] != counts[selectors[j]] {
+			return counts[selectors[i]] > counts[selectors[j]]
+		}
+		return selectors[i] < selectors[j]
+	})
+	return selectors
+}
+
+// discoverStore loads a store's catalog list page, finds its catalog links
+// and opens the first catalog to draft a scraper config for it
+func discoverStore(ctx context.Context, listURL, store string) (*Discovery, error) {
+	discoverCtx, cancel := context.WithTimeout(ctx, 90*time.Second)
+	defer cancel()
+	browserCtx, cancelBrowser := newBrowserContext(discoverCtx)
+	defer cancelBrowser()
+
+	var page struct {
+		Lang  string           `json:"lang"`
+		Links []discoveredLink `json:"links"`
+	}
+	if err := evaluateOnPage(browserCtx, listURL, discoverLinksJS, &page); err != nil {
+		return nil, fmt.Errorf("failed to load %s: %v", listURL, err)
+	}
+	links := catalogLinks(listURL, page.Links)
+	if len(links) == 0 {
+		return nil, errNoCatalogLinks
+	}
+
+	d := &Discovery{Catalogs: []DiscoveredCatalog{}, TitleSelectors: titleSelectors(links), Notes: []string{}}
+	hrefs := []string{}
+	for _, l := range links {
+		title := l.TitleText
+		if title == "" {
+			title = l.Text
+		}
+		d.Catalogs = append(d.Catalogs, DiscoveredCatalog{URL: l.Href, Title: title})
+		hrefs = append(hrefs, l.Href)
+	}
+
+	if store == "" {
+		u, _ := url.Parse(listURL)
+		store = storeFromHost(u.Hostname())
+	}
+	first := d.Catalogs[0]
+	c := &d.Config
+	c.Store = store
+	c.Title = first.Title
+	if lang := page.Lang; strings.Contains(lang, "-") {
+		c.Locale = lang
+	}
+	c.Canary = &CanaryConfig{ListPage: listURL, LinkPattern: linkPattern(hrefs), ExpectedMin: 1}
+
+	c.ID = store + "-catalog"
+	if from, until, ok := parseValidity(first.Title + " " + first.URL); ok {
+		c.ValidFrom, c.ValidUntil = from.Format("2006-01-02"), until.Format("2006-01-02")
+		c.ID = fmt.Sprintf("%s-%s-%s", store, from.Format("02-01"), until.Format("02-01-2006"))
+	} else {
+		d.Notes = append(d.Notes, "No validity period found in the catalog title or URL; set valid_from, valid_until and a dated id")
+	}
+
+	if strings.HasSuffix(strings.ToLower(strings.SplitN(first.URL, "?", 2)[0]), ".pdf") {
+		c.Strategy = StrategyPDF
+		c.FirstPage = listURL
+		c.PDF = &PDFConfig{URL: first.URL}
+	} else {
+		var viewer viewerInfo
+		if err := evaluateOnPage(browserCtx, first.URL, discoverViewerJS, &viewer); err != nil {
+			return nil, fmt.Errorf("failed to load catalog %s: %v", first.URL, err)
+		}
+		draftViewer(d, viewer)
+	}
+
+	if strategy, err := c.strategy(); err == nil {
+		if err := strategy.Check(c); err != nil {
+			d.Notes = append(d.Notes, "The draft is incomplete: "+err.Error())
+		}
+	}
+	d.Notes = append(d.Notes, fmt.Sprintf("Check the draft with a scrape, then save it as %s.json; the canary expects at least %d catalog link", c.ID, c.Canary.ExpectedMin))
+	return d, nil
+}
+
+// draftViewer fills in how the catalog's pages are found from its viewer:
+// numbered page URLs make a page-by-page config, several large images on
+// one page a gallery
+func draftViewer(d *Discovery, viewer viewerInfo) {
+	c := &d.Config
+	switch {
+	case pageNumberRe.MatchString(viewer.URL):
+		c.FirstPage = buildPageURL(viewer.URL, 1)
+	case len(viewer.PageLinks) > 0:
+		c.FirstPage = buildPageURL(viewer.PageLinks[0], 1)
+	case viewer.Images > 1:
+		c.Strategy = StrategyGallery
+		c.FirstPage = viewer.URL
+		d.Notes = append(d.Notes, fmt.Sprintf("The viewer shows %d large images on one page, so the draft uses the gallery strategy", viewer.Images))
+	default:
+		c.FirstPage = viewer.URL
+		d.Notes = append(d.Notes, "No page URLs like .../page/1 found; set first_page to page 1 of the viewer, or use the api strategy if the viewer loads its pages from an API")
+	}
+
+	if c.Strategy == "" && viewer.PageCount > 0 {
+		c.LastPage = buildPageURL(c.FirstPage, viewer.PageCount)
+		d.Notes = append(d.Notes, fmt.Sprintf("The viewer reports %d pages", viewer.PageCount))
+	}
+	if viewer.Schwarz {
+		c.Extractor = ExtractorSchwarz
+	}
+}
+
+// discoverRequest is the body of POST /api/stores/discover
+type discoverRequest struct {
+	URL   string `json:"url"`
+	Store string `json:"store"`
+}
+
+var storeNameRe = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// Validate checks the list page URL and the optional store name
+func (req *discoverRequest) Validate() *ValidationError {
+	req.URL = strings.TrimSpace(req.URL)
+	if req.URL == "" {
+		return fieldError("url", "is required")
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fieldError("url", "must be an absolute http or https URL")
+	}
+	if req.Store != "" && !storeNameRe.MatchString(req.Store) {
+		return fieldError("store", "must be lowercase letters and digits")
+	}
+	return nil
+}
+
+// API Handlers
+
+func discoverStoreHandler(w http.ResponseWriter, r *http.Request) {
+	var req discoverRequest
+	if err := decodeJSONBody(w, r, &req); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	d, err := discoverStore(r.Context(), req.URL, req.Store)
+	if errors.Is(err, errNoCatalogLinks) {
+		http.Error(w, "No catalog links found on the page", http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		logFrom(r.Context()).Error("failed to discover store", "url", req.URL, "err", err)
+		http.Error(w, "Error loading the catalog list page", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
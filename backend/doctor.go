@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// doctorCheck is one line of the doctor report
+type doctorCheck struct {
+	Name   string
+	Err    error
+	Detail string
+}
+
+// checkDataDir verifies that the data directory can be written
+func checkDataDir() doctorCheck {
+	c := doctorCheck{Name: "data directory"}
+	if err := os.MkdirAll(newslettersDir, dirPerm); err != nil {
+		c.Err = err
+		return c
+	}
+	f, err := os.CreateTemp(newslettersDir, ".doctor-*")
+	if err != nil {
+		c.Err = err
+		return c
+	}
+	f.Close()
+	os.Remove(f.Name())
+	abs, _ := filepath.Abs(newslettersDir)
+	c.Detail = abs + " is writable"
+	return c
+}
+
+// checkConfig verifies that a config loads, that its scripts pass the
+// allowlist and that it has what its scraper strategy needs
+func checkConfig(name string) (doctorCheck, *ScraperConfig) {
+	c := doctorCheck{Name: "config " + name}
+	config, err := LoadScraperConfig(configFile(name))
+	if err != nil {
+		c.Err = err
+		return c, nil
+	}
+	if _, err := config.NewsletterID(); err != nil {
+		c.Err = err
+		return c, nil
+	}
+	if config.Schedule != "" {
+		if _, err := ParseSchedule(config.Schedule); err != nil {
+			c.Err = fmt.Errorf("schedule: %v", err)
+			return c, nil
+		}
+	}
+	if err := config.Scripts.Check(); err != nil {
+		c.Err = err
+		return c, nil
+	}
+	if _, err := config.imageScript(); err != nil {
+		c.Err = err
+		return c, nil
+	}
+	strategy, err := config.strategy()
+	if err == nil {
+		err = strategy.Check(config)
+	}
+	if err != nil {
+		c.Err = err
+		return c, nil
+	}
+	if _, ok := strategy.(PageByPage); !ok {
+		c.Detail = "strategy " + config.Strategy
+		return c, config
+	}
+
+	first, _ := extractPageNumber(config.FirstPage)
+	switch s := config.Scripts; {
+	case s != nil && (s.ImageURLs != "" || s.PageCount != ""):
+		c.Detail = fmt.Sprintf("pages from %d, counted by script", first)
+	case config.LastPage == "":
+		c.Detail = fmt.Sprintf("pages from %d, counted by the viewer", first)
+	default:
+		last, _ := extractPageNumber(config.LastPage)
+		c.Detail = fmt.Sprintf("pages %d-%d", first, last)
+	}
+	return c, config
+}
+
+// checkReachable verifies that a store's site answers from this machine
+func checkReachable(client *http.Client, config *ScraperConfig) doctorCheck {
+	target := config.FirstPage
+	if config.API != nil && config.API.URL != "" {
+		target = config.API.URL
+	}
+	if config.PDF != nil && config.PDF.URL != "" {
+		target = config.PDF.URL
+	}
+	if config.Canary != nil && config.Canary.ListPage != "" {
+		target = config.Canary.ListPage
+	}
+	c := doctorCheck{Name: "network " + config.StoreName()}
+	if u, err := url.Parse(target); err == nil {
+		c.Name += " (" + u.Host + ")"
+	}
+
+	started := time.Now()
+	resp, err := client.Get(target)
+	if err != nil {
+		c.Err = err
+		return c
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		c.Err = fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+		return c
+	}
+	c.Detail = fmt.Sprintf("HTTP %d in %s", resp.StatusCode, time.Since(started).Round(time.Millisecond))
+	return c
+}
+
+// checkOCR verifies that the OCR engine product extraction needs is installed
+func checkOCR(engine OCREngine) doctorCheck {
+	c := doctorCheck{Name: "ocr"}
+	switch e := engine.(type) {
+	case nil:
+		c.Err = fmt.Errorf("extract_products is set but OCR_PROVIDER is none")
+	case TesseractOCR:
+		if path, err := exec.LookPath(e.Binary); err != nil {
+			c.Err = err
+		} else {
+			c.Detail = fmt.Sprintf("%s (language %s)", path, e.Language)
+		}
+	default:
+		c.Detail = fmt.Sprintf("%T", e)
+	}
+	return c
+}
+
+// checkPDFTools verifies that the poppler tools PDF catalogs need are installed
+func checkPDFTools() doctorCheck {
+	c := doctorCheck{Name: "pdf"}
+	var paths []string
+	for _, binary := range []string{"pdfinfo", "pdftoppm"} {
+		path, err := exec.LookPath(binary)
+		if err != nil {
+			c.Err = err
+			return c
+		}
+		paths = append(paths, path)
+	}
+	c.Detail = strings.Join(paths, ", ")
+	return c
+}
+
+// runDoctor checks everything a scrape depends on and prints a report, so
+// "why does scraping return nothing" can be answered without reading logs
+func runDoctor() error {
+	checks := []doctorCheck{checkDataDir()}
+
+	var err error
+	if optOuts, err = LoadOptOutRegistry(optOutsFile); err != nil {
+		checks = append(checks, doctorCheck{Name: "opt-outs", Err: err})
+	}
+
+	configs, err := ListAvailableConfigs()
+	if err != nil {
+		checks = append(checks, doctorCheck{Name: "configs", Err: err})
+	} else if len(configs) == 0 {
+		checks = append(checks, doctorCheck{Name: "configs", Err: fmt.Errorf("no configs in %s", serverConfig.ConfigDir)})
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	checked := map[string]bool{}
+	needsOCR := false
+	needsPDF := false
+	for _, name := range configs {
+		c, config := checkConfig(name)
+		checks = append(checks, c)
+		if config != nil && config.ExtractProducts {
+			needsOCR = true
+		}
+		if config != nil && config.Strategy == StrategyPDF {
+			needsPDF = true
+		}
+		if config == nil || checked[config.StoreName()] {
+			continue
+		}
+		checked[config.StoreName()] = true
+		if optOuts.IsOptedOut(config.StoreName()) {
+			checks = append(checks, doctorCheck{Name: "store " + config.StoreName(), Err: fmt.Errorf("opted out of archiving")})
+			continue
+		}
+		checks = append(checks, checkReachable(client, config))
+	}
+
+	chrome := doctorCheck{Name: "chrome", Detail: "headless Chrome starts"}
+	chrome.Err = startChromeOnce()
+	checks = append(checks, chrome)
+
+	if needsOCR {
+		checks = append(checks, checkOCR(NewOCREngine()))
+	}
+	if needsPDF {
+		checks = append(checks, checkPDFTools())
+	}
+
+	return reportChecks(checks)
+}
+
+// reportChecks prints one line per check and fails if any check did
+func reportChecks(checks []doctorCheck) error {
+	failed := 0
+	for _, c := range checks {
+		if c.Err != nil {
+			failed++
+			fmt.Printf("[FAIL] %s: %v\n", c.Name, c.Err)
+		} else {
+			fmt.Printf("[ OK ] %s: %s\n", c.Name, c.Detail)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
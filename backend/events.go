@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Domain event types
+const (
+	EventNewsletterCreated = "newsletter.created"
+	EventNewsletterUpdated = "newsletter.updated"
+	EventNewsletterDeleted = "newsletter.deleted"
+)
+
+const outboxRetryInterval = 30 * time.Second
+
+var outboxFile = dataPath("outbox.json")
+
+// Event is a domain event waiting in the outbox
+type Event struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Subject   string          `json:"subject"`
+	Version   time.Time       `json:"version"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"createdAt"`
+	// Delivered lists the handlers that already processed the event, so a
+	// retry only goes to the ones that failed
+	Delivered map[string]bool `json:"delivered"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"lastError,omitempty"`
+}
+
+// EventHandler consumes domain events. Delivery is at-least-once, so
+// handlers must be idempotent on Event.ID.
+type EventHandler interface {
+	Name() string
+	Handle(Event) error
+}
+
+// Outbox persists domain events before the change they describe is saved and
+// delivers them to every handler until each one succeeded, so events survive
+// crashes instead of being lost with a fire-and-forget goroutine
+type Outbox struct {
+	mu       sync.Mutex
+	path     string
+	pending  []Event
+	handlers []EventHandler
+	wake     chan struct{}
+	// unsettled holds the IDs of events whose change is still being saved;
+	// dispatch leaves them alone until Settle
+	unsettled map[string]bool
+}
+
+var outbox *Outbox
+
+// LoadOutbox reads undelivered events from path
+func LoadOutbox(path string) (*Outbox, error) {
+	o := &Outbox{path: path, wake: make(chan struct{}, 1), unsettled: make(map[string]bool)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &o.pending); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Subscribe registers a handler; call before Start
+func (o *Outbox) Subscribe(h EventHandler) {
+	o.mu.Lock()
+	o.handlers = append(o.handlers, h)
+	o.mu.Unlock()
+}
+
+// save writes pending events to disk; the caller must hold mu
+func (o *Outbox) save() error {
+	data, err := json.MarshalIndent(o.pending, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := o.path + ".tmp"
+	if err := os.WriteFile(tmp, data, filePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, o.path)
+}
+
+// Add durably records an event about subject at version and returns its
+// ID. It must be called before the change itself is saved, and Settle
+// after; until then the event isn't delivered.
+func (o *Outbox) Add(eventType, subject string, version time.Time, payload interface{}) (string, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	id, err := randomHex(12)
+	if err != nil {
+		return "", err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.pending = append(o.pending, Event{
+		ID:        id,
+		Type:      eventType,
+		Subject:   subject,
+		Version:   version,
+		Payload:   body,
+		CreatedAt: time.Now(),
+		Delivered: map[string]bool{},
+	})
+	if err := o.save(); err != nil {
+		o.pending = o.pending[:len(o.pending)-1]
+		return "", err
+	}
+	o.unsettled[id] = true
+	return id, nil
+}
+
+// Settle reports whether the change behind event id was saved. A saved
+// change wakes the dispatcher; the event of a failed one is dropped.
+func (o *Outbox) Settle(id string, saved bool) {
+	o.mu.Lock()
+	delete(o.unsettled, id)
+	if !saved {
+		for i, e := range o.pending {
+			if e.ID == id {
+				o.pending = append(o.pending[:i], o.pending[i+1:]...)
+				break
+			}
+		}
+		if err := o.save(); err != nil {
+			slog.Warn("failed to save outbox", "err", err)
+		}
+	}
+	o.mu.Unlock()
+
+	if saved {
+		select {
+		case o.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Pending returns a copy of the undelivered events
+func (o *Outbox) Pending() []Event {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Event{}, o.pending...)
+}
+
+// committed reports whether the change an event describes was saved. An
+// event written before a crash that prevented the save, or superseded by a
+// newer change to the same newsletter, has no matching record; a deletion
+// is saved when the newsletter is gone. Only settled events are checked:
+// before Settle the change may not be saved yet.
+func committed(e Event) bool {
+	n, ok := newsletters.Get(e.Subject)
+	if e.Type == EventNewsletterDeleted {
+		return !ok
+	}
+	return ok && n.LastUpdated.Equal(e.Version)
+}
+
+// dispatch delivers pending events once
+func (o *Outbox) dispatch() {
+	o.mu.Lock()
+	events := make([]Event, 0, len(o.pending))
+	for _, e := range o.pending {
+		if !o.unsettled[e.ID] {
+			events = append(events, e)
+		}
+	}
+	handlers := append([]EventHandler{}, o.handlers...)
+	o.mu.Unlock()
+
+	done := map[string]bool{}
+	updates := map[string]Event{}
+	for _, e := range events {
+		if !committed(e) {
+			slog.Info("dropping event, change not saved or superseded", "event", e.ID, "type", e.Type, "subject", e.Subject)
+			done[e.ID] = true
+			continue
+		}
+
+		e.Delivered = copyDelivered(e.Delivered)
+		e.LastError = ""
+		for _, h := range handlers {
+			if e.Delivered[h.Name()] {
+				continue
+			}
+			if err := h.Handle(e); err != nil {
+				e.LastError = h.Name() + ": " + err.Error()
+				continue
+			}
+			e.Delivered[h.Name()] = true
+		}
+		e.Attempts++
+
+		if e.LastError == "" {
+			done[e.ID] = true
+		} else {
+			slog.Warn("event delivery failed, will retry", "event", e.ID, "err", e.LastError)
+			updates[e.ID] = e
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	remaining := o.pending[:0]
+	for _, e := range o.pending {
+		if done[e.ID] {
+			continue
+		}
+		if u, ok := updates[e.ID]; ok {
+			e = u
+		}
+		remaining = append(remaining, e)
+	}
+	o.pending = remaining
+	if err := o.save(); err != nil {
+		slog.Warn("failed to save outbox", "err", err)
+	}
+}
+
+func copyDelivered(m map[string]bool) map[string]bool {
+	c := make(map[string]bool, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// Start runs the dispatcher: on every Settle and periodically to retry
+// failed deliveries, including those left over from before a restart
+func (o *Outbox) Start() {
+	go func() {
+		ticker := time.NewTicker(outboxRetryInterval)
+		defer ticker.Stop()
+
+		o.dispatch()
+		for {
+			select {
+			case <-o.wake:
+			case <-ticker.C:
+			}
+			o.dispatch()
+		}
+	}()
+}
+
+// logEventHandler writes every event to the server log
+type logEventHandler struct{}
+
+func (logEventHandler) Name() string { return "log" }
+
+func (logEventHandler) Handle(e Event) error {
+	slog.Info("event", "event", e.ID, "type", e.Type, "subject", e.Subject)
+	return nil
+}
+
+// API Handlers
+
+func getOutbox(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(outbox.Pending())
+}
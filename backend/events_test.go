@@ -0,0 +1,117 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// recordingHandler remembers the IDs of the events it handled
+type recordingHandler struct{ handled []string }
+
+func (h *recordingHandler) Name() string { return "recording" }
+
+func (h *recordingHandler) Handle(e Event) error {
+	h.handled = append(h.handled, e.ID)
+	return nil
+}
+
+// TestOutboxHoldsUnsettledEvents dispatches between Add and the save of the
+// change, which must neither deliver nor drop the event
+func TestOutboxHoldsUnsettledEvents(t *testing.T) {
+	o, err := LoadOutbox(filepath.Join(t.TempDir(), "outbox.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &recordingHandler{}
+	o.Subscribe(h)
+
+	n := Newsletter{ID: "outbox-test", Store: "Lidl", LastUpdated: time.Now().UTC()}
+	withNewsletters(t, nil)
+	id, err := o.Add(EventNewsletterCreated, n.ID, n.LastUpdated, newsletterEventPayload(n))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o.dispatch()
+	if len(h.handled) != 0 || len(o.Pending()) != 1 {
+		t.Fatalf("unsettled event handled %v, pending %d; want held back", h.handled, len(o.Pending()))
+	}
+
+	newsletters.load([]Newsletter{n})
+	o.Settle(id, true)
+	o.dispatch()
+	if len(h.handled) != 1 || h.handled[0] != id || len(o.Pending()) != 0 {
+		t.Fatalf("settled event handled %v, pending %d; want delivered once", h.handled, len(o.Pending()))
+	}
+
+	failed, err := o.Add(EventNewsletterUpdated, n.ID, n.LastUpdated.Add(time.Second), newsletterEventPayload(n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.Settle(failed, false)
+	if len(o.Pending()) != 0 {
+		t.Fatalf("event of a failed save still pending")
+	}
+}
+
+func TestCommittedDeletion(t *testing.T) {
+	n := Newsletter{ID: "deleted-test", Store: "Lidl", LastUpdated: time.Now().UTC()}
+	deleted := Event{Type: EventNewsletterDeleted, Subject: n.ID, Version: n.LastUpdated}
+
+	withNewsletters(t, []Newsletter{n})
+	if committed(deleted) {
+		t.Errorf("deletion of a stored newsletter counted as saved")
+	}
+	newsletters.load(nil)
+	if !committed(deleted) {
+		t.Errorf("deletion of a removed newsletter not counted as saved")
+	}
+}
+
+// TestReplaceStoreNewslettersEvents replaces a store's newsletters and
+// expects one event per newsletter removed, added or changed
+func TestReplaceStoreNewslettersEvents(t *testing.T) {
+	o, err := LoadOutbox(filepath.Join(t.TempDir(), "outbox.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(saved *Outbox) { outbox = saved }(outbox)
+	outbox = o
+
+	now := time.Now().UTC()
+	kept := Newsletter{ID: "lidl-kept", Store: "lidl", LastUpdated: now}
+	changed := Newsletter{ID: "lidl-changed", Store: "lidl", LastUpdated: now}
+	removed := Newsletter{ID: "lidl-removed", Store: "lidl", LastUpdated: now}
+	other := Newsletter{ID: "penny-other", Store: "penny", LastUpdated: now}
+	withNewsletters(t, []Newsletter{kept, changed, removed, other})
+
+	changed.LastUpdated = now.Add(-time.Hour)
+	added := Newsletter{ID: "lidl-added", Store: "lidl", LastUpdated: now}
+	if err := replaceStoreNewsletters("lidl", []Newsletter{kept, changed, added}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{}
+	for _, e := range o.Pending() {
+		got[e.Subject] = e.Type
+	}
+	want := map[string]string{
+		"lidl-changed": EventNewsletterUpdated,
+		"lidl-added":   EventNewsletterCreated,
+		"lidl-removed": EventNewsletterDeleted,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("events %v, want %v", got, want)
+	}
+	for subject, eventType := range want {
+		if got[subject] != eventType {
+			t.Errorf("event of %s is %q, want %q", subject, got[subject], eventType)
+		}
+	}
+	for _, e := range o.Pending() {
+		if !committed(e) {
+			t.Errorf("%s event of %s doesn't count as saved", e.Type, e.Subject)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// OfferRow is one extracted offer in an export. Columns are only appended,
+// so analytics queries keep working across versions.
+type OfferRow struct {
+	Store        string  `parquet:"store"`
+	NewsletterID string  `parquet:"newsletter_id"`
+	Title        string  `parquet:"title"`
+	ValidFrom    string  `parquet:"valid_from"`
+	ValidUntil   string  `parquet:"valid_until"`
+	PageNumber   int32   `parquet:"page_number"`
+	Product      string  `parquet:"product"`
+	ProductKey   string  `parquet:"product_key"`
+	Price        float64 `parquet:"price"`
+	UnitPrice    float64 `parquet:"unit_price"`
+	Currency     string  `parquet:"currency"`
+	PromoType    string  `parquet:"promo_type"`
+	Unit         string  `parquet:"unit"`
+	Quantity     int32   `parquet:"quantity"`
+	Discount     float64 `parquet:"discount"`
+	Free         int32   `parquet:"free"`
+	MinQuantity  int32   `parquet:"min_quantity"`
+	Review       string  `parquet:"review"` // review state of a flagged price, empty when not flagged
+}
+
+// offerColumns is the CSV header, in the order of OfferRow
+var offerColumns = []string{
+	"store", "newsletter_id", "title", "valid_from", "valid_until", "page_number",
+	"product", "product_key", "price", "unit_price", "currency", "promo_type",
+	"unit", "quantity", "discount", "free", "min_quantity", "review",
+}
+
+// record formats the row for CSV
+func (o OfferRow) record() []string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	i := func(v int32) string { return strconv.Itoa(int(v)) }
+	return []string{
+		o.Store, o.NewsletterID, o.Title, o.ValidFrom, o.ValidUntil, i(o.PageNumber),
+		o.Product, o.ProductKey, f(o.Price), f(o.UnitPrice), o.Currency, o.PromoType,
+		o.Unit, i(o.Quantity), f(o.Discount), i(o.Free), i(o.MinQuantity), o.Review,
+	}
+}
+
+// OfferFilter limits an export to a store and to catalogs valid between From
+// and To (YYYY-MM-DD, both optional)
+type OfferFilter struct {
+	Store    string
+	From, To string
+}
+
+// matches reports whether the offers of n belong in the export
+func (f OfferFilter) matches(n Newsletter) bool {
+	if f.Store != "" && !strings.EqualFold(n.Store, f.Store) {
+		return false
+	}
+	if f.From != "" && n.ValidUntil != "" && n.ValidUntil < f.From {
+		return false
+	}
+	return f.To == "" || n.ValidFrom == "" || n.ValidFrom <= f.To
+}
+
+// offerRows lists the extracted offers of every canonical newsletter,
+// expired ones included, oldest catalog first, which makes them the price
+// history of each product
+func offerRows(list []Newsletter, filter OfferFilter) []OfferRow {
+	canonical := withoutSuperseded(list)
+	sort.SliceStable(canonical, func(i, j int) bool {
+		if canonical[i].ValidFrom != canonical[j].ValidFrom {
+			return canonical[i].ValidFrom < canonical[j].ValidFrom
+		}
+		return canonical[i].ID < canonical[j].ID
+	})
+
+	rows := []OfferRow{}
+	for _, n := range canonical {
+		if !filter.matches(n) {
+			continue
+		}
+		for _, page := range n.Pages {
+			for _, p := range loadPageProducts(page) {
+				review := ""
+				if p.Anomaly != nil {
+					review = p.Anomaly.Review
+				}
+				rows = append(rows, OfferRow{
+					Store:        n.Store,
+					NewsletterID: n.ID,
+					Title:        n.Title,
+					ValidFrom:    n.ValidFrom,
+					ValidUntil:   n.ValidUntil,
+					PageNumber:   int32(page.PageNumber),
+					Product:      p.Name,
+					ProductKey:   productKey(p.Name),
+					Price:        p.Price.Price,
+					UnitPrice:    p.Price.EffectiveUnitPrice(p.Price.Price),
+					Currency:     p.Price.Currency,
+					PromoType:    string(p.Price.PromoType),
+					Unit:         p.Price.Unit,
+					Quantity:     int32(p.Price.Quantity),
+					Discount:     p.Price.Discount,
+					Free:         int32(p.Price.Free),
+					MinQuantity:  int32(p.Price.MinQuantity),
+					Review:       review,
+				})
+			}
+		}
+	}
+	return rows
+}
+
+// writeOffersParquet writes rows as a Parquet file
+func writeOffersParquet(w io.Writer, rows []OfferRow) error {
+	pw := parquet.NewGenericWriter[OfferRow](w)
+	if _, err := pw.Write(rows); err != nil {
+		return err
+	}
+	return pw.Close()
+}
+
+// writeOffersCSV writes rows as CSV with a header
+func writeOffersCSV(w io.Writer, rows []OfferRow) error {
+	cw := csv.NewWriter(w)
+	cw.Write(offerColumns)
+	for _, row := range rows {
+		cw.Write(row.record())
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// API Handlers
+
+func exportOffers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := OfferFilter{Store: q.Get("store"), From: q.Get("from"), To: q.Get("to")}
+	for _, day := range []string{filter.From, filter.To} {
+		if day == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", day); err != nil {
+			http.Error(w, "Invalid from or to, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+
+	format := q.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	var contentType string
+	var write func(io.Writer, []OfferRow) error
+	switch format {
+	case "csv":
+		contentType, write = "text/csv; charset=utf-8", writeOffersCSV
+	case "parquet":
+		contentType, write = "application/vnd.apache.parquet", writeOffersParquet
+	default:
+		http.Error(w, "Invalid format, expected csv or parquet", http.StatusBadRequest)
+		return
+	}
+
+	rows := offerRows(newsletters.List(), filter)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="offers-%s.%s"`, time.Now().Format("2006-01-02"), format))
+	if err := write(w, rows); err != nil {
+		logFrom(r.Context()).Error("failed to export offers", "err", err)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import "fmt"
+
+// Page image extractors, selected by extractor in a scraper config
+const (
+	// ExtractorGeneric takes the largest image on the page (the default)
+	ExtractorGeneric = "generic"
+	// ExtractorSchwarz reads the leaflets.schwarz viewer that Lidl and
+	// Kaufland share, falling back to the generic extractor
+	ExtractorSchwarz = "schwarz"
+)
+
+// genericImageJS finds the catalog image: the largest image on the page,
+// or else the first match of selectors common in catalog viewers
+const genericImageJS = `
+	(() => {
+		// First, try to find images by size (catalog images are usually large)
+		const allImages = Array.from(document.querySelectorAll('img'));
+		
+		// Filter out small images (icons, logos, etc) and get the largest
+		const largeImages = allImages.filter(img => {
+			const width = img.naturalWidth || img.width || 0;
+			const height = img.naturalHeight || img.height || 0;
+			return width > 500 && height > 500;
+		});
+		
+		if (largeImages.length > 0) {
+			// Sort by size and get the largest
+			largeImages.sort((a, b) => {
+				const sizeA = (a.naturalWidth || a.width) * (a.naturalHeight || a.height);
+				const sizeB = (b.naturalWidth || b.width) * (b.naturalHeight || b.height);
+				return sizeB - sizeA;
+			});
+			return largeImages[0].src;
+		}
+		
+		// Fallback: try specific selectors
+		const selectors = [
+			'img.flyer-image',
+			'img[class*="flyer"]',
+			'img[class*="catalog"]',
+			'div.flyer-container img',
+			'div[class*="flyer"] img',
+			'div[class*="catalog"] img',
+			'main img',
+			'article img'
+		];
+		
+		for (const selector of selectors) {
+			try {
+				const img = document.querySelector(selector);
+				if (img && img.src && !img.src.includes('.svg')) {
+					return img.src;
+				}
+			} catch (e) {}
+		}
+		return '';
+	})()
+`
+
+// schwarzImageJS picks the page among the images served by the Schwarz
+// group's imgproxy, taking the largest size offered in srcset
+const schwarzImageJS = `
+	(() => {
+		const src = img => img.currentSrc || img.src || '';
+		const pages = Array.from(document.querySelectorAll('img'))
+			.filter(img => src(img).includes('leaflets.schwarz'));
+
+		if (pages.length > 0) {
+			pages.sort((a, b) => (b.naturalWidth * b.naturalHeight) - (a.naturalWidth * a.naturalHeight));
+			const page = pages[0];
+
+			// srcset lists the resolutions as "url 800w, url 1600w"
+			let best = src(page), bestWidth = page.naturalWidth || 0;
+			for (const candidate of (page.srcset || '').split(',')) {
+				const [url, size] = candidate.trim().split(/\s+/);
+				const width = parseInt(size, 10);
+				if (url && width > bestWidth) {
+					best = url;
+					bestWidth = width;
+				}
+			}
+			return best;
+		}
+
+		return (` + genericImageJS + `);
+	})()
+`
+
+// pageCountJS reads the number of pages from the viewer: a count in its
+// embedded state, or else a pagination indicator such as "1 / 48" or
+// "Pagina 2-3 din 48". It returns 0 when neither is found.
+const pageCountJS = `
+	(() => {
+		const countKeys = ['pageCount', 'totalPages', 'numberOfPages', 'pagesCount'];
+		let fromState = 0, fromArray = 0;
+		const visit = (value, depth) => {
+			if (!value || typeof value !== 'object' || depth > 6) return;
+			for (const [key, child] of Object.entries(value)) {
+				if (countKeys.includes(key) && Number.isInteger(child) && child > fromState) {
+					fromState = child;
+				} else if (key === 'pages' && Array.isArray(child) && child.length > fromArray) {
+					fromArray = child.length;
+				}
+				visit(child, depth + 1);
+			}
+		};
+		for (const name of ['__INITIAL_STATE__', '__NUXT__', '__NEXT_DATA__', '__PRELOADED_STATE__']) {
+			try { visit(window[name], 0); } catch (e) {}
+		}
+		if (fromState > 0) return fromState;
+		if (fromArray > 0) return fromArray;
+
+		const indicator = /^\s*(?:pagina|page|seite)?\s*\d+(?:\s*-\s*\d+)?\s*(?:\/|din|of|von)\s*(\d+)\s*$/i;
+		const elements = document.querySelectorAll('[class*="page" i], [class*="pagination" i], [aria-live]');
+		for (const el of elements) {
+			const match = (el.textContent || '').match(indicator);
+			if (match) return parseInt(match[1], 10);
+		}
+		return 0;
+	})()
+`
+
+// imageScript returns the JavaScript finding the page image: the image_url
+// script when set, otherwise the one of the config's extractor
+func (c *ScraperConfig) imageScript() (string, error) {
+	if c.Scripts != nil && c.Scripts.ImageURL != "" {
+		return c.Scripts.ImageURL, nil
+	}
+	switch c.Extractor {
+	case "", ExtractorGeneric:
+		return genericImageJS, nil
+	case ExtractorSchwarz:
+		return schwarzImageJS, nil
+	default:
+		return "", fmt.Errorf("unknown extractor %q", c.Extractor)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// StoreGroup is a retail group owning several store chains
+type StoreGroup struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Stores []string `json:"stores"`
+}
+
+// storeGroups lists the retail groups behind the chains we scrape or plan to
+var storeGroups = []StoreGroup{
+	{ID: "schwarz", Name: "Schwarz Group", Stores: []string{"lidl", "kaufland"}},
+	{ID: "rewe", Name: "REWE Group", Stores: []string{"penny"}},
+	{ID: "ahold-delhaize", Name: "Ahold Delhaize", Stores: []string{"mega-image"}},
+	{ID: "carrefour", Name: "Carrefour", Stores: []string{"carrefour"}},
+	{ID: "auchan", Name: "Auchan Retail", Stores: []string{"auchan"}},
+	{ID: "profi", Name: "Profi Rom Food", Stores: []string{"profi"}},
+}
+
+// findGroup returns the group with the given ID
+func findGroup(id string) (StoreGroup, bool) {
+	for _, g := range storeGroups {
+		if g.ID == id {
+			return g, true
+		}
+	}
+	return StoreGroup{}, false
+}
+
+// GroupOfStore returns the group a store chain belongs to
+func GroupOfStore(store string) (StoreGroup, bool) {
+	for _, g := range storeGroups {
+		for _, s := range g.Stores {
+			if strings.EqualFold(s, store) {
+				return g, true
+			}
+		}
+	}
+	return StoreGroup{}, false
+}
+
+// API Handlers
+
+func getGroups(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(storeGroups)
+}
+
+func getGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := findGroup(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Group not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(group)
+}
+
+func getGroupNewsletters(w http.ResponseWriter, r *http.Request) {
+	group, ok := findGroup(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Group not found", http.StatusNotFound)
+		return
+	}
+
+	result := []Newsletter{}
+	for _, n := range newsletters.List() {
+		if g, ok := GroupOfStore(n.Store); ok && g.ID == group.ID {
+			result = append(result, n)
+		}
+	}
+
+	writeNewsletterList(w, r, result)
+}
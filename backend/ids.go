@@ -0,0 +1,231 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Newsletter ID strategies, selected by id_strategy in a scraper config
+const (
+	// IDStrategyConfig uses the config ID as is (the default)
+	IDStrategyConfig = "config"
+	// IDStrategyDate builds a readable ID from store and valid_from
+	IDStrategyDate = "date"
+	// IDStrategyURLHash hashes the catalog URL, stable across title changes
+	IDStrategyURLHash = "url-hash"
+	// IDStrategyUUID derives a name-based UUID from the catalog URL
+	IDStrategyUUID = "uuid"
+	// IDStrategyTemplate expands id_template
+	IDStrategyTemplate = "template"
+)
+
+// uuidNamespaceURL is the RFC 4122 namespace for URLs
+var uuidNamespaceURL = []byte{0x6b, 0xa7, 0xb8, 0x11, 0x9d, 0xad, 0x11, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}
+
+// nameUUID returns the version 5 UUID of name in the URL namespace, so the
+// same catalog URL always maps to the same ID
+func nameUUID(name string) string {
+	h := sha1.New()
+	h.Write(uuidNamespaceURL)
+	h.Write([]byte(name))
+	u := h.Sum(nil)[:16]
+	u[6] = (u[6] & 0x0f) | 0x50
+	u[8] = (u[8] & 0x3f) | 0x80
+	s := hex.EncodeToString(u)
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+var slugInvalidRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify makes a string safe for use in paths and URLs
+func slugify(s string) string {
+	return strings.Trim(slugInvalidRe.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+// NewsletterID returns the ID the config's newsletter is stored under.
+// Templates may use {id}, {store}, {valid_from}, {valid_until}, {hash} and
+// {uuid}.
+func (c *ScraperConfig) NewsletterID() (string, error) {
+	sum := sha256.Sum256([]byte(c.FirstPage))
+	hash := hex.EncodeToString(sum[:])[:12]
+
+	var id string
+	switch c.IDStrategy {
+	case "", IDStrategyConfig:
+		return c.ID, nil
+	case IDStrategyDate:
+		if c.ValidFrom == "" {
+			return "", fmt.Errorf("id_strategy %q needs valid_from", c.IDStrategy)
+		}
+		id = c.StoreName() + "-" + c.ValidFrom
+	case IDStrategyURLHash:
+		id = c.StoreName() + "-" + hash
+	case IDStrategyUUID:
+		return nameUUID(c.FirstPage), nil
+	case IDStrategyTemplate:
+		if c.IDTemplate == "" {
+			return "", fmt.Errorf("id_strategy %q needs id_template", c.IDStrategy)
+		}
+		id = strings.NewReplacer(
+			"{id}", c.ID,
+			"{store}", c.StoreName(),
+			"{valid_from}", c.ValidFrom,
+			"{valid_until}", c.ValidUntil,
+			"{hash}", hash,
+			"{uuid}", nameUUID(c.FirstPage),
+		).Replace(c.IDTemplate)
+	default:
+		return "", fmt.Errorf("unknown id_strategy %q", c.IDStrategy)
+	}
+
+	if id = slugify(id); id == "" {
+		return "", fmt.Errorf("id_strategy %q produced an empty ID", c.IDStrategy)
+	}
+	return id, nil
+}
+
+// IDRename is one newsletter moved to the ID its config now produces
+type IDRename struct {
+	From string
+	To   string
+}
+
+// planIDRenames compares every stored newsletter with the ID its config
+// produces today
+func planIDRenames(list []Newsletter) ([]IDRename, error) {
+	taken := map[string]bool{}
+	for _, n := range list {
+		taken[n.ID] = true
+	}
+
+	var renames []IDRename
+	for _, n := range list {
+		path, ok := findConfigPath(n.ConfigID)
+		if !ok {
+			slog.Warn("skipping newsletter, config not found", "newsletter", n.ID, "config", n.ConfigID)
+			continue
+		}
+		config, err := LoadScraperConfig(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %v", path, err)
+		}
+		id, err := config.NewsletterID()
+		if err != nil {
+			return nil, fmt.Errorf("config %s: %v", config.ID, err)
+		}
+		if id == n.ID {
+			continue
+		}
+		if taken[id] {
+			return nil, fmt.Errorf("cannot rename %s: %s already exists", n.ID, id)
+		}
+		taken[id] = true
+		renames = append(renames, IDRename{From: n.ID, To: id})
+	}
+	return renames, nil
+}
+
+// renameNewsletter moves a newsletter's directory and rewrites its image URLs
+func renameNewsletter(n *Newsletter, id string) error {
+	from := dataDir(*n)
+	if _, err := os.Stat(from); err == nil {
+		if err := os.Rename(from, newsletterDir(dataLayout(), n.Store, id, n.ValidFrom)); err != nil {
+			return err
+		}
+	}
+
+	oldPrefix := "/newsletters/" + n.ID + "/"
+	newPrefix := "/newsletters/" + id + "/"
+	move := func(u *string) {
+		if strings.HasPrefix(*u, oldPrefix) {
+			*u = newPrefix + strings.TrimPrefix(*u, oldPrefix)
+		}
+	}
+	move(&n.CoverImage)
+	move(&n.CoverThumbnail)
+	for i := range n.Pages {
+		move(&n.Pages[i].ImageURL)
+		move(&n.Pages[i].ThumbnailURL)
+		move(&n.Pages[i].MediumURL)
+	}
+	n.ID = id
+	return nil
+}
+
+// renameShares points share links at the new IDs of renamed newsletters
+func renameShares(renames map[string]string) error {
+	links, err := LoadShareRegistry(sharesFile)
+	if err != nil {
+		return fmt.Errorf("failed to load share links: %v", err)
+	}
+	changed, err := links.Rename(renames)
+	if err != nil {
+		return fmt.Errorf("failed to save share links: %v", err)
+	}
+	if changed > 0 {
+		slog.Info("updated share links", "count", changed)
+	}
+	return nil
+}
+
+// runMigrateIDs renames stored newsletters after an id_strategy change and
+// points share links at the new IDs. It must run while the server is
+// stopped; pending outbox events for the old IDs are dropped on the next
+// start.
+func runMigrateIDs(args []string) error {
+	fs := flag.NewFlagSet("migrate-ids", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "only print the planned renames")
+	fs.Parse(args)
+
+	list, err := LoadNewsletters()
+	if err != nil {
+		return fmt.Errorf("failed to load newsletters: %v", err)
+	}
+	renames, err := planIDRenames(list)
+	if err != nil {
+		return err
+	}
+	for _, r := range renames {
+		slog.Info("rename", "from", r.From, "to", r.To)
+	}
+	if *dryRun || len(renames) == 0 {
+		return nil
+	}
+
+	targets := map[string]string{}
+	for _, r := range renames {
+		targets[r.From] = r.To
+	}
+	renamed := map[string]string{}
+	for i := range list {
+		from := list[i].ID
+		to, ok := targets[from]
+		if !ok {
+			continue
+		}
+		if err := renameNewsletter(&list[i], to); err != nil {
+			// Save what was moved so records, directories and links stay in sync
+			SaveNewsletters(list)
+			renameShares(renamed)
+			return fmt.Errorf("failed to rename %s: %v", from, err)
+		}
+		renamed[from] = to
+	}
+	if err := SaveNewsletters(list); err != nil {
+		return fmt.Errorf("failed to save newsletters: %v", err)
+	}
+	if err := renameShares(renamed); err != nil {
+		return err
+	}
+	slog.Info("renamed newsletters", "count", len(renames))
+	// Rollback snapshots refer to the old IDs
+	os.RemoveAll(rollbackDir)
+	return nil
+}
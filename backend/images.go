@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// servableImageExts are the only files served from the newsletters directory;
+// metadata such as newsletters.json or api-tokens.json stays private
+var servableImageExts = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".webp": true,
+}
+
+// serveNewsletterImage serves a stored image with http.ServeContent on the
+// open file, so the body goes out through sendfile instead of user-space
+// buffers, and range requests and conditional headers work. Requests whose
+// client already went away are dropped before touching the disk.
+func serveNewsletterImage(w http.ResponseWriter, r *http.Request) {
+	if r.Context().Err() != nil {
+		return
+	}
+
+	name := path.Clean("/" + strings.TrimPrefix(r.URL.Path, "/newsletters/"))
+	if !servableImageExts[strings.ToLower(path.Ext(name))] {
+		http.NotFound(w, r)
+		return
+	}
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	filePath, ok := localImagePath("/newsletters" + name)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const defaultJanitorInterval = 24 * time.Hour
+
+// Data classes the janitor expires, each after its own retention
+const (
+	// DataNewsletters are the records, removed with everything stored for them
+	DataNewsletters = "newsletters"
+	// DataImages are the cover and page images with their variants and tiles
+	DataImages = "images"
+	// DataOffers are the products extracted from the pages
+	DataOffers = "offers"
+	// DataJobs are finished scrape jobs
+	DataJobs = "jobs"
+)
+
+// retentionEnv names the env variable with the retention of each data
+// class: how many days after their valid_until newsletters keep the data,
+// or for jobs how many days after they finished they are kept
+var retentionEnv = map[string]string{
+	DataNewsletters: "RETENTION_DAYS",
+	DataImages:      "RETENTION_IMAGES_DAYS",
+	DataOffers:      "RETENTION_OFFERS_DAYS",
+	DataJobs:        "RETENTION_JOBS_DAYS",
+}
+
+// ExpiredNewsletter is a newsletter removed by the retention policy, or
+// whose images or offers were
+type ExpiredNewsletter struct {
+	ID         string `json:"id"`
+	Store      string `json:"store"`
+	ValidUntil string `json:"validUntil"`
+}
+
+// CleanupReport lists what a cleanup removed, or would remove in a dry run
+type CleanupReport struct {
+	DryRun bool `json:"dryRun"`
+	// Retention is the default retention in days of every data class
+	Retention     map[string]int      `json:"retention"`
+	Removed       []ExpiredNewsletter `json:"removed"`
+	ImagesRemoved []ExpiredNewsletter `json:"imagesRemoved"`
+	OffersRemoved []ExpiredNewsletter `json:"offersRemoved"`
+	JobsRemoved   int                 `json:"jobsRemoved"`
+	FilesLeft     []string            `json:"filesLeft,omitempty"`
+}
+
+// defaultRetentionDays reads the retention of a data class from its env
+// variable; 0 (the default) keeps the data forever
+func defaultRetentionDays(class string) int {
+	name := retentionEnv[class]
+	v := os.Getenv(name)
+	if v == "" {
+		return 0
+	}
+	days, err := strconv.Atoi(v)
+	if err != nil || days < 0 {
+		slog.Warn("invalid retention, keeping the data forever", "setting", name, "value", v)
+		return 0
+	}
+	return days
+}
+
+// retentionPolicy returns the retention of a data class for every store:
+// def, except for newsletters, where the retention_days of a store's
+// configs wins
+func retentionPolicy(class string, def int) func(store string) int {
+	perStore := map[string]int{}
+	if class == DataNewsletters {
+		stores, _ := ListAvailableStores()
+		for _, s := range stores {
+			if s.RetentionDays != nil {
+				perStore[s.Name] = *s.RetentionDays
+			}
+		}
+	}
+	return func(store string) int {
+		if days, ok := perStore[store]; ok {
+			return days
+		}
+		return def
+	}
+}
+
+// expired reports whether n ended more than days before today
+func expired(n Newsletter, days int, today time.Time) bool {
+	if days <= 0 || n.ValidUntil == "" {
+		return false
+	}
+	return n.ValidUntil < today.AddDate(0, 0, -days).Format("2006-01-02")
+}
+
+// retentionPolicies holds the retention of every newsletter data class
+type retentionPolicies map[string]func(store string) int
+
+// due reports what the policies remove of n: the whole newsletter, or
+// else its images and its offers, when it still has them
+func (p retentionPolicies) due(n Newsletter, today time.Time) (newsletter, images, offers bool) {
+	if expired(n, p[DataNewsletters](n.Store), today) {
+		return true, false, false
+	}
+	images = expired(n, p[DataImages](n.Store), today) && hasImages(n)
+	offers = expired(n, p[DataOffers](n.Store), today) && hasOffers(n)
+	return false, images, offers
+}
+
+// cleanupExpired applies the retention of every data class. Expired
+// newsletters lose their records first, then their stored data; the others
+// may lose their images or offers. Each store is locked like during a
+// scrape, and its rollback snapshot is dropped since it may refer to
+// removed data. Finished jobs past their retention are forgotten.
+func cleanupExpired(today time.Time, dryRun bool) (*CleanupReport, error) {
+	report := &CleanupReport{
+		DryRun:        dryRun,
+		Retention:     map[string]int{},
+		Removed:       []ExpiredNewsletter{},
+		ImagesRemoved: []ExpiredNewsletter{},
+		OffersRemoved: []ExpiredNewsletter{},
+	}
+	policies := retentionPolicies{}
+	for class := range retentionEnv {
+		report.Retention[class] = defaultRetentionDays(class)
+		policies[class] = retentionPolicy(class, report.Retention[class])
+	}
+
+	stores := map[string]bool{}
+	for _, n := range newsletters.List() {
+		if newsletter, images, offers := policies.due(n, today); newsletter || images || offers {
+			stores[n.Store] = true
+		}
+	}
+	names := make([]string, 0, len(stores))
+	for store := range stores {
+		names = append(names, store)
+	}
+	sort.Strings(names)
+
+	for _, store := range names {
+		if err := cleanupStore(store, policies, today, dryRun, report); err != nil {
+			return report, err
+		}
+	}
+
+	if days := report.Retention[DataJobs]; days > 0 {
+		report.JobsRemoved = scrapeJobs.expireFinished(today.AddDate(0, 0, -days), dryRun)
+	}
+	return report, nil
+}
+
+// cleanupStore applies the retention policies to the newsletters of one
+// store; removed newsletters get a newsletter.deleted event
+func cleanupStore(store string, policies retentionPolicies, today time.Time, dryRun bool, report *CleanupReport) error {
+	lock := storeLock(store)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// The store may have changed since the caller looked
+	var kept, removed, withoutImages, withoutOffers []Newsletter
+	for _, n := range newsletters.List() {
+		if n.Store != store {
+			continue
+		}
+		newsletter, images, offers := policies.due(n, today)
+		if newsletter {
+			removed = append(removed, n)
+			continue
+		}
+		kept = append(kept, n)
+		if images {
+			withoutImages = append(withoutImages, n)
+		}
+		if offers {
+			withoutOffers = append(withoutOffers, n)
+		}
+	}
+	expiredEntry := func(n Newsletter) ExpiredNewsletter {
+		return ExpiredNewsletter{ID: n.ID, Store: n.Store, ValidUntil: n.ValidUntil}
+	}
+	for _, n := range removed {
+		report.Removed = append(report.Removed, expiredEntry(n))
+	}
+	for _, n := range withoutImages {
+		report.ImagesRemoved = append(report.ImagesRemoved, expiredEntry(n))
+	}
+	for _, n := range withoutOffers {
+		report.OffersRemoved = append(report.OffersRemoved, expiredEntry(n))
+	}
+	if dryRun || len(removed)+len(withoutImages)+len(withoutOffers) == 0 {
+		return nil
+	}
+
+	if len(removed) > 0 {
+		if kept == nil {
+			kept = []Newsletter{}
+		}
+		if err := replaceStoreNewsletters(store, kept); err != nil {
+			return fmt.Errorf("failed to save newsletters of %s: %v", store, err)
+		}
+		for _, n := range removed {
+			report.FilesLeft = append(report.FilesLeft, removeExpiredData(n, kept)...)
+		}
+		slog.Info("removed expired newsletters", "store", store, "count", len(removed), "retention_days", policies[DataNewsletters](store))
+	}
+	for _, n := range withoutOffers {
+		report.FilesLeft = append(report.FilesLeft, removeOffers(n)...)
+	}
+	if len(withoutOffers) > 0 {
+		slog.Info("removed expired offers", "store", store, "count", len(withoutOffers), "retention_days", policies[DataOffers](store))
+	}
+	for _, n := range withoutImages {
+		left, err := removeImages(n)
+		report.FilesLeft = append(report.FilesLeft, left...)
+		if err != nil {
+			return err
+		}
+	}
+	if len(withoutImages) > 0 {
+		slog.Info("removed expired images", "store", store, "count", len(withoutImages), "retention_days", policies[DataImages](store))
+	}
+	removeStoreSnapshot(store)
+	return nil
+}
+
+// removeExpiredData deletes the images of an expired newsletter, and the
+// recording of its config unless a kept newsletter came from the same config
+func removeExpiredData(n Newsletter, kept []Newsletter) []string {
+	for _, k := range kept {
+		if k.ConfigID == n.ConfigID {
+			n.ConfigID = ""
+			break
+		}
+	}
+	return removeArchivedData(n)
+}
+
+// storedImages returns the files of the cover and page images of n
+func storedImages(n Newsletter) []string {
+	var paths []string
+	if path, ok := localImagePath(n.CoverImage); ok {
+		paths = append(paths, path)
+	}
+	for _, page := range n.Pages {
+		if path, ok := localImagePath(page.ImageURL); ok {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// hasImages reports whether any image of n is still stored
+func hasImages(n Newsletter) bool {
+	for _, path := range storedImages(n) {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// hasOffers reports whether products extracted from n are still stored
+func hasOffers(n Newsletter) bool {
+	for _, path := range storedImages(n) {
+		if _, err := os.Stat(productsPath(path)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// removeFiles deletes files, returning the ones that could not be deleted
+func removeFiles(paths []string) []string {
+	var left []string
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			slog.Error("failed to remove expired data", "file", path, "err", err)
+			left = append(left, path)
+		}
+	}
+	return left
+}
+
+// removeOffers deletes the products extracted from the pages of n
+func removeOffers(n Newsletter) []string {
+	var paths []string
+	for _, path := range storedImages(n) {
+		paths = append(paths, productsPath(path))
+	}
+	return removeFiles(paths)
+}
+
+// removeImages deletes the cover and page images of n with their size
+// variants and tiles. The record keeps its pages, which its offers are
+// found through, but loses the cover and variant URLs and links to the
+// store's viewer instead when its config is still around.
+func removeImages(n Newsletter) ([]string, error) {
+	var paths []string
+	for _, path := range storedImages(n) {
+		paths = append(paths, path, tilesPath(path))
+		for _, v := range imageVariants {
+			paths = append(paths, variantPath(path, v.size))
+		}
+	}
+	left := removeFiles(paths)
+
+	if n.ViewerURL == "" {
+		if path, ok := findConfigPath(n.ConfigID); ok {
+			if config, err := LoadScraperConfig(path); err == nil {
+				n.ViewerURL = config.FirstPage
+			}
+		}
+	}
+	n.CoverImage = ""
+	n.CoverThumbnail = ""
+	n.Pages = append([]Page{}, n.Pages...)
+	for i := range n.Pages {
+		n.Pages[i].ThumbnailURL = ""
+		n.Pages[i].MediumURL = ""
+	}
+	n.LastUpdated = time.Now()
+	if err := registerNewsletter(n); err != nil {
+		return left, fmt.Errorf("failed to update %s: %v", n.ID, err)
+	}
+	return left, nil
+}
+
+// startJanitor applies the retention policies now and then periodically.
+// JANITOR_INTERVAL (a Go duration, default 24h) sets the period; "off"
+// disables the janitor.
+func startJanitor() {
+	interval := defaultJanitorInterval
+	if v := os.Getenv("JANITOR_INTERVAL"); v != "" {
+		if v == "off" {
+			return
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			slog.Warn("invalid JANITOR_INTERVAL, using the default", "value", v, "default", interval)
+		} else {
+			interval = d
+		}
+	}
+
+	clean := func() {
+		if _, err := cleanupExpired(time.Now(), false); err != nil {
+			slog.Error("failed to remove expired data", "err", err)
+		}
+	}
+
+	go func() {
+		clean()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			clean()
+		}
+	}()
+}
+
+// API Handlers
+
+// getCleanupReport lists what the janitor would remove now, without
+// removing anything
+func getCleanupReport(w http.ResponseWriter, r *http.Request) {
+	report, err := cleanupExpired(time.Now(), true)
+	if err != nil {
+		logFrom(r.Context()).Error("failed to list expired data", "err", err)
+		http.Error(w, "Error listing expired data", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func runCleanup(w http.ResponseWriter, r *http.Request) {
+	report, err := cleanupExpired(time.Now(), r.URL.Query().Get("dryRun") == "true")
+	if err != nil {
+		slog.Error("failed to remove expired data", "err", err)
+		http.Error(w, "Error removing expired data", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Scrape job states
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobSkipped   = "skipped" // the catalog was already downloaded
+)
+
+const (
+	defaultScrapeWorkers = 2
+	// maxFinishedJobs is how many finished jobs are kept for status queries
+	maxFinishedJobs = 200
+)
+
+// Job is a scrape started through the API
+type Job struct {
+	ID              string     `json:"id"`
+	Config          string     `json:"config"`
+	CoverOnly       bool       `json:"coverOnly,omitempty"`
+	Status          string     `json:"status"`
+	PagesDownloaded int        `json:"pagesDownloaded"`
+	PagesTotal      int        `json:"pagesTotal"`
+	Error           string     `json:"error,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	StartedAt       *time.Time `json:"startedAt,omitempty"`
+	FinishedAt      *time.Time `json:"finishedAt,omitempty"`
+	// FullJob is the full scrape a cover-only job queued for a new or
+	// changed catalog
+	FullJob string `json:"fullJob,omitempty"`
+	// RequestID is the API request that started the job, or the job that
+	// queued it
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// JobRegistry tracks scrape jobs in memory and runs at most SCRAPE_WORKERS
+// of them at a time, so a burst of requests doesn't start a Chrome each
+type JobRegistry struct {
+	mu       sync.Mutex
+	jobs     map[string]*Job
+	finished []string
+	slots    chan struct{}
+}
+
+var scrapeJobs = NewJobRegistry()
+
+// NewJobRegistry creates an empty registry sized by SCRAPE_WORKERS
+func NewJobRegistry() *JobRegistry {
+	workers := defaultScrapeWorkers
+	if v := os.Getenv("SCRAPE_WORKERS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			workers = n
+		} else {
+			slog.Warn("invalid SCRAPE_WORKERS, using the default", "value", v, "default", workers)
+		}
+	}
+	return &JobRegistry{jobs: make(map[string]*Job), slots: make(chan struct{}, workers)}
+}
+
+// Start queues a scrape of configPath and returns its job. No jobs are
+// accepted once the server is shutting down.
+func (reg *JobRegistry) Start(config, configPath string, opts ScrapeOptions) (Job, error) {
+	if background.Err() != nil {
+		return Job{}, errShuttingDown
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return Job{}, err
+	}
+	job := &Job{ID: id, Config: config, CoverOnly: opts.CoverOnly, Status: JobQueued, CreatedAt: time.Now(), RequestID: opts.RequestID}
+
+	reg.mu.Lock()
+	reg.jobs[id] = job
+	snapshot := *job
+	reg.mu.Unlock()
+
+	opts.Progress = func(downloaded, total int) {
+		reg.update(func() { job.PagesDownloaded, job.PagesTotal = downloaded, total })
+	}
+
+	// Everything the scrape logs names the job and the request behind it
+	logger := slog.Default().With("job", id)
+	if opts.RequestID != "" {
+		logger = logger.With("request_id", opts.RequestID)
+	}
+	ctx := withLogger(background, logger)
+
+	go func() {
+		var err error
+		select {
+		case reg.slots <- struct{}{}:
+			reg.update(func() {
+				now := time.Now()
+				job.Status, job.StartedAt = JobRunning, &now
+			})
+			if opts.CoverOnly {
+				logger.Info("job checking for a new catalog", "config", config)
+			} else {
+				logger.Info("job started", "config", config)
+			}
+
+			err = ScrapeAndDownloadFromConfig(ctx, configPath, opts)
+			<-reg.slots
+		case <-background.Done():
+			// Queued jobs never start once shutdown began
+			err = errShuttingDown
+		}
+
+		// A new or changed catalog is scraped in full by a job of its own
+		var full Job
+		if err == errCatalogChanged {
+			full, err = reg.Start(config, configPath, ScrapeOptions{Force: true, RequestID: opts.RequestID})
+		}
+
+		reg.update(func() {
+			now := time.Now()
+			job.FinishedAt = &now
+			switch {
+			case err == errCatalogUnchanged:
+				job.Status = JobSkipped
+			case err != nil:
+				job.Status, job.Error = JobFailed, err.Error()
+			default:
+				job.Status, job.FullJob = JobSucceeded, full.ID
+			}
+		})
+		if full.ID != "" {
+			logger.Info("catalog is new or changed, queued a full scrape", "config", config, "full_job", full.ID)
+		} else if err == errCatalogUnchanged {
+			logger.Info("job skipped, catalog already downloaded", "config", config)
+		} else if err != nil {
+			logger.Error("job failed", "config", config, "err", err)
+		} else {
+			logger.Info("job succeeded", "config", config)
+		}
+		reg.retire(id)
+	}()
+
+	return snapshot, nil
+}
+
+// Active reports whether a job is queued or running, or a full scrape it
+// queued still is
+func (reg *JobRegistry) Active(id string) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for job, ok := reg.jobs[id]; ok; job, ok = reg.jobs[job.FullJob] {
+		if job.Status == JobQueued || job.Status == JobRunning {
+			return true
+		}
+	}
+	return false
+}
+
+// update changes a job under the registry lock
+func (reg *JobRegistry) update(change func()) {
+	reg.mu.Lock()
+	change()
+	reg.mu.Unlock()
+}
+
+// retire records a finished job, forgetting the oldest beyond maxFinishedJobs
+func (reg *JobRegistry) retire(id string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.finished = append(reg.finished, id)
+	if len(reg.finished) > maxFinishedJobs {
+		delete(reg.jobs, reg.finished[0])
+		reg.finished = reg.finished[1:]
+	}
+}
+
+// Get returns a snapshot of a job
+func (reg *JobRegistry) Get(id string) (Job, bool) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	job, ok := reg.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// expireFinished forgets the finished jobs that finished before cutoff and
+// returns how many there were; a dry run only counts them
+func (reg *JobRegistry) expireFinished(cutoff time.Time, dryRun bool) int {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	kept := reg.finished[:0:0]
+	expired := 0
+	for _, id := range reg.finished {
+		job := reg.jobs[id]
+		if job == nil || job.FinishedAt == nil || !job.FinishedAt.Before(cutoff) {
+			kept = append(kept, id)
+			continue
+		}
+		expired++
+		if !dryRun {
+			delete(reg.jobs, id)
+		}
+	}
+	if !dryRun {
+		reg.finished = kept
+	}
+	return expired
+}
+
+// Depth counts the jobs waiting for a worker and the ones running
+func (reg *JobRegistry) Depth() (queued, running int) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for _, job := range reg.jobs {
+		switch job.Status {
+		case JobQueued:
+			queued++
+		case JobRunning:
+			running++
+		}
+	}
+	return queued, running
+}
+
+// API Handlers
+
+func getJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := scrapeJobs.Get(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
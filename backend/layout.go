@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// layoutSampleWidth is the width pages are downscaled to for segmentation
+	layoutSampleWidth = 160
+	// layoutThreshold is the luminance distance from the background that
+	// counts as foreground
+	layoutThreshold = 0.08
+	// layoutDilation merges foreground pixels closer than this many samples,
+	// so the text and picture of one product end up in the same component
+	layoutDilation = 2
+	// minTileFraction and maxTileFraction bound the tile area relative to the page
+	minTileFraction = 0.005
+	maxTileFraction = 0.6
+)
+
+// Tile is a product tile detected on a catalog page, in source image pixels
+type Tile struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// segmentPageTiles splits a page image into product tiles using connected
+// components over a foreground mask, ordered top-to-bottom, left-to-right
+func segmentPageTiles(imagePath string) ([]Tile, error) {
+	img, err := decodeImageFile(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	page := toGray(img, layoutSampleWidth)
+	if page.w == 0 || page.h == 0 {
+		return nil, fmt.Errorf("image too small to segment")
+	}
+
+	mask := dilate(foregroundMask(page), page.w, page.h, layoutDilation)
+
+	scaleX := float64(bounds.Dx()) / float64(page.w)
+	scaleY := float64(bounds.Dy()) / float64(page.h)
+	pageArea := page.w * page.h
+
+	var tiles []Tile
+	for _, box := range connectedComponents(mask, page.w, page.h) {
+		area := box.w * box.h
+		if float64(area) < minTileFraction*float64(pageArea) || float64(area) > maxTileFraction*float64(pageArea) {
+			continue
+		}
+		tiles = append(tiles, Tile{
+			X:      int(float64(box.x) * scaleX),
+			Y:      int(float64(box.y) * scaleY),
+			Width:  int(float64(box.w) * scaleX),
+			Height: int(float64(box.h) * scaleY),
+		})
+	}
+
+	sort.Slice(tiles, func(i, j int) bool {
+		if tiles[i].Y != tiles[j].Y {
+			return tiles[i].Y < tiles[j].Y
+		}
+		return tiles[i].X < tiles[j].X
+	})
+	return tiles, nil
+}
+
+// foregroundMask marks samples that differ from the background tone,
+// taken as the median luminance along the page border
+func foregroundMask(page *grayImage) []bool {
+	var border []float64
+	for x := 0; x < page.w; x++ {
+		border = append(border, page.at(x, 0), page.at(x, page.h-1))
+	}
+	for y := 1; y < page.h-1; y++ {
+		border = append(border, page.at(0, y), page.at(page.w-1, y))
+	}
+	sort.Float64s(border)
+	background := border[len(border)/2]
+
+	mask := make([]bool, len(page.pix))
+	for i, v := range page.pix {
+		d := v - background
+		mask[i] = d > layoutThreshold || d < -layoutThreshold
+	}
+	return mask
+}
+
+// dilate grows every foreground sample by r samples in each direction
+func dilate(mask []bool, w, h, r int) []bool {
+	out := make([]bool, len(mask))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if !mask[y*w+x] {
+				continue
+			}
+			for dy := -r; dy <= r; dy++ {
+				for dx := -r; dx <= r; dx++ {
+					nx, ny := x+dx, y+dy
+					if nx >= 0 && nx < w && ny >= 0 && ny < h {
+						out[ny*w+nx] = true
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+type box struct {
+	x, y, w, h int
+}
+
+// connectedComponents returns the bounding boxes of 4-connected foreground regions
+func connectedComponents(mask []bool, w, h int) []box {
+	seen := make([]bool, len(mask))
+	var boxes []box
+	var stack []int
+
+	for start := range mask {
+		if !mask[start] || seen[start] {
+			continue
+		}
+
+		minX, minY := w, h
+		maxX, maxY := -1, -1
+		stack = append(stack[:0], start)
+		seen[start] = true
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			x, y := i%w, i/w
+			minX, maxX = min(minX, x), max(maxX, x)
+			minY, maxY = min(minY, y), max(maxY, y)
+
+			for _, n := range [4][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+				nx, ny := n[0], n[1]
+				if nx < 0 || nx >= w || ny < 0 || ny >= h {
+					continue
+				}
+				j := ny*w + nx
+				if mask[j] && !seen[j] {
+					seen[j] = true
+					stack = append(stack, j)
+				}
+			}
+		}
+		boxes = append(boxes, box{x: minX, y: minY, w: maxX - minX + 1, h: maxY - minY + 1})
+	}
+	return boxes
+}
+
+// tilesPath returns the sidecar file holding the tiles of a page image
+func tilesPath(imagePath string) string {
+	return strings.TrimSuffix(imagePath, ".jpg") + ".tiles.json"
+}
+
+// saveTiles writes the detected tiles next to the page image
+func saveTiles(imagePath string, tiles []Tile) error {
+	data, err := json.MarshalIndent(tiles, "", "  ")
+	if err != nil {
+		return err
+	}
+	return replaceFile(tilesPath(imagePath), data, filePerm)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// ready is set once warmup finished and the API can serve requests
+var ready atomic.Bool
+
+const defaultShutdownTimeout = 30 * time.Second
+
+// background is cancelled when the server shuts down. Scrapes and browser
+// checks derive their contexts from it.
+var background, stopBackground = context.WithCancel(context.Background())
+
+// inFlight counts running scrapes and backfills, so shutdown can wait for
+// them to clean up their directories and Chrome processes
+var inFlight sync.WaitGroup
+
+// errShuttingDown is returned for work refused or cut short by shutdown
+var errShuttingDown = errors.New("server is shutting down")
+
+// warmup loads all storage and optionally starts Chrome once, so the first
+// requests and scrapes don't pay for it. WARMUP_CHROME=true enables the
+// Chrome check.
+func warmup() error {
+	started := time.Now()
+
+	var err error
+	apiTokens, err = LoadTokenRegistry(tokensFile)
+	if err != nil {
+		return fmt.Errorf("failed to load API tokens: %v", err)
+	}
+	apiTokens.Start()
+
+	shareLinks, err = LoadShareRegistry(sharesFile)
+	if err != nil {
+		return fmt.Errorf("failed to load share links: %v", err)
+	}
+
+	optOuts, err = LoadOptOutRegistry(optOutsFile)
+	if err != nil {
+		return fmt.Errorf("failed to load store opt-outs: %v", err)
+	}
+
+	scrapeCosts, err = LoadCostRegistry(costsFile)
+	if err != nil {
+		return fmt.Errorf("failed to load scrape costs: %v", err)
+	}
+
+	translator = NewTranslator()
+	ocrEngine = NewOCREngine()
+
+	list, err := LoadNewsletters()
+	if err != nil {
+		return fmt.Errorf("failed to load newsletters: %v", err)
+	}
+	newsletters.load(list)
+
+	outbox, err = LoadOutbox(outboxFile)
+	if err != nil {
+		return fmt.Errorf("failed to load event outbox: %v", err)
+	}
+	outbox.Subscribe(logEventHandler{})
+
+	eventBus, err = NewEventPublisher()
+	if err != nil {
+		return fmt.Errorf("failed to configure event bus: %v", err)
+	}
+	if eventBus != nil {
+		outbox.Subscribe(busEventHandler{publisher: eventBus})
+	}
+	outbox.Start()
+
+	if os.Getenv("WARMUP_CHROME") == "true" {
+		if err := startChromeOnce(); err != nil {
+			return fmt.Errorf("failed to start Chrome: %v", err)
+		}
+	}
+
+	slog.Info("warmup finished", "duration", time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+// startChromeOnce launches headless Chrome and loads a blank page
+func startChromeOnce() error {
+	ctx, cancel := context.WithTimeout(background, 30*time.Second)
+	defer cancel()
+	browserCtx, browserCancel := newBrowserContext(ctx)
+	defer browserCancel()
+
+	return chromedp.Run(browserCtx, chromedp.Navigate("about:blank"))
+}
+
+// shutdown stops accepting requests and cancels running scrapes, then waits
+// up to SHUTDOWN_TIMEOUT (a Go duration, default 30s) for requests to
+// finish and scrapes to clean up
+func shutdown(srv *http.Server) {
+	timeout := defaultShutdownTimeout
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			slog.Warn("invalid SHUTDOWN_TIMEOUT, using the default", "value", v, "default", timeout)
+		} else {
+			timeout = d
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stopBackground()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("requests still running", "timeout", timeout, "err", err)
+	}
+	if err := apiTokens.Flush(); err != nil {
+		slog.Warn("failed to save API token usage", "err", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		slog.Info("server stopped")
+	case <-ctx.Done():
+		slog.Warn("scrapes still running", "timeout", timeout)
+	}
+}
+
+// runInit prepares the data directory, migrates stored data to the current
+// format and validates all scraper configs, then exits. Deployments run it
+// once before starting new server instances; it holds the data directory
+// lock, so it can't run next to a server.
+func runInit() error {
+	for _, dir := range []string{newslettersDir, serverConfig.ConfigDir} {
+		if err := os.MkdirAll(dir, dirPerm); err != nil {
+			return fmt.Errorf("failed to create %s: %v", dir, err)
+		}
+	}
+
+	// Loading upgrades records written by older versions; saving persists that
+	list, err := LoadNewsletters()
+	if err != nil {
+		return fmt.Errorf("failed to load newsletters: %v", err)
+	}
+	if list != nil {
+		if err := SaveNewsletters(list); err != nil {
+			return fmt.Errorf("failed to migrate newsletters: %v", err)
+		}
+	}
+	slog.Info("migrated newsletters", "count", len(list))
+
+	configs, err := ListAvailableConfigs()
+	if err != nil {
+		return fmt.Errorf("failed to list configs: %v", err)
+	}
+	for _, name := range configs {
+		config, err := LoadScraperConfig(configFile(name))
+		if err == nil {
+			_, err = config.NewsletterID()
+		}
+		if err == nil && config.Timezone != "" {
+			_, err = time.LoadLocation(config.Timezone)
+		}
+		if err == nil && config.Schedule != "" {
+			_, err = ParseSchedule(config.Schedule)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid config %s: %v", name, err)
+		}
+	}
+	slog.Info("validated configs", "count", len(configs))
+
+	return nil
+}
+
+// requireReady rejects API requests until warmup finished
+func requireReady(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ready.Load() {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Server is warming up", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// healthz reports that the process is alive
+func healthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+}
+
+// readyz reports whether warmup finished and traffic can be routed here
+func readyz(w http.ResponseWriter, r *http.Request) {
+	if !ready.Load() {
+		http.Error(w, "warming up", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ready\n"))
+}
+
+// listen returns the socket passed by systemd socket activation (LISTEN_FDS)
+// or, without one, a new listener on addr
+func listen(addr string) (net.Listener, error) {
+	pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	fds, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if pid != os.Getpid() || fds < 1 {
+		return net.Listen("tcp", addr)
+	}
+
+	// Don't hand the socket on to child processes such as Chrome
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	// Passed descriptors start at 3; only the first is used
+	f := os.NewFile(3, "systemd-socket")
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socket from systemd: %v", err)
+	}
+	return l, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// dataLockFile is locked by the process that owns the data directory
+var dataLockFile = dataPath(".lock")
+
+// dataLock keeps the lock file open, and so locked, until the process exits
+var dataLock *os.File
+
+// lockDataDir makes this process the only one using the data directory, so
+// a second server or command started against it fails fast instead of
+// racing the first on the database and downloads. The lock file holds the
+// owner's PID; the lock itself is released by the OS when the process
+// exits, even after a crash.
+func lockDataDir() error {
+	if err := os.MkdirAll(serverConfig.DataDir, dirPerm); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dataLockFile, os.O_RDWR|os.O_CREATE, filePerm)
+	if err != nil {
+		return err
+	}
+	locked, err := tryLock(f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to lock %s: %v", dataLockFile, err)
+	}
+	if !locked {
+		owner := make([]byte, 32)
+		n, _ := f.ReadAt(owner, 0)
+		f.Close()
+		return fmt.Errorf("data directory %s is in use by another process (pid %s); stop it or set DATA_DIR", serverConfig.DataDir, strings.TrimSpace(string(owner[:n])))
+	}
+
+	f.Truncate(0)
+	f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	dataLock = f
+	return nil
+}
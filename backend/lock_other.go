@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import (
+	"log/slog"
+	"os"
+)
+
+// tryLock can't lock on this platform; the data directory is unprotected
+func tryLock(f *os.File) (bool, error) {
+	slog.Warn("data directory locking is not supported on this platform")
+	return true, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// requestIDHeader carries the request ID, both ways: a proxy in front of the
+// server may set it, and every response echoes it
+const requestIDHeader = "X-Request-ID"
+
+// requestIDRe limits the request IDs accepted from clients, so they can't
+// inject anything into the logs
+var requestIDRe = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type loggerKey struct{}
+type requestIDKey struct{}
+
+// setupLogging installs the default slog logger, configured from env:
+//
+//	LOG_FORMAT  text (default) or json
+//	LOG_LEVEL   debug, info (default), warn or error
+//
+// Anything still written with the log package goes through the same handler.
+func setupLogging() {
+	var level slog.Level
+	var warnings []string
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := level.UnmarshalText([]byte(v)); err != nil {
+			warnings = append(warnings, "LOG_LEVEL "+v)
+			level = slog.LevelInfo
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch v := strings.ToLower(os.Getenv("LOG_FORMAT")); v {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	default:
+		warnings = append(warnings, "LOG_FORMAT "+v)
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+
+	for _, w := range warnings {
+		slog.Warn("invalid logging setting, using the default", "setting", w)
+	}
+}
+
+// fatalf logs an error and exits, like log.Fatalf but at error level
+func fatalf(format string, args ...interface{}) {
+	slog.Error(fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+// withLogger returns a context whose logger is l
+func withLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// logFrom returns the logger of ctx, or the default logger
+func logFrom(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// requestID returns the ID assigned to the request ctx belongs to, if any
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// statusRecorder remembers the status a handler answered with
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Flush keeps streaming responses working through the recorder
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// logRequests assigns every request an ID, makes a logger carrying it
+// available to handlers and logs the request once it is answered
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDRe.MatchString(id) {
+			var err error
+			if id, err = randomHex(8); err != nil {
+				id = "unknown"
+			}
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		logger := slog.Default().With("request_id", id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		ctx = withLogger(ctx, logger)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case rec.status >= 500:
+			level = slog.LevelError
+		case r.URL.Path == "/healthz" || r.URL.Path == "/readyz":
+			// Orchestration polls these constantly
+			level = slog.LevelDebug
+		}
+		logger.Log(ctx, level, "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration", time.Since(start))
+	})
+}
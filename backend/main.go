@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -12,99 +18,381 @@ import (
 
 // Newsletter represents a supermarket newsletter/catalog
 type Newsletter struct {
-	ID          string    `json:"id"`
-	Store       string    `json:"store"`
-	Title       string    `json:"title"`
-	ValidFrom   string    `json:"validFrom"`
-	ValidUntil  string    `json:"validUntil"`
-	CoverImage  string    `json:"coverImage"`
-	Pages       []Page    `json:"pages"`
-	LastUpdated time.Time `json:"lastUpdated"`
+	ID               string    `json:"id"`
+	ConfigID         string    `json:"configId,omitempty"`
+	Store            string    `json:"store"`
+	Title            string    `json:"title"`
+	OriginalTitle    string    `json:"originalTitle"`
+	TitleEN          string    `json:"titleEn,omitempty"`
+	ValidFrom        string    `json:"validFrom"`
+	ValidUntil       string    `json:"validUntil"`
+	CoverImage       string    `json:"coverImage"`
+	CoverThumbnail   string    `json:"coverThumbnail,omitempty"`
+	ViewerURL        string    `json:"viewerUrl,omitempty"`
+	Category         string    `json:"category,omitempty"`
+	Theme            string    `json:"theme,omitempty"`
+	Supersedes       []string  `json:"supersedes,omitempty"`
+	SupersededBy     string    `json:"supersededBy,omitempty"`
+	Pages            []Page    `json:"pages"`
+	PageCount        int       `json:"pageCount,omitempty"` // pages the catalog has, when known
+	LastUpdated      time.Time `json:"lastUpdated"`
+	ExtractorVersion int       `json:"extractorVersion"`
+	// Validity is computed for responses, see localizeNewsletter
+	Validity *Validity `json:"validity,omitempty"`
 }
 
 // Page represents a single page of a newsletter
 type Page struct {
 	PageNumber int    `json:"pageNumber"`
 	ImageURL   string `json:"imageUrl"`
+	// Scaled-down copies of the image, see imageVariants
+	ThumbnailURL string `json:"thumbnailUrl,omitempty"`
+	MediumURL    string `json:"mediumUrl,omitempty"`
 }
 
-var newsletters []Newsletter
+// translator translates scraped titles; nil disables translation
+var translator Translator
 
 func main() {
-	// Create router
+	setupLogging()
+
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		if err := runDoctor(); err != nil {
+			fatalf("Doctor: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "gen-client" {
+		if err := runGenClient(os.Args[2:]); err != nil {
+			fatalf("Client generation failed: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "contract" {
+		if err := runContract(os.Args[2:]); err != nil {
+			fatalf("Contract: %v", err)
+		}
+		return
+	}
+
+	// Everything below writes to the data directory
+	if err := lockDataDir(); err != nil {
+		fatalf("%v", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		if err := runInit(); err != nil {
+			fatalf("Init failed: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate-layout" {
+		if err := runMigrateLayout(os.Args[2:]); err != nil {
+			fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(os.Args[2:]); err != nil {
+			fatalf("Import failed: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "backfill-ocr" {
+		if err := runBackfillCommand(os.Args[2:]); err != nil {
+			fatalf("Backfill failed: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "thumbnails" {
+		if err := runThumbnailsCommand(os.Args[2:]); err != nil {
+			fatalf("Thumbnails failed: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate-ids" {
+		if err := runMigrateIDs(os.Args[2:]); err != nil {
+			fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	once := flag.Bool("once", false, "scrape all due stores, print a JSON summary and exit")
+	demo := flag.Bool("demo", false, "seed bundled demo catalogs and never touch the network")
+	flag.Parse()
+	demoMode = *demo
+	if *once {
+		signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		err := runOnce(signals)
+		stop()
+		if err != nil {
+			fatalf("Run failed: %v", err)
+		}
+		return
+	}
+
+	r := newRouter()
+
+	// Warm up in the background so liveness checks pass while storage loads
+	go func() {
+		if err := warmup(); err != nil {
+			fatalf("Warmup failed: %v", err)
+		}
+		if *demo {
+			if err := seedDemoData(); err != nil {
+				fatalf("Failed to seed demo data: %v", err)
+			}
+		}
+		ready.Store(true)
+		if !*demo {
+			startCanaryLoop()
+			startScheduler()
+			startDatasetLoop()
+			startJanitor()
+		}
+	}()
+
+	// Enable CORS for development; every request is logged with its ID
+	handler := logRequests(enableCORS(r))
+
+	// Start server
+	port := ":" + serverConfig.Port
+	listener, err := listen(port)
+	if err != nil {
+		fatalf("Failed to listen: %v", err)
+	}
+	slog.Info("server starting", "url", "http://"+listener.Addr().String())
+
+	srv := &http.Server{Handler: handler}
+	go func() {
+		if err := srv.Serve(listener); err != http.ErrServerClosed {
+			fatalf("Server failed: %v", err)
+		}
+	}()
+
+	// Stop gracefully on SIGINT/SIGTERM, so restarts don't leave
+	// half-written newsletters or orphaned Chrome processes behind
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-signals.Done()
+	stop()
+	slog.Info("shutting down")
+	shutdown(srv)
+}
+
+// newRouter routes every API, page and file the server serves
+func newRouter() *mux.Router {
 	r := mux.NewRouter()
+	r.Use(instrumentRoutes)
 
 	// API routes
 	api := r.PathPrefix("/api").Subrouter()
-	api.HandleFunc("/newsletters", getNewsletters).Methods("GET")
-	api.HandleFunc("/newsletters/{id}", getNewsletter).Methods("GET")
+	api.HandleFunc("/newsletters", cached(getNewsletters)).Methods("GET")
+	api.HandleFunc("/newsletters/{id}", cached(getNewsletter)).Methods("GET")
+	api.HandleFunc("/newsletters/{id}/prefetch", getPrefetchHints).Methods("GET")
+	api.HandleFunc("/newsletters/{id}/provenance", getProvenance).Methods("GET")
+	api.HandleFunc("/newsletters/{id}/products", getNewsletterProducts).Methods("GET")
 	api.HandleFunc("/scrape/{store}", scrapeStore).Methods("POST")
+	api.HandleFunc("/jobs/{id}", getJob).Methods("GET")
+	api.HandleFunc("/schedule", getSchedule).Methods("GET")
+	api.HandleFunc("/groups", getGroups).Methods("GET")
+	api.HandleFunc("/groups/{id}", getGroup).Methods("GET")
+	api.HandleFunc("/groups/{id}/newsletters", getGroupNewsletters).Methods("GET")
+	api.HandleFunc("/compare/pages", comparePages).Methods("GET")
+	api.HandleFunc("/search", cached(searchHandler)).Methods("GET")
+	api.HandleFunc("/offers/export", exportOffers).Methods("GET")
 	api.HandleFunc("/stores", getStores).Methods("GET")
+	api.HandleFunc("/stores/discover", discoverStoreHandler).Methods("POST")
+	api.HandleFunc("/config/client", cached(getClientConfig)).Methods("GET")
+	api.HandleFunc("/stores/{store}/overview", cached(getStoreOverview)).Methods("GET")
+	api.HandleFunc("/stores/{store}/newsletters", cached(getStoreNewsletters)).Methods("GET")
+	api.HandleFunc("/assets", getAsset).Methods("GET")
+	api.HandleFunc("/widget/latest", cached(getWidgetLatest)).Methods("GET")
+	api.HandleFunc("/share", createShare).Methods("POST")
+	api.HandleFunc("/tokens", createToken).Methods("POST")
+	api.HandleFunc("/tokens/{id}", getTokenUsage).Methods("GET")
+	api.HandleFunc("/tokens/{id}", revokeToken).Methods("DELETE")
+	api.Use(limitRate)
+	api.Use(requireReady)
+	api.Use(tokenAuth)
 
-	// Serve newsletter images
-	r.PathPrefix("/newsletters/").Handler(http.StripPrefix("/newsletters/", http.FileServer(http.Dir("../newsletters"))))
+	// Admin routes answer only requests with ADMIN_TOKEN
+	admin := api.PathPrefix("/admin").Subrouter()
+	admin.HandleFunc("/quality", getQualityReport).Methods("GET")
+	admin.HandleFunc("/outdated", getOutdatedNewsletters).Methods("GET")
+	admin.HandleFunc("/outdated/rescrape", rescrapeOutdated).Methods("POST")
+	admin.HandleFunc("/outbox", getOutbox).Methods("GET")
+	admin.HandleFunc("/opt-outs", getOptOuts).Methods("GET")
+	admin.HandleFunc("/opt-outs", createOptOut).Methods("POST")
+	admin.HandleFunc("/opt-outs/{store}", deleteOptOut).Methods("DELETE")
+	admin.HandleFunc("/newsletters", createManualNewsletter).Methods("POST")
+	admin.HandleFunc("/newsletters/{id}", updateManualNewsletter).Methods("PUT")
+	admin.HandleFunc("/newsletters/{id}", deleteManualNewsletter).Methods("DELETE")
+	admin.HandleFunc("/stores/{store}/rollback", rollbackStoreHandler).Methods("POST")
+	admin.HandleFunc("/canary", getCanaryResults).Methods("GET")
+	admin.HandleFunc("/canary", runCanariesNow).Methods("POST")
+	admin.HandleFunc("/review", getReviewQueue).Methods("GET")
+	admin.HandleFunc("/backfill", getBackfill).Methods("GET")
+	admin.HandleFunc("/backfill", startBackfillHandler).Methods("POST")
+	admin.HandleFunc("/cleanup", getCleanupReport).Methods("GET")
+	admin.HandleFunc("/cleanup", runCleanup).Methods("POST")
+	admin.HandleFunc("/costs", getCosts).Methods("GET")
+	admin.HandleFunc("/review/{id}/{page}/{index}", reviewOffer).Methods("POST")
+	admin.Use(requireAdmin)
 
-	// Serve static files (frontend)
-	r.PathPrefix("/").Handler(http.FileServer(http.Dir("../frontend")))
+	// Health checks for orchestration
+	r.HandleFunc("/healthz", healthz).Methods("GET")
+	r.HandleFunc("/metrics", getMetrics).Methods("GET")
+	r.HandleFunc("/readyz", readyz).Methods("GET")
 
-	// Enable CORS for development
-	handler := enableCORS(r)
+	// Public status page
+	r.HandleFunc("/status", getStatus).Methods("GET")
 
-	// Start server
-	port := ":8080"
-	log.Printf("Server starting on http://localhost%s", port)
-	log.Fatal(http.ListenAndServe(port, handler))
+	// Short share links
+	r.HandleFunc("/s/{token}", openShare).Methods("GET")
+
+	// Published price datasets
+	r.PathPrefix("/datasets/").Handler(http.StripPrefix("/datasets/", http.FileServer(http.Dir(datasetsDir)))).Methods("GET", "HEAD")
+
+	// Serve newsletter images
+	r.PathPrefix("/newsletters/").HandlerFunc(serveNewsletterImage).Methods("GET", "HEAD")
+
+	// Serve static files (frontend)
+	r.PathPrefix("/").Handler(http.FileServer(http.Dir(serverConfig.FrontendDir)))
+	return r
 }
 
 // API Handlers
 func getNewsletters(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(newsletters)
+	q := r.URL.Query()
+	category := q.Get("category")
+	theme := q.Get("theme")
+	store := q.Get("store")
+
+	day := q.Get("validOn")
+	if day != "" {
+		if _, err := time.Parse("2006-01-02", day); err != nil {
+			http.Error(w, "Invalid validOn, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+	if q.Get("activeOnly") == "true" {
+		today := time.Now().Format("2006-01-02")
+		if day != "" && day != today {
+			http.Error(w, "validOn and activeOnly are mutually exclusive", http.StatusBadRequest)
+			return
+		}
+		day = today
+	}
+
+	result := newsletters.List()
+	if category != "" || theme != "" || store != "" || day != "" {
+		all := result
+		result = nil
+		for _, n := range all {
+			if (category == "" || n.Category == category) && (theme == "" || n.Theme == theme) &&
+				(store == "" || strings.EqualFold(n.Store, store)) && (day == "" || validOn(n, day)) {
+				result = append(result, n)
+			}
+		}
+	}
+
+	writeNewsletterList(w, r, result)
 }
 
 func getNewsletter(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	for _, newsletter := range newsletters {
-		if newsletter.ID == id {
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(newsletter)
-			return
-		}
+	newsletter, ok := newsletters.Get(id)
+	if !ok {
+		http.Error(w, "Newsletter not found", http.StatusNotFound)
+		return
+	}
+	opts, err := parseDetailOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	http.Error(w, "Newsletter not found", http.StatusNotFound)
+	lang := preferredLanguage(r.Header.Get("Accept-Language"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Add("Vary", "Accept-Language")
+	// Reviews and OCR backfills change products without a new LastUpdated
+	if !opts.products {
+		setValidators(w, []Newsletter{newsletter}, lang+" "+r.URL.RawQuery)
+	}
+	json.NewEncoder(w).Encode(newsletterDetail(localizeNewsletter(newsletter, lang), opts))
+}
+
+// ScrapeStarted is the response to POST /api/scrape/{config}
+type ScrapeStarted struct {
+	Message string `json:"message"`
+	Status  string `json:"status"`
+	JobID   string `json:"jobId"`
+	Job     Job    `json:"job"`
 }
 
 func scrapeStore(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	configName := vars["store"]
 
-	log.Printf("Starting scraper for config: %s", configName)
+	opts := ScrapeOptions{
+		Record:    r.URL.Query().Get("record") == "true",
+		Replay:    r.URL.Query().Get("replay") == "true",
+		Force:     r.URL.Query().Get("force") == "true",
+		CoverOnly: r.URL.Query().Get("coverOnly") == "true",
+	}
+	if opts.Record && opts.Replay {
+		http.Error(w, "record and replay are mutually exclusive", http.StatusBadRequest)
+		return
+	}
+	if opts.CoverOnly && (opts.Record || opts.Replay || opts.Force) {
+		http.Error(w, "coverOnly can't be combined with record, replay or force", http.StatusBadRequest)
+		return
+	}
 
-	// Run the scraper in a goroutine since it might take a while
-	go func() {
-		configPath := fmt.Sprintf("configs/%s.json", configName)
-		err := ScrapeAndDownloadFromConfig(configPath)
-		if err != nil {
-			log.Printf("Error scraping with config %s: %v", configName, err)
-			return
-		}
+	config, err := LoadScraperConfig(configFile(configName + ".json"))
+	if err != nil {
+		http.Error(w, "Config not found", http.StatusNotFound)
+		return
+	}
+	if optOuts.IsOptedOut(config.StoreName()) {
+		http.Error(w, fmt.Sprintf("Store %s opted out of archiving", config.StoreName()), http.StatusConflict)
+		return
+	}
 
-		log.Printf("Successfully scraped with config %s", configName)
-	}()
+	// Run the scraper as a background job since it might take a while
+	opts.RequestID = requestID(r.Context())
+	job, err := scrapeJobs.Start(configName, configFile(configName+".json"), opts)
+	if err == errShuttingDown {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error starting scrape", http.StatusInternalServerError)
+		return
+	}
 
 	// Return immediately to avoid timeout
-	response := map[string]interface{}{
-		"message": fmt.Sprintf("Scraping with config %s started in background. This may take a few minutes.", configName),
-		"status":  "processing",
+	response := ScrapeStarted{
+		Message: fmt.Sprintf("Scraping with config %s started in background. This may take a few minutes.", configName),
+		Status:  "processing",
+		JobID:   job.ID,
+		Job:     job,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(response)
 }
 
+// StoreList is the response to GET /api/stores
+type StoreList struct {
+	Configs []string          `json:"configs"`
+	Logos   map[string]string `json:"logos"`
+	Stores  []StoreInfo       `json:"stores"`
+}
+
 func getStores(w http.ResponseWriter, r *http.Request) {
 	configs, err := ListAvailableConfigs()
 	if err != nil {
@@ -112,10 +400,41 @@ func getStores(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	stores, err := ListAvailableStores()
+	if err != nil {
+		http.Error(w, "Error loading configs", http.StatusInternalServerError)
+		return
+	}
+
+	// Store logos are served through the asset proxy so the frontend never hotlinks them
+	logos := map[string]string{}
+	infos := make([]StoreInfo, 0, len(stores))
+	for _, store := range stores {
+		if store.LogoURL != "" {
+			store.LogoURL = proxiedAssetURL(store.LogoURL)
+			logos[store.Name] = store.LogoURL
+		}
+		infos = append(infos, storeInfo(store))
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"configs": configs,
-	})
+	json.NewEncoder(w).Encode(StoreList{Configs: configs, Logos: logos, Stores: infos})
+}
+
+func getStoreNewsletters(w http.ResponseWriter, r *http.Request) {
+	store := mux.Vars(r)["store"]
+	if !knownStore(store) {
+		http.Error(w, "Store not found", http.StatusNotFound)
+		return
+	}
+
+	var result []Newsletter
+	for _, n := range newsletters.List() {
+		if n.Store == store {
+			result = append(result, n)
+		}
+	}
+	writeNewsletterList(w, r, result)
 }
 
 func scrapeLidl(w http.ResponseWriter, r *http.Request) {
@@ -124,19 +443,3 @@ func scrapeLidl(w http.ResponseWriter, r *http.Request) {
 	r = mux.SetURLVars(r, vars)
 	scrapeStore(w, r)
 }
-
-// CORS middleware
-func enableCORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testServer is the server's handler over an empty data directory
+var testServer http.Handler
+
+// TestMain runs the tests against a temporary data directory. Paths are
+// derived from DATA_DIR when the package loads, so the test binary runs
+// itself again with DATA_DIR and CONFIG_DIR pointing there.
+func TestMain(m *testing.M) {
+	if os.Getenv("BESTDEAL_TEST_DATA") == "" {
+		os.Exit(runWithTempData())
+	}
+
+	setupLogging()
+	if err := warmup(); err != nil {
+		fatalf("Warmup failed: %v", err)
+	}
+	ready.Store(true)
+	testServer = logRequests(enableCORS(newRouter()))
+	os.Exit(m.Run())
+}
+
+// runWithTempData runs the test binary with the same arguments over a new
+// data directory and returns its exit code
+func runWithTempData() int {
+	dir, err := os.MkdirTemp("", "bestdeal-test-")
+	if err != nil {
+		fatalf("Failed to create data directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	configs := filepath.Join(dir, "configs")
+	if err := os.Mkdir(configs, dirPerm); err != nil {
+		fatalf("Failed to create config directory: %v", err)
+	}
+
+	cmd := exec.Command(os.Args[0], os.Args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"BESTDEAL_TEST_DATA=true", "DATA_DIR="+dir, "CONFIG_DIR="+configs,
+		"LOG_LEVEL=error", "RATE_LIMIT=0", "SCRAPE_RATE_LIMIT=0", "ADMIN_TOKEN=test-admin")
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		if exit, ok := err.(*exec.ExitError); ok {
+			return exit.ExitCode()
+		}
+		fatalf("Failed to run tests: %v", err)
+	}
+	return 0
+}
+
+// request sends a request to testServer; header is alternating names and
+// values
+func request(t *testing.T, method, path, body string, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	testServer.ServeHTTP(w, req)
+	return w
+}
+
+// decodeJSON decodes a JSON response, failing unless it has status and a
+// JSON content type
+func decodeJSON(t *testing.T, w *httptest.ResponseRecorder, status int) interface{} {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status %d, want %d: %s", w.Code, status, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("Content-Type %q, want application/json", ct)
+	}
+	var v interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatalf("invalid JSON %q: %v", w.Body, err)
+	}
+	return v
+}
+
+// withNewsletters serves list for the rest of the test instead of the
+// stored newsletters
+func withNewsletters(t *testing.T, list []Newsletter) {
+	t.Helper()
+	saved := newsletters.List()
+	newsletters.load(list)
+	apiCache.invalidate()
+	t.Cleanup(func() {
+		newsletters.load(saved)
+		apiCache.invalidate()
+	})
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// maxManualPages caps the images of a newsletter added by hand
+const maxManualPages = 200
+
+// manualNewsletterRequest is the body of POST /api/admin/newsletters and
+// PUT /api/admin/newsletters/{id}: a catalog the scraper misses, with the
+// URLs of its page images in order
+type manualNewsletterRequest struct {
+	ID         string   `json:"id"`
+	Store      string   `json:"store"`
+	Title      string   `json:"title"`
+	ValidFrom  string   `json:"validFrom"`
+	ValidUntil string   `json:"validUntil"`
+	Images     []string `json:"images"`
+	ViewerURL  string   `json:"viewerUrl"`
+	Locale     string   `json:"locale"`
+}
+
+// Validate checks the request and defaults the ID to store and valid from
+func (req *manualNewsletterRequest) Validate() *ValidationError {
+	req.Store = strings.TrimSpace(req.Store)
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Store == "" {
+		return fieldError("store", "is required")
+	}
+	if !storeNameRe.MatchString(req.Store) {
+		return fieldError("store", "must be lowercase letters and digits")
+	}
+	if req.Title == "" {
+		return fieldError("title", "is required")
+	}
+
+	from, err := time.Parse("2006-01-02", req.ValidFrom)
+	if err != nil {
+		return fieldError("validFrom", "must be a date like 2026-02-09")
+	}
+	until, err := time.Parse("2006-01-02", req.ValidUntil)
+	if err != nil {
+		return fieldError("validUntil", "must be a date like 2026-02-15")
+	}
+	if until.Before(from) {
+		return fieldError("validUntil", "must not be before validFrom")
+	}
+
+	if len(req.Images) == 0 {
+		return fieldError("images", "at least one image URL is required")
+	}
+	if len(req.Images) > maxManualPages {
+		return fieldError("images", "at most %d images are allowed", maxManualPages)
+	}
+	for i, raw := range req.Images {
+		if !absoluteHTTPURL(raw) {
+			return fieldError(fmt.Sprintf("images[%d]", i), "must be an absolute http or https URL")
+		}
+	}
+	if req.ViewerURL != "" && !absoluteHTTPURL(req.ViewerURL) {
+		return fieldError("viewerUrl", "must be an absolute http or https URL")
+	}
+
+	if req.ID == "" {
+		req.ID = req.Store + "-" + req.ValidFrom
+	}
+	if slugify(req.ID) != req.ID {
+		return fieldError("id", "must be lowercase letters, digits and dashes")
+	}
+	return nil
+}
+
+func absoluteHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// config describes the request as a scraper config, so the newsletter is
+// built like a scraped one
+func (req *manualNewsletterRequest) config() *ScraperConfig {
+	return &ScraperConfig{
+		ID:         req.ID,
+		Store:      req.Store,
+		Title:      req.Title,
+		ValidFrom:  req.ValidFrom,
+		ValidUntil: req.ValidUntil,
+		Locale:     req.Locale,
+	}
+}
+
+// storeManualNewsletter downloads the images of a newsletter added by hand
+// and registers it, replacing previous if it is being edited. Like a
+// scrape, it can be rolled back with the store's rollback.
+func storeManualNewsletter(ctx context.Context, req *manualNewsletterRequest, previous *Newsletter) (n Newsletter, err error) {
+	config := req.config()
+	baseDir := newsletterDir(dataLayout(), req.Store, req.ID, req.ValidFrom)
+	pagesDir := filepath.Join(baseDir, "pages")
+
+	snapshot, err := snapshotStore(req.Store, req.ID, baseDir)
+	if err != nil {
+		return n, fmt.Errorf("failed to snapshot %s: %v", req.Store, err)
+	}
+	defer func() {
+		if err != nil {
+			snapshot.restore()
+		} else {
+			snapshot.commit()
+		}
+	}()
+
+	if err := os.MkdirAll(pagesDir, dirPerm); err != nil {
+		return n, fmt.Errorf("failed to create directories: %v", err)
+	}
+
+	logger := logFrom(ctx).With("newsletter", req.ID)
+	var downloaded []string
+	for i, imageURL := range req.Images {
+		if ctx.Err() != nil {
+			return n, ctx.Err()
+		}
+		pageNum := i + 1
+		imagePath := filepath.Join(pagesDir, fmt.Sprintf("page-%03d.jpg", pageNum))
+		if err := downloadImage(imageURL, imagePath); err != nil {
+			return n, &ValidationError{Field: fmt.Sprintf("images[%d]", i), Message: fmt.Sprintf("download failed: %v", err), status: http.StatusUnprocessableEntity}
+		}
+		// Decoding for the size variants rejects anything that isn't an image
+		if err := generateVariants(imagePath); err != nil {
+			return n, &ValidationError{Field: fmt.Sprintf("images[%d]", i), Message: fmt.Sprintf("not a usable image: %v", err), status: http.StatusUnprocessableEntity}
+		}
+		downloaded = append(downloaded, imagePath)
+		logger.Debug("downloaded page", "page", pageNum)
+	}
+
+	coverPath := filepath.Join(baseDir, "cover-image.jpg")
+	if err := copyFile(downloaded[0], coverPath); err != nil {
+		return n, fmt.Errorf("failed to save cover image: %v", err)
+	}
+	if err := generateVariants(coverPath); err != nil {
+		logger.Warn("failed to resize cover image", "err", err)
+	}
+
+	n = buildNewsletter(config, req.ID, baseDir, downloaded)
+	n.PageCount = len(downloaded)
+	n.ViewerURL = req.ViewerURL
+	prewarmImages(n)
+	if err := registerNewsletter(n); err != nil {
+		return n, fmt.Errorf("failed to save newsletter metadata: %v", err)
+	}
+
+	// An edit that moved the newsletter to another directory leaves the
+	// old one behind
+	if previous != nil {
+		if old := dataDir(*previous); old != baseDir {
+			os.RemoveAll(old)
+		}
+	}
+	return n, nil
+}
+
+// deleteNewsletter removes a newsletter and everything stored for it,
+// emitting newsletter.deleted. The store's rollback version is discarded,
+// since it would bring it back.
+func deleteNewsletter(n Newsletter) ([]string, error) {
+	kept := []Newsletter{}
+	for _, other := range newsletters.List() {
+		if other.Store == n.Store && other.ID != n.ID {
+			kept = append(kept, other)
+		}
+	}
+
+	if err := replaceStoreNewsletters(n.Store, kept); err != nil {
+		return nil, fmt.Errorf("failed to save newsletters of %s: %v", n.Store, err)
+	}
+	removeStoreSnapshot(n.Store)
+	return removeExpiredData(n, kept), nil
+}
+
+// API Handlers
+
+// lockStoreFor takes the lock of a store for an admin change, answering
+// 409 when a scrape or rollback holds it
+func lockStoreFor(w http.ResponseWriter, store string) (unlock func(), ok bool) {
+	if optOuts.IsOptedOut(store) {
+		http.Error(w, fmt.Sprintf("Store %s opted out of archiving", store), http.StatusConflict)
+		return nil, false
+	}
+	lock := storeLock(store)
+	if !lock.TryLock() {
+		http.Error(w, "A scrape of this store is running", http.StatusConflict)
+		return nil, false
+	}
+	return lock.Unlock, true
+}
+
+// writeManualNewsletter stores a newsletter added or edited by hand and
+// sends it with status
+func writeManualNewsletter(w http.ResponseWriter, r *http.Request, req *manualNewsletterRequest, previous *Newsletter, status int) {
+	n, err := storeManualNewsletter(r.Context(), req, previous)
+	if verr, ok := err.(*ValidationError); ok {
+		writeValidationError(w, verr)
+		return
+	}
+	if err != nil {
+		logFrom(r.Context()).Error("failed to store newsletter", "newsletter", req.ID, "err", err)
+		http.Error(w, "Error storing newsletter", http.StatusInternalServerError)
+		return
+	}
+	logFrom(r.Context()).Info("stored newsletter added by hand", "newsletter", n.ID, "store", n.Store, "pages", len(n.Pages))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(n)
+}
+
+func createManualNewsletter(w http.ResponseWriter, r *http.Request) {
+	var req manualNewsletterRequest
+	if err := decodeJSONBody(w, r, &req); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	unlock, ok := lockStoreFor(w, req.Store)
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	if _, exists := newsletters.Get(req.ID); exists {
+		http.Error(w, fmt.Sprintf("Newsletter %s already exists", req.ID), http.StatusConflict)
+		return
+	}
+	writeManualNewsletter(w, r, &req, nil, http.StatusCreated)
+}
+
+func updateManualNewsletter(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var req manualNewsletterRequest
+	if err := decodeJSONBody(w, r, &req); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if req.ID != "" && req.ID != id {
+		writeValidationError(w, fieldError("id", "must match the ID in the path"))
+		return
+	}
+	req.ID = id
+	if err := req.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	unlock, ok := lockStoreFor(w, req.Store)
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	previous, exists := newsletters.Get(id)
+	if !exists {
+		http.Error(w, "Newsletter not found", http.StatusNotFound)
+		return
+	}
+	if previous.Store != req.Store {
+		writeValidationError(w, fieldError("store", "can't be changed, delete the newsletter and add it again"))
+		return
+	}
+	writeManualNewsletter(w, r, &req, &previous, http.StatusOK)
+}
+
+func deleteManualNewsletter(w http.ResponseWriter, r *http.Request) {
+	n, exists := newsletters.Get(mux.Vars(r)["id"])
+	if !exists {
+		http.Error(w, "Newsletter not found", http.StatusNotFound)
+		return
+	}
+
+	lock := storeLock(n.Store)
+	if !lock.TryLock() {
+		http.Error(w, "A scrape of this store is running", http.StatusConflict)
+		return
+	}
+	defer lock.Unlock()
+
+	left, err := deleteNewsletter(n)
+	if err != nil {
+		logFrom(r.Context()).Error("failed to delete newsletter", "newsletter", n.ID, "err", err)
+		http.Error(w, "Error deleting newsletter", http.StatusInternalServerError)
+		return
+	}
+	if len(left) > 0 {
+		logFrom(r.Context()).Warn("deleted newsletter, but files were left", "newsletter", n.ID, "files_left", left)
+	} else {
+		logFrom(r.Context()).Info("deleted newsletter", "newsletter", n.ID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pngBytes encodes a small PNG, declaring width x height in its header when
+// they are given
+func pngBytes(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if width > 0 {
+		// IHDR follows the 8 byte signature; its data starts after the
+		// length and type and is followed by the CRC of type and data
+		binary.BigEndian.PutUint32(data[16:], uint32(width))
+		binary.BigEndian.PutUint32(data[20:], uint32(height))
+		binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	}
+	return data
+}
+
+func TestDownloadImage(t *testing.T) {
+	bodies := map[string][]byte{
+		"/page.png":  pngBytes(t, 0, 0),
+		"/page.html": []byte("<!DOCTYPE html><html><body>Not found</body></html>"),
+		"/huge.jpg":  append([]byte{0xff, 0xd8, 0xff}, make([]byte, maxImageSize)...),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := bodies[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		// Claim an image either way; only the content counts
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		path    string
+		wantErr string
+	}{
+		{"/page.png", ""},
+		{"/page.html", "want a JPEG or PNG image"},
+		{"/huge.jpg", "image larger than"},
+		{"/missing.jpg", "HTTP 404"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "page-001.jpg")
+			err := downloadImage(server.URL+tt.path, path)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("downloadImage: %v", err)
+				}
+				if _, err := decodeImageFile(path); err != nil {
+					t.Fatalf("downloaded image doesn't decode: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("downloadImage error %v, want %q", err, tt.wantErr)
+			}
+			if _, err := os.Stat(path); err == nil {
+				t.Errorf("rejected image was written")
+			}
+		})
+	}
+}
+
+// TestDecodeImageFileRejectsHugeImages decodes a file that declares far more
+// pixels than it holds, which must fail before decoding
+func TestDecodeImageFileRejectsHugeImages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bomb.png")
+	if err := os.WriteFile(path, pngBytes(t, 100000, 100000), filePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decodeImageFile(path); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("decodeImageFile error %v, want image too large", err)
+	}
+	if err := generateVariants(path); err == nil {
+		t.Fatalf("generateVariants accepted the image")
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Metrics in the Prometheus text format, served on /metrics. The few
+// metric types needed are implemented here rather than pulling in the
+// Prometheus client library.
+
+// metric is anything that writes its samples in the text format
+type metric interface {
+	write(w io.Writer)
+}
+
+// metricsRegistry holds the metrics served on /metrics
+type metricsRegistry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+var metrics = &metricsRegistry{}
+
+func (reg *metricsRegistry) register(m metric) {
+	reg.mu.Lock()
+	reg.metrics = append(reg.metrics, m)
+	reg.mu.Unlock()
+}
+
+// writeTo writes every metric in the text exposition format
+func (reg *metricsRegistry) writeTo(w io.Writer) {
+	reg.mu.Lock()
+	list := append([]metric(nil), reg.metrics...)
+	reg.mu.Unlock()
+	for _, m := range list {
+		m.write(w)
+	}
+}
+
+// labelSet renders label names and values as {a="x",b="y"}
+func labelSet(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sortedKeys returns the keys of series in a stable order
+func sortedKeys[V any](series map[string]V) []string {
+	keys := make([]string, 0, len(series))
+	for k := range series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Counter
+
+// counterVec is a counter with one series per combination of label values
+type counterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	series map[string]float64
+}
+
+func newCounter(name, help string, labels ...string) *counterVec {
+	c := &counterVec{name: name, help: help, labels: labels, series: map[string]float64{}}
+	metrics.register(c)
+	return c
+}
+
+// add increases the series of the label values by v
+func (c *counterVec) add(v float64, values ...string) {
+	key := strings.Join(values, "\x00")
+	c.mu.Lock()
+	c.series[key] += v
+	c.mu.Unlock()
+}
+
+func (c *counterVec) inc(values ...string) {
+	c.add(1, values...)
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range sortedKeys(c.series) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labelSet(c.labels, splitKey(key, len(c.labels))), formatValue(c.series[key]))
+	}
+}
+
+// splitKey turns a series key back into label values
+func splitKey(key string, n int) []string {
+	if n == 0 {
+		return nil
+	}
+	return strings.Split(key, "\x00")
+}
+
+// Histogram
+
+// histogramVec counts observations into buckets, per combination of label values
+type histogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64 // upper bounds, ascending
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(name, help string, buckets []float64, labels ...string) *histogramVec {
+	h := &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: map[string]*histogram{}}
+	metrics.register(h)
+	return h
+}
+
+func (h *histogramVec) observe(v float64, values ...string) {
+	key := strings.Join(values, "\x00")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series[key]
+	if s == nil {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.name, h.help, "histogram")
+	names := append(append([]string(nil), h.labels...), "le")
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		values := splitKey(key, len(h.labels))
+		withLe := func(le string) []string {
+			return append(values[:len(values):len(values)], le)
+		}
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelSet(names, withLe(formatValue(bound))), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelSet(names, withLe("+Inf")), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelSet(h.labels, values), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelSet(h.labels, values), s.count)
+	}
+}
+
+// Gauge
+
+// gaugeFunc reads its series when /metrics is requested, for values the
+// server already tracks such as the stored newsletters
+type gaugeFunc struct {
+	name, help string
+	labels     []string
+	read       func() map[string]float64 // series keyed like counterVec
+}
+
+func newGaugeFunc(name, help string, read func() map[string]float64, labels ...string) *gaugeFunc {
+	g := &gaugeFunc{name: name, help: help, labels: labels, read: read}
+	metrics.register(g)
+	return g
+}
+
+func (g *gaugeFunc) write(w io.Writer) {
+	series := g.read()
+	writeHeader(w, g.name, g.help, "gauge")
+	for _, key := range sortedKeys(series) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, labelSet(g.labels, splitKey(key, len(g.labels))), formatValue(series[key]))
+	}
+}
+
+// The server's metrics
+
+var (
+	httpDurationBuckets   = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	scrapeDurationBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600}
+
+	httpRequests = newCounter("bestdeal_http_requests_total",
+		"HTTP requests answered, by route template, method and status.", "route", "method", "status")
+	httpDuration = newHistogram("bestdeal_http_request_duration_seconds",
+		"Time to answer HTTP requests, by route template and method.", httpDurationBuckets, "route", "method")
+
+	scrapeRuns = newCounter("bestdeal_scrape_runs_total",
+		"Scrapes finished, by store and result (succeeded, failed, skipped or changed for cover-only scrapes).", "store", "result")
+	scrapeDuration = newHistogram("bestdeal_scrape_duration_seconds",
+		"Time scrapes took, by store and result.", scrapeDurationBuckets, "store", "result")
+	catalogsFound = newCounter("bestdeal_scrape_catalogs_found_total",
+		"Catalogs scrapes stored that weren't stored before, by store.", "store")
+	pagesDownloaded = newCounter("bestdeal_scrape_pages_downloaded_total",
+		"Catalog pages scrapes downloaded, by store.", "store")
+	pageFailures = newCounter("bestdeal_scrape_page_failures_total",
+		"Catalog pages scrapes failed to download, by store.", "store")
+	budgetAborts = newCounter("bestdeal_scrape_budget_aborts_total",
+		"Scrapes aborted for going over their store's budget, by store and budget.", "store", "budget")
+	imageBytes = newCounter("bestdeal_image_download_bytes_total",
+		"Bytes of images downloaded from store sites.")
+
+	_ = newGaugeFunc("bestdeal_newsletters",
+		"Newsletters stored, by store.", newslettersByStore, "store")
+	_ = newGaugeFunc("bestdeal_scrape_jobs",
+		"Scrape jobs queued or running, by status.", jobsByStatus, "status")
+	_ = newGaugeFunc("go_goroutines",
+		"Number of goroutines that currently exist.", func() map[string]float64 {
+			return map[string]float64{"": float64(runtime.NumGoroutine())}
+		})
+	_ = newGaugeFunc("process_start_time_seconds",
+		"Start time of the process since the Unix epoch in seconds.", func() map[string]float64 {
+			return map[string]float64{"": float64(processStarted.Unix())}
+		})
+)
+
+var processStarted = time.Now()
+
+func newslettersByStore() map[string]float64 {
+	series := map[string]float64{}
+	for _, n := range newsletters.List() {
+		series[n.Store]++
+	}
+	return series
+}
+
+func jobsByStatus() map[string]float64 {
+	queued, running := scrapeJobs.Depth()
+	return map[string]float64{JobQueued: float64(queued), JobRunning: float64(running)}
+}
+
+// observeScrape records a finished scrape of store
+func observeScrape(store string, started time.Time, err error) {
+	result := "succeeded"
+	switch {
+	case err == errCatalogUnchanged:
+		result = "skipped"
+	case err == errCatalogChanged:
+		result = "changed"
+	case err != nil:
+		result = "failed"
+	}
+	scrapeRuns.inc(store, result)
+	scrapeDuration.observe(time.Since(started).Seconds(), store, result)
+}
+
+// instrumentRoutes is router middleware counting requests and timing them
+// per route template, so IDs in paths don't create a series each
+func instrumentRoutes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if tpl, err := current.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		httpRequests.inc(route, r.Method, strconv.Itoa(rec.status))
+		httpDuration.observe(time.Since(start).Seconds(), route, r.Method)
+	})
+}
+
+// API Handlers
+
+func getMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.writeTo(w)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	newslettersDir  = serverConfig.DataDir
+	newslettersFile = dataPath("newsletters.json")
+)
+
+// LoadNewsletters reads the newsletter metadata saved by previous scrapes
+func LoadNewsletters() ([]Newsletter, error) {
+	repo, err := repository()
+	if err != nil {
+		return nil, err
+	}
+	list, err := repo.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	// Fill in fields of records saved by older versions
+	for i := range list {
+		if list[i].OriginalTitle == "" {
+			list[i].OriginalTitle = list[i].Title
+		}
+		if list[i].Pages == nil {
+			list[i].Pages = []Page{}
+		}
+		if list[i].ConfigID == "" {
+			list[i].ConfigID = list[i].ID
+		}
+		if list[i].Category == "" {
+			list[i].Category, list[i].Theme = ClassifyNewsletter(list[i].Title, defaultLocale)
+		}
+	}
+	resolveOverlaps(list)
+	return list, nil
+}
+
+// SaveNewsletters replaces all stored newsletter metadata with list
+func SaveNewsletters(list []Newsletter) error {
+	repo, err := repository()
+	if err != nil {
+		return err
+	}
+	return repo.SaveAll(list)
+}
+
+// buildNewsletter creates the newsletter record for a finished scrape
+func buildNewsletter(config *ScraperConfig, id, baseDir string, pagePaths []string) Newsletter {
+	n := Newsletter{
+		ID:               id,
+		ConfigID:         config.ID,
+		Store:            config.StoreName(),
+		Title:            config.Title,
+		ValidFrom:        config.ValidFrom,
+		ValidUntil:       config.ValidUntil,
+		Pages:            []Page{},
+		LastUpdated:      time.Now(),
+		ExtractorVersion: ExtractorVersion,
+	}
+	if n.Title == "" {
+		n.Title = config.ID
+	}
+	n.OriginalTitle = n.Title
+	n.Category, n.Theme = ClassifyNewsletter(n.Title, config.Locale)
+
+	locale := config.Locale
+	if locale == "" {
+		locale = defaultLocale
+	}
+	if translator != nil && locale != "en" {
+		if translated, err := translator.Translate(n.Title, locale, "en"); err != nil {
+			slog.Warn("failed to translate title", "title", n.Title, "err", err)
+		} else {
+			n.TitleEN = translated
+		}
+	}
+
+	coverPath := filepath.Join(baseDir, "cover-image.jpg")
+	if _, err := os.Stat(coverPath); err == nil {
+		n.CoverImage = fmt.Sprintf("/newsletters/%s/cover-image.jpg", id)
+		n.CoverThumbnail = variantURL(n.CoverImage, coverPath, SizeThumbnail)
+	}
+
+	for i, path := range pagePaths {
+		filename := filepath.Base(path)
+		pageNum := i + 1
+		fmt.Sscanf(filename, "page-%d.jpg", &pageNum)
+		page := Page{
+			PageNumber: pageNum,
+			ImageURL:   fmt.Sprintf("/newsletters/%s/pages/%s", id, filename),
+		}
+		setVariantURLs(&page, path)
+		n.Pages = append(n.Pages, page)
+	}
+	if n.CoverImage == "" && len(n.Pages) > 0 {
+		n.CoverImage = n.Pages[0].ImageURL
+		n.CoverThumbnail = n.Pages[0].ThumbnailURL
+	}
+
+	return n
+}
+
+// registerNewsletter adds or replaces a newsletter and persists it
+func registerNewsletter(n Newsletter) error {
+	eventType := EventNewsletterCreated
+	if _, ok := newsletters.Get(n.ID); ok {
+		eventType = EventNewsletterUpdated
+	}
+	eventID, err := outbox.Add(eventType, n.ID, n.LastUpdated, newsletterEventPayload(n))
+	if err != nil {
+		return fmt.Errorf("failed to record %s event: %v", eventType, err)
+	}
+
+	err = newsletters.Upsert(n)
+	outbox.Settle(eventID, err == nil)
+	return err
+}
+
+// replaceStoreNewsletters replaces the newsletters of store with list,
+// recording newsletter.deleted for each one it removes and
+// newsletter.created or newsletter.updated for each one it adds or changes
+func replaceStoreNewsletters(store string, list []Newsletter) error {
+	current := map[string]Newsletter{}
+	for _, n := range newsletters.List() {
+		if n.Store == store {
+			current[n.ID] = n
+		}
+	}
+
+	type change struct {
+		eventType string
+		n         Newsletter
+	}
+	var changes []change
+	for _, n := range list {
+		if old, ok := current[n.ID]; !ok {
+			changes = append(changes, change{EventNewsletterCreated, n})
+		} else if !old.LastUpdated.Equal(n.LastUpdated) {
+			changes = append(changes, change{EventNewsletterUpdated, n})
+		}
+		delete(current, n.ID)
+	}
+	var removed []Newsletter
+	for _, n := range current {
+		removed = append(removed, n)
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].ID < removed[j].ID })
+	for _, n := range removed {
+		changes = append(changes, change{EventNewsletterDeleted, n})
+	}
+
+	var eventIDs []string
+	settle := func(saved bool) {
+		for _, id := range eventIDs {
+			outbox.Settle(id, saved)
+		}
+	}
+	for _, c := range changes {
+		id, err := outbox.Add(c.eventType, c.n.ID, c.n.LastUpdated, newsletterEventPayload(c.n))
+		if err != nil {
+			settle(false)
+			return fmt.Errorf("failed to record %s event: %v", c.eventType, err)
+		}
+		eventIDs = append(eventIDs, id)
+	}
+
+	err := newsletters.Replace(store, list)
+	settle(err == nil)
+	return err
+}
+
+// newsletterEventPayload is the summary of a newsletter carried by its events
+func newsletterEventPayload(n Newsletter) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         n.ID,
+		"store":      n.Store,
+		"title":      n.Title,
+		"validFrom":  n.ValidFrom,
+		"validUntil": n.ValidUntil,
+		"pages":      len(n.Pages),
+	}
+}
+
+// storeFromID derives the store name from a config ID like "lidl-09-02-15-02-2026"
+func storeFromID(id string) string {
+	store, _, _ := strings.Cut(id, "-")
+	return store
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gorilla/mux"
+)
+
+// OCREngine reads the text lines of an image
+type OCREngine interface {
+	Recognize(imagePath string) ([]string, error)
+}
+
+// ocrEngine reads page text for product extraction; nil disables it
+var ocrEngine OCREngine
+
+// NewOCREngine returns the engine named by OCR_PROVIDER: "tesseract" (the
+// default, TESSERACT_LANG sets the language, default "ron") or "none"
+func NewOCREngine() OCREngine {
+	switch os.Getenv("OCR_PROVIDER") {
+	case "none":
+		return nil
+	default:
+		lang := os.Getenv("TESSERACT_LANG")
+		if lang == "" {
+			lang = "ron"
+		}
+		return TesseractOCR{Binary: "tesseract", Language: lang}
+	}
+}
+
+// TesseractOCR runs the tesseract command line tool
+type TesseractOCR struct {
+	Binary   string
+	Language string
+}
+
+// Recognize implements OCREngine
+func (t TesseractOCR) Recognize(imagePath string) ([]string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(t.Binary, imagePath, "stdout", "-l", t.Language)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", t.Binary, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// Product is a product and its price read from a catalog page
+type Product struct {
+	NewsletterID string      `json:"newsletterId"`
+	PageNumber   int         `json:"pageNumber"`
+	Name         string      `json:"name"`
+	Price        ParsedPrice `json:"price"`
+	Text         string      `json:"text"` // the recognized text the product was read from
+
+	// Anomaly is set when the price is far off the product's history
+	Anomaly *PriceAnomaly `json:"anomaly,omitempty"`
+}
+
+// priceStartPattern finds where the price label begins in a line
+var priceStartPattern = regexp.MustCompile(`(?i)(?:\d+\s*(?:buc\.?\s*)?(?:pentru|la|x)\s+)?\d[\d.,]*\s*(?:lei|ron|bani)\b`)
+
+// extractProducts pairs each price in the page text with a product name:
+// the text before the price on the same line, or else the closest line
+// above that holds no price
+func extractProducts(lines []string) []Product {
+	products := []Product{}
+	name := ""
+	for _, line := range lines {
+		loc := priceStartPattern.FindStringIndex(line)
+		if loc == nil {
+			if looksLikeName(line) {
+				name = line
+			}
+			continue
+		}
+
+		price, err := ParsePrice(line[loc[0]:])
+		if err != nil {
+			continue
+		}
+		productName := strings.Trim(line[:loc[0]], " -:.,")
+		if !looksLikeName(productName) {
+			productName = name
+		}
+		if productName == "" {
+			continue
+		}
+		products = append(products, Product{Name: productName, Price: price, Text: line})
+		name = ""
+	}
+	return products
+}
+
+// looksLikeName reports whether OCR text can be a product name: it has a
+// few letters and is not a bare promo label such as "-30%"
+func looksLikeName(text string) bool {
+	letters := 0
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	if letters < 3 {
+		return false
+	}
+	_, err := ParsePrice(text)
+	return err != nil
+}
+
+// productsPath returns the sidecar file holding the products of a page image
+func productsPath(imagePath string) string {
+	return strings.TrimSuffix(imagePath, ".jpg") + ".products.json"
+}
+
+// extractPageProducts reads the products of a page image, flags prices far
+// off their history and saves the products next to the image, then
+// publishes offer.indexed
+func extractPageProducts(engine OCREngine, history priceHistory, newsletterID string, pageNumber int, imagePath string) ([]Product, error) {
+	lines, err := engine.Recognize(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	products := extractProducts(lines)
+	for i := range products {
+		products[i].NewsletterID = newsletterID
+		products[i].PageNumber = pageNumber
+	}
+	history.flagAnomalies(products)
+
+	if err := savePageProducts(imagePath, products); err != nil {
+		return nil, err
+	}
+	publishEvent(EventOfferIndexed, map[string]interface{}{
+		"newsletterId": newsletterID,
+		"pageNumber":   pageNumber,
+		"offers":       products,
+	})
+	return products, nil
+}
+
+// savePageProducts writes the product sidecar of a page image
+func savePageProducts(imagePath string, products []Product) error {
+	data, err := json.MarshalIndent(products, "", "  ")
+	if err != nil {
+		return err
+	}
+	return replaceFile(productsPath(imagePath), data, filePerm)
+}
+
+// loadPageProducts reads the product sidecar of a page, if OCR ran for it
+func loadPageProducts(page Page) []Product {
+	imagePath, ok := localImagePath(page.ImageURL)
+	if !ok {
+		return nil
+	}
+	data, err := os.ReadFile(productsPath(imagePath))
+	if err != nil {
+		return nil
+	}
+	var products []Product
+	if err := json.Unmarshal(data, &products); err != nil {
+		return nil
+	}
+	return products
+}
+
+// API Handlers
+
+func getNewsletterProducts(w http.ResponseWriter, r *http.Request) {
+	newsletter, ok := newsletters.Get(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Newsletter not found", http.StatusNotFound)
+		return
+	}
+
+	pageFilter := 0
+	if v := r.URL.Query().Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid page", http.StatusBadRequest)
+			return
+		}
+		pageFilter = n
+	}
+
+	products := []Product{}
+	for _, page := range newsletter.Pages {
+		if pageFilter != 0 && page.PageNumber != pageFilter {
+			continue
+		}
+		// Link to the current ID in case the newsletter was renamed since
+		for _, p := range loadPageProducts(page) {
+			p.NewsletterID, p.PageNumber = newsletter.ID, page.PageNumber
+			products = append(products, p)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(products)
+}
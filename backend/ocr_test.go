@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeOCR recognizes the same lines on every page
+type fakeOCR []string
+
+func (f fakeOCR) Recognize(string) ([]string, error) { return f, nil }
+
+// recordingPublisher keeps what was published, by subject
+type recordingPublisher map[string][]byte
+
+func (p recordingPublisher) Publish(subject string, data []byte) error {
+	p[subject] = data
+	return nil
+}
+
+// TestExtractPageProductsPublishesOffers extracts a page and expects its
+// offers on the bus once the sidecar is saved
+func TestExtractPageProductsPublishesOffers(t *testing.T) {
+	bus := recordingPublisher{}
+	defer func(saved EventPublisher) { eventBus = saved }(eventBus)
+	eventBus = bus
+
+	imagePath := filepath.Join(t.TempDir(), "page-003.jpg")
+	products, err := extractPageProducts(fakeOCR{"Lapte 1,5% 1 l 7,49 lei"}, priceHistory{}, "lidl-test", 3, imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 1 {
+		t.Fatalf("extracted %d products, want 1", len(products))
+	}
+	if _, err := os.Stat(productsPath(imagePath)); err != nil {
+		t.Fatalf("products sidecar not saved: %v", err)
+	}
+
+	data, ok := bus[busPrefix+"."+EventOfferIndexed]
+	if !ok {
+		t.Fatalf("no %s event published, got %v", EventOfferIndexed, bus)
+	}
+	var event struct {
+		Type    string `json:"type"`
+		Payload struct {
+			NewsletterID string    `json:"newsletterId"`
+			PageNumber   int       `json:"pageNumber"`
+			Offers       []Product `json:"offers"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != EventOfferIndexed || event.Payload.NewsletterID != "lidl-test" || event.Payload.PageNumber != 3 || len(event.Payload.Offers) != 1 {
+		t.Errorf("event %+v, want lidl-test page 3 with 1 offer", event)
+	}
+}
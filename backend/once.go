@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// OnceResult is the outcome of one config in a -once run
+type OnceResult struct {
+	Config   string  `json:"config"`
+	Store    string  `json:"store"`
+	Status   string  `json:"status"` // "scraped", "failed" or "skipped"
+	Reason   string  `json:"reason,omitempty"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration,omitempty"`
+}
+
+// OnceSummary is printed to stdout at the end of a -once run
+type OnceSummary struct {
+	StartedAt time.Time    `json:"startedAt"`
+	Results   []OnceResult `json:"results"`
+	Scraped   int          `json:"scraped"`
+	Failed    int          `json:"failed"`
+	Skipped   int          `json:"skipped"`
+}
+
+// scrapeDue reports whether a config needs scraping: its catalog was never
+// scraped or was extracted by an older pipeline, and it hasn't expired yet
+func scrapeDue(config *ScraperConfig, today string) (bool, string) {
+	if optOuts.IsOptedOut(config.StoreName()) {
+		return false, "opted out"
+	}
+	if config.ValidUntil != "" && config.ValidUntil < today {
+		return false, "expired"
+	}
+	id, err := config.NewsletterID()
+	if err != nil {
+		return true, err.Error()
+	}
+	n, ok := newsletters.Get(id)
+	if !ok {
+		return true, "not scraped"
+	}
+	if n.ExtractorVersion < ExtractorVersion {
+		return true, "outdated"
+	}
+	return false, "up to date"
+}
+
+// runOnce scrapes every due config without starting the HTTP server, prints
+// a JSON summary and returns an error when any scrape failed. Cancelling ctx
+// stops the running scrape and skips the remaining configs.
+func runOnce(ctx context.Context) error {
+	if err := warmup(); err != nil {
+		return err
+	}
+
+	configs, err := ListAvailableConfigs()
+	if err != nil {
+		return fmt.Errorf("failed to list configs: %v", err)
+	}
+
+	summary := OnceSummary{StartedAt: time.Now(), Results: []OnceResult{}}
+	today := time.Now().Format("2006-01-02")
+	for _, name := range configs {
+		path := configFile(name)
+		result := OnceResult{Config: name}
+
+		config, err := LoadScraperConfig(path)
+		if err != nil {
+			result.Status, result.Error = "failed", err.Error()
+			summary.Failed++
+			summary.Results = append(summary.Results, result)
+			continue
+		}
+		result.Config, result.Store = config.ID, config.StoreName()
+
+		if ctx.Err() != nil {
+			result.Status, result.Reason = "skipped", "interrupted"
+			summary.Skipped++
+			summary.Results = append(summary.Results, result)
+			continue
+		}
+
+		due, reason := scrapeDue(config, today)
+		result.Reason = reason
+		if !due {
+			result.Status = "skipped"
+			summary.Skipped++
+			summary.Results = append(summary.Results, result)
+			continue
+		}
+
+		started := time.Now()
+		err = ScrapeAndDownloadFromConfig(ctx, path, ScrapeOptions{})
+		result.Duration = time.Since(started).Seconds()
+		if err == errCatalogUnchanged {
+			result.Status, result.Reason = "skipped", "up to date"
+			summary.Skipped++
+		} else if err != nil {
+			result.Status, result.Error = "failed", err.Error()
+			summary.Failed++
+		} else {
+			result.Status = "scraped"
+			summary.Scraped++
+		}
+		summary.Results = append(summary.Results, result)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(summary)
+
+	if summary.Failed > 0 {
+		return fmt.Errorf("%d of %d configs failed", summary.Failed, len(configs))
+	}
+	return nil
+}
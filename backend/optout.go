@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var optOutsFile = dataPath("opt-outs.json")
+
+// StoreOptOut marks a store that asked not to be archived: its images are
+// deleted, its newsletters only link to the official viewer and it is never
+// scraped again until the opt-out is lifted
+type StoreOptOut struct {
+	Store     string    `json:"store"`
+	Reason    string    `json:"reason,omitempty"`
+	Since     time.Time `json:"since"`
+	Removed   []string  `json:"removedNewsletters"`
+	FilesLeft []string  `json:"filesLeft,omitempty"`
+}
+
+// OptOutRegistry holds store opt-outs and persists them to disk
+type OptOutRegistry struct {
+	mu     sync.Mutex
+	path   string
+	stores map[string]*StoreOptOut
+}
+
+var optOuts *OptOutRegistry
+
+// LoadOptOutRegistry loads opt-outs from path, starting empty if it doesn't exist
+func LoadOptOutRegistry(path string) (*OptOutRegistry, error) {
+	reg := &OptOutRegistry{path: path, stores: make(map[string]*StoreOptOut)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return reg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*StoreOptOut
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	for _, o := range list {
+		reg.stores[o.Store] = o
+	}
+	return reg, nil
+}
+
+// save writes all opt-outs to disk; the caller must hold mu
+func (r *OptOutRegistry) save() error {
+	data, err := json.MarshalIndent(r.list(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, data, filePerm)
+}
+
+// list returns the opt-outs sorted by store; the caller must hold mu
+func (r *OptOutRegistry) list() []*StoreOptOut {
+	list := make([]*StoreOptOut, 0, len(r.stores))
+	for _, o := range r.stores {
+		list = append(list, o)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Store < list[j].Store })
+	return list
+}
+
+// List returns all opt-outs
+func (r *OptOutRegistry) List() []*StoreOptOut {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.list()
+}
+
+// IsOptedOut reports whether store must not be archived
+func (r *OptOutRegistry) IsOptedOut(store string) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.stores[store]
+	return ok
+}
+
+// Add records an opt-out
+func (r *OptOutRegistry) Add(o *StoreOptOut) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stores[o.Store] = o
+	return r.save()
+}
+
+// Remove lifts an opt-out, reporting whether there was one
+func (r *OptOutRegistry) Remove(store string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.stores[store]; !ok {
+		return false, nil
+	}
+	delete(r.stores, store)
+	return true, r.save()
+}
+
+// knownStore reports whether any config or newsletter belongs to store
+func knownStore(store string) bool {
+	for _, n := range newsletters.List() {
+		if n.Store == store {
+			return true
+		}
+	}
+	configs, _ := ListAvailableConfigs()
+	for _, name := range configs {
+		config, err := LoadScraperConfig(configFile(name))
+		if err == nil && config.StoreName() == store {
+			return true
+		}
+	}
+	return false
+}
+
+// removeArchivedData deletes everything stored for a newsletter: its images,
+// tiles and provenance, and the recording of the scrape that produced it
+func removeArchivedData(n Newsletter) []string {
+	var left []string
+	dirs := []string{dataDir(n)}
+	if n.ConfigID != "" {
+		dirs = append(dirs, filepath.Join(recordingsDir, n.ConfigID))
+	}
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			slog.Error("failed to remove archived data", "dir", dir, "err", err)
+			left = append(left, dir)
+		}
+	}
+	return left
+}
+
+// applyOptOut strips a store's newsletters down to links to the official
+// viewer and deletes their stored data
+func applyOptOut(o *StoreOptOut) error {
+	removeStoreSnapshot(o.Store)
+	for _, n := range newsletters.List() {
+		if n.Store != o.Store {
+			continue
+		}
+		o.FilesLeft = append(o.FilesLeft, removeArchivedData(n)...)
+		o.Removed = append(o.Removed, n.ID)
+
+		if path, ok := findConfigPath(n.ConfigID); ok {
+			if config, err := LoadScraperConfig(path); err == nil {
+				n.ViewerURL = config.FirstPage
+			}
+		}
+		n.CoverImage = ""
+		n.CoverThumbnail = ""
+		n.Pages = []Page{}
+		n.LastUpdated = time.Now()
+		if err := registerNewsletter(n); err != nil {
+			return fmt.Errorf("failed to update %s: %v", n.ID, err)
+		}
+	}
+	return nil
+}
+
+// API Handlers
+
+func getOptOuts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(optOuts.List())
+}
+
+// createOptOutRequest is the body of POST /api/admin/opt-outs
+type createOptOutRequest struct {
+	Store  string `json:"store"`
+	Reason string `json:"reason"`
+}
+
+// Validate checks that the store exists
+func (req *createOptOutRequest) Validate() *ValidationError {
+	req.Store = strings.TrimSpace(req.Store)
+	if req.Store == "" {
+		return fieldError("store", "is required")
+	}
+	if !knownStore(req.Store) {
+		return fieldError("store", "unknown store %s", req.Store)
+	}
+	return nil
+}
+
+// createOptOut deletes the archived data of a store for good; like all
+// admin routes it is behind requireAdmin
+func createOptOut(w http.ResponseWriter, r *http.Request) {
+	var req createOptOutRequest
+	if err := decodeJSONBody(w, r, &req); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	// Record the opt-out first so no new scrape starts while data is deleted
+	o := &StoreOptOut{Store: req.Store, Reason: req.Reason, Since: time.Now(), Removed: []string{}}
+	if err := optOuts.Add(o); err != nil {
+		http.Error(w, "Error saving opt-out", http.StatusInternalServerError)
+		return
+	}
+	if err := applyOptOut(o); err != nil {
+		logFrom(r.Context()).Error("failed to apply opt-out", "store", o.Store, "err", err)
+		http.Error(w, "Error removing archived data", http.StatusInternalServerError)
+		return
+	}
+	if err := optOuts.Add(o); err != nil {
+		http.Error(w, "Error saving opt-out", http.StatusInternalServerError)
+		return
+	}
+	logFrom(r.Context()).Info("store opted out", "store", o.Store, "removed", len(o.Removed))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(o)
+}
+
+// deleteOptOut lets a store be scraped again; like all admin routes it is
+// behind requireAdmin
+func deleteOptOut(w http.ResponseWriter, r *http.Request) {
+	store := mux.Vars(r)["store"]
+	removed, err := optOuts.Remove(store)
+	if err != nil {
+		http.Error(w, "Error saving opt-outs", http.StatusInternalServerError)
+		return
+	}
+	if !removed {
+		http.Error(w, "Opt-out not found", http.StatusNotFound)
+		return
+	}
+	logFrom(r.Context()).Info("store opt-out lifted", "store", store)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,61 @@
+package main
+
+import "sort"
+
+// validityOverlaps reports whether two newsletters are valid on a common day
+func validityOverlaps(a, b Newsletter) bool {
+	if invalidDates(a) || invalidDates(b) {
+		return false
+	}
+	// ISO dates compare correctly as strings
+	return a.ValidFrom <= b.ValidUntil && b.ValidFrom <= a.ValidUntil
+}
+
+// validOn reports whether a newsletter is valid on day (YYYY-MM-DD)
+func validOn(n Newsletter, day string) bool {
+	return !invalidDates(n) && n.ValidFrom <= day && day <= n.ValidUntil
+}
+
+// resolveOverlaps marks superseded newsletters. When catalogs of the same
+// store, category and theme overlap in validity, typically because a
+// corrected catalog was re-published, the most recently scraped one is
+// canonical and the others are superseded by it. The relation is derived
+// from the list every time, so it is never stale.
+func resolveOverlaps(list []Newsletter) {
+	order := make([]int, len(list))
+	for i := range list {
+		order[i] = i
+		list[i].Supersedes = nil
+		list[i].SupersededBy = ""
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return list[order[i]].LastUpdated.After(list[order[j]].LastUpdated)
+	})
+
+	var canonical []int
+	for _, i := range order {
+		n := &list[i]
+		for _, c := range canonical {
+			winner := &list[c]
+			if winner.Store == n.Store && winner.Category == n.Category && winner.Theme == n.Theme && validityOverlaps(*winner, *n) {
+				n.SupersededBy = winner.ID
+				winner.Supersedes = append(winner.Supersedes, n.ID)
+				break
+			}
+		}
+		if n.SupersededBy == "" {
+			canonical = append(canonical, i)
+		}
+	}
+}
+
+// withoutSuperseded drops superseded newsletters
+func withoutSuperseded(list []Newsletter) []Newsletter {
+	result := make([]Newsletter, 0, len(list))
+	for _, n := range list {
+		if n.SupersededBy == "" {
+			result = append(result, n)
+		}
+	}
+	return result
+}
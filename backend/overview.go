@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// StoreOverview aggregates everything a store page shows
+type StoreOverview struct {
+	Store           string       `json:"store"`
+	Group           *StoreGroup  `json:"group,omitempty"`
+	Logo            string       `json:"logo,omitempty"`
+	OptedOut        bool         `json:"optedOut"`
+	Active          []Newsletter `json:"active"`
+	Upcoming        []Newsletter `json:"upcoming"`
+	NextPublication string       `json:"nextPublication,omitempty"`
+	TotalCatalogs   int          `json:"totalCatalogs"`
+}
+
+// nextPublication estimates when the store publishes its next catalog from
+// the usual gap between the start dates of its weekly catalogs
+func nextPublication(list []Newsletter) string {
+	var starts []time.Time
+	seen := map[string]bool{}
+	for _, n := range list {
+		if n.Category != "weekly-food" || seen[n.ValidFrom] {
+			continue
+		}
+		if t, err := time.Parse("2006-01-02", n.ValidFrom); err == nil {
+			starts = append(starts, t)
+			seen[n.ValidFrom] = true
+		}
+	}
+	if len(starts) == 0 {
+		return ""
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+
+	// Weekly unless the history says otherwise; the median ignores skipped weeks
+	gap := 7 * 24 * time.Hour
+	if len(starts) >= 3 {
+		var gaps []time.Duration
+		for i := 1; i < len(starts); i++ {
+			gaps = append(gaps, starts[i].Sub(starts[i-1]))
+		}
+		sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+		gap = gaps[len(gaps)/2]
+	}
+
+	today, _ := time.Parse("2006-01-02", time.Now().Format("2006-01-02"))
+	next := starts[len(starts)-1].Add(gap)
+	for gap > 0 && next.Before(today) {
+		next = next.Add(gap)
+	}
+	return next.Format("2006-01-02")
+}
+
+// storeLogo returns the proxied logo of a store, if a config has one
+func storeLogo(store string) string {
+	configs, _ := ListAvailableConfigs()
+	for _, name := range configs {
+		config, err := LoadScraperConfig(configFile(name))
+		if err == nil && config.StoreName() == store && config.LogoURL != "" {
+			return proxiedAssetURL(config.LogoURL)
+		}
+	}
+	return ""
+}
+
+// API Handlers
+
+func getStoreOverview(w http.ResponseWriter, r *http.Request) {
+	store := mux.Vars(r)["store"]
+	if !knownStore(store) {
+		http.Error(w, "Store not found", http.StatusNotFound)
+		return
+	}
+
+	overview := StoreOverview{
+		Store:    store,
+		Logo:     storeLogo(store),
+		OptedOut: optOuts.IsOptedOut(store),
+		Active:   []Newsletter{},
+		Upcoming: []Newsletter{},
+	}
+	if g, ok := GroupOfStore(store); ok {
+		overview.Group = &g
+	}
+
+	var catalogs []Newsletter
+	for _, n := range newsletters.List() {
+		if n.Store == store {
+			catalogs = append(catalogs, n)
+		}
+	}
+	overview.TotalCatalogs = len(catalogs)
+	overview.NextPublication = nextPublication(catalogs)
+
+	today := time.Now().Format("2006-01-02")
+	for _, n := range localizeNewsletters(withoutSuperseded(catalogs), r) {
+		switch {
+		case n.ValidFrom > today:
+			overview.Upcoming = append(overview.Upcoming, n)
+		case n.ValidUntil >= today:
+			overview.Active = append(overview.Active, n)
+		}
+	}
+	sort.Slice(overview.Active, func(i, j int) bool { return overview.Active[i].ValidFrom > overview.Active[j].ValidFrom })
+	sort.Slice(overview.Upcoming, func(i, j int) bool { return overview.Upcoming[i].ValidFrom < overview.Upcoming[j].ValidFrom })
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Add("Vary", "Accept-Language")
+	json.NewEncoder(w).Encode(overview)
+}
+
+// StoreInfo is a configured store with its archive statistics
+type StoreInfo struct {
+	StoreConfig
+	LastScraped     *time.Time `json:"lastScraped"`
+	NewsletterCount int        `json:"newsletterCount"`
+	OptedOut        bool       `json:"optedOut,omitempty"`
+}
+
+// storeInfo adds archive statistics to a store's config. The newest
+// LastUpdated is the last successful scrape, as newsletters are only
+// recorded after one; superseded newsletters are not counted.
+func storeInfo(store StoreConfig) StoreInfo {
+	info := StoreInfo{StoreConfig: store, OptedOut: optOuts.IsOptedOut(store.Name)}
+	for _, n := range newsletters.List() {
+		if n.Store != store.Name {
+			continue
+		}
+		if info.LastScraped == nil || n.LastUpdated.After(*info.LastScraped) {
+			updated := n.LastUpdated
+			info.LastScraped = &updated
+		}
+		if n.SupersededBy == "" {
+			info.NewsletterCount++
+		}
+	}
+	return info
+}
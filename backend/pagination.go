@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const maxPageLimit = 100
+
+// cursor marks the position after the last item of a page. Newsletters are
+// listed newest first by LastUpdated, ties broken by ID, so a cursor stays
+// valid while scrapes insert new rows.
+type cursor struct {
+	LastUpdated time.Time `json:"t"`
+	ID          string    `json:"id"`
+}
+
+func encodeCursor(n Newsletter) string {
+	data, _ := json.Marshal(cursor{LastUpdated: n.LastUpdated, ID: n.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+// newsletterBefore reports whether a sorts before b in listing order
+func newsletterBefore(a, b cursor) bool {
+	if !a.LastUpdated.Equal(b.LastUpdated) {
+		return a.LastUpdated.After(b.LastUpdated)
+	}
+	return a.ID < b.ID
+}
+
+// NewsletterPage is a page of a listing. Total counts all matching
+// newsletters across pages, and Limit equals it for listings that aren't
+// paginated; Page and PageSize are only set for numbered pages. NextCursor
+// is nil on the last page.
+type NewsletterPage struct {
+	Items      []Newsletter `json:"items"`
+	NextCursor *string      `json:"nextCursor"`
+	Limit      int          `json:"limit"`
+	Total      int          `json:"total"`
+	Page       int          `json:"page,omitempty"`
+	PageSize   int          `json:"pageSize,omitempty"`
+}
+
+// wantsPagination reports whether the client asked for a paginated envelope
+func wantsPagination(r *http.Request) bool {
+	q := r.URL.Query()
+	return q.Has("limit") || q.Has("cursor") || q.Has("page") || q.Has("pageSize")
+}
+
+// positiveParam parses a query parameter that must be a positive integer,
+// returning def when it is absent
+func positiveParam(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+	return n, nil
+}
+
+// paginateNewsletters returns the page selected by ?cursor= and ?limit=, or
+// by ?page= and ?pageSize= (an alias of limit) for numbered pages
+func paginateNewsletters(list []Newsletter, r *http.Request) (NewsletterPage, error) {
+	q := r.URL.Query()
+	if q.Has("limit") && q.Has("pageSize") {
+		return NewsletterPage{}, fmt.Errorf("limit and pageSize are mutually exclusive")
+	}
+	if q.Has("cursor") && q.Has("page") {
+		return NewsletterPage{}, fmt.Errorf("cursor and page are mutually exclusive")
+	}
+
+	sizeParam := "limit"
+	if q.Has("pageSize") {
+		sizeParam = "pageSize"
+	}
+	limit, err := positiveParam(r, sizeParam, maxPageLimit)
+	if err != nil {
+		return NewsletterPage{}, err
+	}
+	limit = min(limit, maxPageLimit)
+	number, err := positiveParam(r, "page", 0)
+	if err != nil {
+		return NewsletterPage{}, err
+	}
+
+	sorted := make([]Newsletter, len(list))
+	copy(sorted, list)
+	sort.Slice(sorted, func(i, j int) bool {
+		return newsletterBefore(
+			cursor{sorted[i].LastUpdated, sorted[i].ID},
+			cursor{sorted[j].LastUpdated, sorted[j].ID},
+		)
+	})
+
+	start := 0
+	if number > 0 {
+		start = min((number-1)*limit, len(sorted))
+	}
+	if token := r.URL.Query().Get("cursor"); token != "" {
+		after, err := decodeCursor(token)
+		if err != nil {
+			return NewsletterPage{}, fmt.Errorf("invalid cursor")
+		}
+		start = sort.Search(len(sorted), func(i int) bool {
+			return newsletterBefore(after, cursor{sorted[i].LastUpdated, sorted[i].ID})
+		})
+	}
+
+	end := min(start+limit, len(sorted))
+	page := NewsletterPage{Items: sorted[start:end], Limit: limit, Total: len(sorted), Page: number}
+	if number > 0 {
+		page.PageSize = limit
+	}
+	if end < len(sorted) {
+		next := encodeCursor(sorted[end-1])
+		page.NextCursor = &next
+	}
+	return page, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPDFDPI = 150
+	maxPDFDPI     = 600
+)
+
+// PDFConfig locates a catalog published as a PDF file
+type PDFConfig struct {
+	URL string `json:"url"`
+	// DPI is the resolution pages are rendered at (default 150)
+	DPI int `json:"dpi,omitempty"`
+}
+
+// dpi returns the rendering resolution
+func (c *PDFConfig) dpi() int {
+	if c.DPI == 0 {
+		return defaultPDFDPI
+	}
+	return c.DPI
+}
+
+// PDFCatalog scrapes catalogs published as a PDF, as Penny and Profi do:
+// the file is downloaded once and each page rendered to a JPEG with the
+// poppler tools (pdfinfo, pdftoppm), without a browser
+type PDFCatalog struct{}
+
+// Check implements ScraperStrategy
+func (PDFCatalog) Check(config *ScraperConfig) error {
+	if config.PDF == nil || config.PDF.URL == "" {
+		return fmt.Errorf("pdf.url is required")
+	}
+	if config.PDF.DPI < 0 || config.PDF.DPI > maxPDFDPI {
+		return fmt.Errorf("pdf.dpi must be between 1 and %d", maxPDFDPI)
+	}
+	return nil
+}
+
+// Pages implements ScraperStrategy
+func (PDFCatalog) Pages(s *scrapeSession) ([]CatalogPage, error) {
+	path, err := catalogPDF(s)
+	if err != nil {
+		return nil, err
+	}
+	count, err := pdfPageCount(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pdfURL := s.config.PDF.URL
+	pages := make([]CatalogPage, count)
+	for i := range pages {
+		pages[i] = CatalogPage{Number: i + 1, URL: pdfURL, ImageURL: fmt.Sprintf("%s#page=%d", pdfURL, i+1)}
+	}
+	return pages, nil
+}
+
+// Download implements ScraperStrategy
+func (PDFCatalog) Download(s *scrapeSession, page CatalogPage, path string) (string, error) {
+	pdf, err := catalogPDF(s)
+	if err != nil {
+		return "", err
+	}
+	if err := renderPDFPage(pdf, page.Number, s.config.PDF.dpi(), path); err != nil {
+		return "", err
+	}
+	return page.ImageURL, nil
+}
+
+// catalogPDF returns the session's copy of the catalog, downloading it on
+// first use
+func catalogPDF(s *scrapeSession) (string, error) {
+	path, err := s.tempFile("catalog.pdf")
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	// Fetched like an image, so recordings include the file
+	if err := s.download(s.config.PDF.URL, path); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to fetch %s: %v", s.config.PDF.URL, err)
+	}
+	return path, nil
+}
+
+// pdfPageCount reads the number of pages of a PDF with pdfinfo
+func pdfPageCount(path string) (int, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("pdfinfo", path)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("pdfinfo: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if v, ok := strings.CutPrefix(scanner.Text(), "Pages:"); ok {
+			count, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || count < 1 {
+				return 0, fmt.Errorf("pdfinfo: invalid page count %q", strings.TrimSpace(v))
+			}
+			return count, nil
+		}
+	}
+	return 0, fmt.Errorf("pdfinfo: no page count")
+}
+
+// renderPDFPage renders one page of a PDF to a JPEG at path
+func renderPDFPage(pdf string, page, dpi int, path string) error {
+	out, err := createFile(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	var stderr bytes.Buffer
+	n := strconv.Itoa(page)
+	cmd := exec.Command("pdftoppm", "-jpeg", "-r", strconv.Itoa(dpi), "-f", n, "-l", n, "-singlefile", pdf)
+	cmd.Stdout = out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pdftoppm: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
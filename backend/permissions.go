@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+)
+
+// Modes for the directories and files the server creates under the data
+// directory. DATA_DIR_MODE and DATA_FILE_MODE override them with octal
+// values such as 0750 and 0640; the process umask still applies on top.
+var (
+	dirPerm  = modeFromEnv("DATA_DIR_MODE", 0755)
+	filePerm = modeFromEnv("DATA_FILE_MODE", 0644)
+)
+
+func modeFromEnv(name string, fallback os.FileMode) os.FileMode {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	mode, err := strconv.ParseUint(raw, 8, 32)
+	if err != nil || mode > 0777 {
+		slog.Warn("invalid "+name+", using the default", "value", raw, "default", "0"+strconv.FormatUint(uint64(fallback), 8))
+		return fallback
+	}
+	return os.FileMode(mode)
+}
+
+// replaceFile writes data to a new file with perm that then replaces path.
+// Unlike truncating path, it leaves other hard links to the old file as
+// they were, and a crash mid-write leaves the old file intact.
+func replaceFile(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// createFile creates or truncates a file with filePerm
+func createFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, filePerm)
+}
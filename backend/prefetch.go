@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultPrefetchCount = 3
+	maxPrefetchCount     = 10
+)
+
+// getPrefetchHints lists the image URLs of the pages following ?page=N, both
+// in the body and as a Link: rel=prefetch header the browser acts on directly
+func getPrefetchHints(w http.ResponseWriter, r *http.Request) {
+	newsletter, ok := newsletters.Get(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Newsletter not found", http.StatusNotFound)
+		return
+	}
+
+	current, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || current < 0 {
+		http.Error(w, "Invalid page", http.StatusBadRequest)
+		return
+	}
+
+	count := defaultPrefetchCount
+	if v := r.URL.Query().Get("count"); v != "" {
+		count, err = strconv.Atoi(v)
+		if err != nil || count < 1 {
+			http.Error(w, "Invalid count", http.StatusBadRequest)
+			return
+		}
+		count = min(count, maxPrefetchCount)
+	}
+
+	urls := []string{}
+	for _, page := range newsletter.Pages {
+		if page.PageNumber > current && len(urls) < count {
+			urls = append(urls, page.ImageURL)
+		}
+	}
+
+	if len(urls) > 0 {
+		links := make([]string, len(urls))
+		for i, u := range urls {
+			links[i] = fmt.Sprintf("<%s>; rel=prefetch; as=image", u)
+		}
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":   newsletter.ID,
+		"page": current,
+		"next": urls,
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultPrewarmConcurrency = 4
+
+// prewarmClient fetches images through the CDN; a slow edge must not hold
+// up the scrape for long
+var prewarmClient = &http.Client{Timeout: 15 * time.Second}
+
+// prewarmImages requests the cover and every page of a newsletter from the
+// CDN at CDN_PREWARM_URL, so the edge caches hold them before subscribers
+// are notified. PREWARM_CONCURRENCY (default 4) bounds parallel requests.
+// Failures are only logged.
+func prewarmImages(n Newsletter) {
+	base := strings.TrimSuffix(os.Getenv("CDN_PREWARM_URL"), "/")
+	if base == "" {
+		return
+	}
+	concurrency := defaultPrewarmConcurrency
+	if v := os.Getenv("PREWARM_CONCURRENCY"); v != "" {
+		if c, err := strconv.Atoi(v); err == nil && c > 0 {
+			concurrency = c
+		}
+	}
+
+	var paths []string
+	for _, path := range []string{n.CoverImage, n.CoverThumbnail} {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	for _, page := range n.Pages {
+		paths = append(paths, page.ImageURL)
+		if page.ThumbnailURL != "" {
+			paths = append(paths, page.ThumbnailURL)
+		}
+	}
+
+	started := time.Now()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	warmed := 0
+	slots := make(chan struct{}, concurrency)
+	for _, path := range paths {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(url string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			resp, err := prewarmClient.Get(url)
+			if err != nil {
+				slog.Warn("failed to pre-warm image", "url", url, "err", err)
+				return
+			}
+			// The edge only caches what was fully sent
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				slog.Warn("failed to pre-warm image", "url", url, "status", resp.StatusCode)
+				return
+			}
+			mu.Lock()
+			warmed++
+			mu.Unlock()
+		}(base + path)
+	}
+	wg.Wait()
+
+	slog.Info("pre-warmed images", "newsletter", n.ID, "warmed", warmed, "images", len(paths), "cdn", base, "duration", time.Since(started).Round(time.Millisecond))
+}
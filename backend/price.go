@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PromoType describes how a leaflet price label is meant
+type PromoType string
+
+const (
+	PromoRegular    PromoType = "regular"      // a plain price
+	PromoMultiBuy   PromoType = "multi-buy"    // "2 pentru 10 lei": Quantity items for Price together
+	PromoPercentOff PromoType = "percent-off"  // "-30%": Discount percent off, no price
+	PromoBuyGetFree PromoType = "buy-get-free" // "2+1 gratis": Free items with every Quantity bought
+	PromoSecondItem PromoType = "second-item"  // "al doilea produs -50%": Discount percent off every second item
+)
+
+// ParsedPrice is a price label read from a leaflet
+type ParsedPrice struct {
+	Price     float64   `json:"price"`
+	Currency  string    `json:"currency,omitempty"`
+	PromoType PromoType `json:"promoType"`
+	Quantity  int       `json:"quantity,omitempty"`
+	Discount  float64   `json:"discount,omitempty"`
+	Free      int       `json:"free,omitempty"`
+	Unit      string    `json:"unit,omitempty"` // set for per-unit prices such as "lei/kg"
+
+	// MinQuantity is the number of items to buy for the promo to apply
+	MinQuantity int `json:"minQuantity,omitempty"`
+}
+
+var (
+	percentOffPattern  = regexp.MustCompile(`^-\s*(\d+(?:[.,]\d+)?)\s*%$`)
+	multiBuyPattern    = regexp.MustCompile(`^(\d+)\s*(?:buc\.?\s*)?(pentru|la|x)\s+(.+)$`)
+	amountPattern      = regexp.MustCompile(`(\d[\d.,]*)\s*(lei|ron|bani)\b`)
+	perUnitPattern     = regexp.MustCompile(`(?:/|\bpe\s+|\bper\s+)\s*(kg|g|l|ml|buc)\b`)
+	buyGetFreePattern  = regexp.MustCompile(`^(\d+)\s*\+\s*(\d+)(?:\s*gratis)?$`)
+	secondItemPattern  = regexp.MustCompile(`^(?:al\s+(?:doilea|2-lea)\s+produs\s*(?:la\s*)?-\s*(\d+)\s*%|-\s*(\d+)\s*%\s*(?:la|pentru)\s+al\s+(?:doilea|2-lea)\s+produs)$`)
+	minQuantityPattern = regexp.MustCompile(`[,;]?\s*\bmin(?:im)?\.?\s*(\d+)\s*(?:buc\.?|produse)`)
+)
+
+// ParsePrice reads the Romanian price notations found on leaflets:
+// "7,49 lei", "7.49 LEI", "749 bani", "1.299,99 lei", "2 pentru 10 lei",
+// "-30%", per-unit prices like "24,90 lei/kg" or "24,90 lei pe kg" and the
+// promo mechanics "2+1 gratis" and "al doilea produs -50%". "2 x 3,49 lei"
+// is 3,49 lei per item when buying 2, unlike "2 pentru 10 lei". A minimum
+// quantity such as "min. 3 buc" may follow any of them.
+func ParsePrice(label string) (ParsedPrice, error) {
+	s := strings.ToLower(strings.TrimSpace(strings.ReplaceAll(label, "\u00a0", " ")))
+
+	minQuantity := 0
+	if m := minQuantityPattern.FindStringSubmatch(s); m != nil {
+		minQuantity, _ = strconv.Atoi(m[1])
+		s = strings.TrimSpace(strings.Replace(s, m[0], "", 1))
+	}
+
+	result, err := parsePriceMechanics(s, label)
+	if err != nil {
+		return ParsedPrice{}, err
+	}
+	result.MinQuantity = max(result.MinQuantity, minQuantity)
+	return result, nil
+}
+
+// parsePriceMechanics parses a normalized label without its minimum
+// quantity; label is the original text for error messages
+func parsePriceMechanics(s, label string) (ParsedPrice, error) {
+	if m := percentOffPattern.FindStringSubmatch(s); m != nil {
+		discount, err := parseDiscount(m[1], label)
+		if err != nil {
+			return ParsedPrice{}, err
+		}
+		return ParsedPrice{PromoType: PromoPercentOff, Discount: discount}, nil
+	}
+
+	if m := secondItemPattern.FindStringSubmatch(s); m != nil {
+		discount, err := parseDiscount(m[1]+m[2], label)
+		if err != nil {
+			return ParsedPrice{}, err
+		}
+		return ParsedPrice{PromoType: PromoSecondItem, Discount: discount, MinQuantity: 2}, nil
+	}
+
+	if m := buyGetFreePattern.FindStringSubmatch(s); m != nil {
+		bought, _ := strconv.Atoi(m[1])
+		free, _ := strconv.Atoi(m[2])
+		if bought < 1 || free < 1 {
+			return ParsedPrice{}, fmt.Errorf("invalid promo %q", label)
+		}
+		return ParsedPrice{PromoType: PromoBuyGetFree, Quantity: bought, Free: free, MinQuantity: bought + free}, nil
+	}
+
+	result := ParsedPrice{PromoType: PromoRegular}
+	if m := multiBuyPattern.FindStringSubmatch(s); m != nil {
+		quantity, _ := strconv.Atoi(m[1])
+		if quantity < 2 {
+			return ParsedPrice{}, fmt.Errorf("invalid multi-buy quantity %q", label)
+		}
+		// "x" multiplies a per-item price, the others give the total
+		if m[2] != "x" {
+			result.PromoType = PromoMultiBuy
+			result.Quantity = quantity
+		}
+		result.MinQuantity = quantity
+		s = m[3]
+	}
+
+	m := amountPattern.FindStringSubmatch(s)
+	if m == nil {
+		return ParsedPrice{}, fmt.Errorf("no price in %q", label)
+	}
+	amount, err := parseDecimal(m[1])
+	if err != nil {
+		return ParsedPrice{}, fmt.Errorf("invalid price %q: %v", label, err)
+	}
+	if m[2] == "bani" {
+		amount /= 100
+	}
+	result.Price = amount
+	result.Currency = "RON"
+
+	if u := perUnitPattern.FindStringSubmatch(s); u != nil {
+		result.Unit = u[1]
+	}
+	return result, nil
+}
+
+// parseDiscount parses a percentage between 0 and 100, exclusive
+func parseDiscount(s, label string) (float64, error) {
+	discount, err := parseDecimal(s)
+	if err != nil || discount <= 0 || discount >= 100 {
+		return 0, fmt.Errorf("invalid discount %q", label)
+	}
+	return discount, nil
+}
+
+// EffectiveUnitPrice returns what one item really costs when buying enough
+// items for the promo to apply. Promos that carry no price of their own
+// (percent-off, buy-get-free, second-item) apply to regular, the item's
+// regular price.
+func (p ParsedPrice) EffectiveUnitPrice(regular float64) float64 {
+	switch p.PromoType {
+	case PromoMultiBuy:
+		return p.Price / float64(p.Quantity)
+	case PromoPercentOff:
+		return regular * (1 - p.Discount/100)
+	case PromoBuyGetFree:
+		return regular * float64(p.Quantity) / float64(p.Quantity+p.Free)
+	case PromoSecondItem:
+		return regular * (2 - p.Discount/100) / 2
+	default:
+		return p.Price
+	}
+}
+
+// parseDecimal parses a number written with either "," or "." as decimal
+// separator and the other as thousands separator. A lone separator
+// followed by exactly three digits is a thousands separator ("1.299").
+func parseDecimal(s string) (float64, error) {
+	s = strings.TrimRight(s, ".,")
+	decimal := max(strings.LastIndex(s, ","), strings.LastIndex(s, "."))
+	if !strings.Contains(s, ",") || !strings.Contains(s, ".") {
+		// With a single kind of separator, repeated or three trailing
+		// digits mean it groups thousands
+		if decimal >= 0 && (strings.Count(s, s[decimal:decimal+1]) > 1 || len(s)-decimal-1 == 3) {
+			decimal = -1
+		}
+	}
+
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case i == decimal:
+			b.WriteByte('.')
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		}
+	}
+	return strconv.ParseFloat(b.String(), 64)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		label string
+		want  ParsedPrice
+	}{
+		{"7,49 lei", ParsedPrice{Price: 7.49, Currency: "RON", PromoType: PromoRegular}},
+		{"7.49 LEI", ParsedPrice{Price: 7.49, Currency: "RON", PromoType: PromoRegular}},
+		{"7,49\u00a0lei", ParsedPrice{Price: 7.49, Currency: "RON", PromoType: PromoRegular}},
+		{"12 RON", ParsedPrice{Price: 12, Currency: "RON", PromoType: PromoRegular}},
+		{"749 bani", ParsedPrice{Price: 7.49, Currency: "RON", PromoType: PromoRegular}},
+		{"99 bani", ParsedPrice{Price: 0.99, Currency: "RON", PromoType: PromoRegular}},
+		{"1.299,99 lei", ParsedPrice{Price: 1299.99, Currency: "RON", PromoType: PromoRegular}},
+		{"1,299.99 lei", ParsedPrice{Price: 1299.99, Currency: "RON", PromoType: PromoRegular}},
+		{"1.299 lei", ParsedPrice{Price: 1299, Currency: "RON", PromoType: PromoRegular}},
+		{"24,90 lei/kg", ParsedPrice{Price: 24.90, Currency: "RON", PromoType: PromoRegular, Unit: "kg"}},
+		{"24,90 LEI/KG", ParsedPrice{Price: 24.90, Currency: "RON", PromoType: PromoRegular, Unit: "kg"}},
+		{"8,99 lei pe l", ParsedPrice{Price: 8.99, Currency: "RON", PromoType: PromoRegular, Unit: "l"}},
+		{"2 pentru 10 lei", ParsedPrice{Price: 10, Currency: "RON", PromoType: PromoMultiBuy, Quantity: 2, MinQuantity: 2}},
+		{"3 buc. la 9,99 lei", ParsedPrice{Price: 9.99, Currency: "RON", PromoType: PromoMultiBuy, Quantity: 3, MinQuantity: 3}},
+		{"2 x 3,49 lei", ParsedPrice{Price: 3.49, Currency: "RON", PromoType: PromoRegular, MinQuantity: 2}},
+		{"-30%", ParsedPrice{PromoType: PromoPercentOff, Discount: 30}},
+		{"- 25,5 %", ParsedPrice{PromoType: PromoPercentOff, Discount: 25.5}},
+		{"2+1 gratis", ParsedPrice{PromoType: PromoBuyGetFree, Quantity: 2, Free: 1, MinQuantity: 3}},
+		{"al doilea produs -50%", ParsedPrice{PromoType: PromoSecondItem, Discount: 50, MinQuantity: 2}},
+		{"-50% la al 2-lea produs", ParsedPrice{PromoType: PromoSecondItem, Discount: 50, MinQuantity: 2}},
+		{"4,99 lei, min. 3 buc", ParsedPrice{Price: 4.99, Currency: "RON", PromoType: PromoRegular, MinQuantity: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			got, err := ParsePrice(tt.label)
+			if err != nil {
+				t.Fatalf("ParsePrice(%q): %v", tt.label, err)
+			}
+			if math.Abs(got.Price-tt.want.Price) < 1e-9 {
+				got.Price = tt.want.Price
+			}
+			if got != tt.want {
+				t.Errorf("ParsePrice(%q) = %+v, want %+v", tt.label, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePriceErrors(t *testing.T) {
+	for _, label := range []string{"", "gratis", "7,49", "-0%", "-100%", "1 pentru 5 lei", "0+1 gratis"} {
+		if got, err := ParsePrice(label); err == nil {
+			t.Errorf("ParsePrice(%q) = %+v, want an error", label, got)
+		}
+	}
+}
+
+func TestEffectiveUnitPrice(t *testing.T) {
+	tests := []struct {
+		label   string
+		regular float64
+		want    float64
+	}{
+		{"7,49 lei", 0, 7.49},
+		{"2 pentru 10 lei", 0, 5},
+		{"2 x 3,49 lei", 0, 3.49},
+		{"-30%", 10, 7},
+		{"2+1 gratis", 9, 6},
+		{"al doilea produs -50%", 10, 7.5},
+	}
+	for _, tt := range tests {
+		p, err := ParsePrice(tt.label)
+		if err != nil {
+			t.Fatalf("ParsePrice(%q): %v", tt.label, err)
+		}
+		if got := p.EffectiveUnitPrice(tt.regular); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%q at regular %v costs %v per item, want %v", tt.label, tt.regular, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// errCatalogChanged is returned by cover-only scrapes that found a catalog
+// not stored yet, or one that changed since it was stored
+var errCatalogChanged = errors.New("catalog is new or changed")
+
+// probeCatalog is the cover-only scrape: it tells whether the catalog of
+// config needs a full scrape without visiting every page. A catalog that
+// isn't downloaded in full needs one right away; a stored one is opened to
+// compare its page count and first page with the stored newsletter.
+func probeCatalog(ctx context.Context, config *ScraperConfig, strategy ScraperStrategy, imageScript string) error {
+	if optOuts.IsOptedOut(config.StoreName()) {
+		return fmt.Errorf("store %s opted out of archiving", config.StoreName())
+	}
+	id, err := config.NewsletterID()
+	if err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+	logger := logFrom(ctx).With("newsletter", id)
+	if !catalogDownloaded(id) {
+		logger.Info("probe: catalog is not downloaded yet")
+		return errCatalogChanged
+	}
+	stored, _ := newsletters.Get(id)
+	storedFirst, _ := localImagePath(stored.Pages[0].ImageURL)
+
+	probeCtx, cancel := context.WithTimeout(ctx, 120*time.Second)
+	defer cancel()
+	taskCtx, cancelBrowser := newBrowserContext(probeCtx)
+	defer cancelBrowser()
+
+	session := &scrapeSession{ctx: taskCtx, config: config, imageScript: imageScript, download: downloadImage}
+	defer session.close()
+	pages, err := strategy.Pages(session)
+	if err != nil {
+		return err
+	}
+	if len(pages) != stored.PageCount {
+		logger.Info("probe: page count changed", "pages", len(pages), "stored_pages", stored.PageCount)
+		return errCatalogChanged
+	}
+
+	tmp, err := os.CreateTemp("", "probe-*.jpg")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if _, err := strategy.Download(session, pages[0], tmp.Name()); err != nil {
+		return fmt.Errorf("failed to download first page: %v", err)
+	}
+
+	current, err := fileHash(tmp.Name())
+	if err != nil {
+		return err
+	}
+	if previous, err := fileHash(storedFirst); err != nil || previous != current {
+		logger.Info("probe: first page changed")
+		return errCatalogChanged
+	}
+
+	logger.Info("probe: catalog is unchanged")
+	return errCatalogUnchanged
+}
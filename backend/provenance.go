@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// PageProvenance records where one downloaded image came from
+type PageProvenance struct {
+	Page        int       `json:"page"`
+	PageURL     string    `json:"pageUrl"`
+	ImageURL    string    `json:"imageUrl"`
+	RetrievedAt time.Time `json:"retrievedAt"`
+	SHA256      string    `json:"sha256"`
+}
+
+// Provenance documents the origin of a newsletter's stored images, for
+// transparency and for answering disputes about scraped content
+type Provenance struct {
+	NewsletterID string           `json:"newsletterId"`
+	ConfigID     string           `json:"configId"`
+	SourceURL    string           `json:"sourceUrl"`
+	RetrievedAt  time.Time        `json:"retrievedAt"`
+	Replayed     bool             `json:"replayed,omitempty"`
+	Cover        *PageProvenance  `json:"cover,omitempty"`
+	Pages        []PageProvenance `json:"pages"`
+}
+
+func provenancePath(dir string) string {
+	return filepath.Join(dir, "provenance.json")
+}
+
+// pageProvenance describes a downloaded image, hashing the stored file
+func pageProvenance(page int, pageURL, imageURL, path string) PageProvenance {
+	entry := PageProvenance{Page: page, PageURL: pageURL, ImageURL: imageURL, RetrievedAt: time.Now()}
+	entry.SHA256, _ = fileHash(path)
+	return entry
+}
+
+// Save writes the provenance next to the newsletter's images in dir
+func (p *Provenance) Save(dir string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(provenancePath(dir), data, filePerm)
+}
+
+// API Handlers
+
+func getProvenance(w http.ResponseWriter, r *http.Request) {
+	n, ok := newsletters.Get(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Newsletter not found", http.StatusNotFound)
+		return
+	}
+
+	data, err := os.ReadFile(provenancePath(dataDir(n)))
+	if os.IsNotExist(err) {
+		http.Error(w, "No provenance archived for this newsletter", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error reading provenance", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// StoreQuality summarizes data problems for one store
+type StoreQuality struct {
+	Store           string   `json:"store"`
+	Newsletters     int      `json:"newsletters"`
+	MissingPages    []string `json:"missingPages"`
+	InvalidDates    []string `json:"invalidDates"`
+	DuplicateCovers []string `json:"duplicateCovers"`
+}
+
+// missingPages reports whether a newsletter has gaps in its page numbers or
+// page images that are gone from disk
+func missingPages(n Newsletter) bool {
+	if len(n.Pages) == 0 {
+		return true
+	}
+	for i, page := range n.Pages {
+		if i > 0 && page.PageNumber != n.Pages[i-1].PageNumber+1 {
+			return true
+		}
+		if path, ok := localImagePath(page.ImageURL); ok {
+			if _, err := os.Stat(path); err != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// invalidDates reports whether a newsletter's validity period is missing or malformed
+func invalidDates(n Newsletter) bool {
+	from, err := time.Parse("2006-01-02", n.ValidFrom)
+	if err != nil {
+		return true
+	}
+	until, err := time.Parse("2006-01-02", n.ValidUntil)
+	if err != nil {
+		return true
+	}
+	return until.Before(from)
+}
+
+// fileHash returns the SHA-256 of a file
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// getQualityReport summarizes per-store data issues so maintainers know
+// which scrapers need fixing
+func getQualityReport(w http.ResponseWriter, r *http.Request) {
+	stores := map[string]*StoreQuality{}
+	coverOwners := map[string][]Newsletter{}
+
+	for _, n := range newsletters.List() {
+		q, ok := stores[n.Store]
+		if !ok {
+			q = &StoreQuality{Store: n.Store, MissingPages: []string{}, InvalidDates: []string{}, DuplicateCovers: []string{}}
+			stores[n.Store] = q
+		}
+		q.Newsletters++
+
+		if missingPages(n) {
+			q.MissingPages = append(q.MissingPages, n.ID)
+		}
+		if invalidDates(n) {
+			q.InvalidDates = append(q.InvalidDates, n.ID)
+		}
+		if path, ok := localImagePath(n.CoverImage); ok {
+			if hash, err := fileHash(path); err == nil {
+				coverOwners[hash] = append(coverOwners[hash], n)
+			}
+		}
+	}
+
+	for _, owners := range coverOwners {
+		if len(owners) < 2 {
+			continue
+		}
+		for _, n := range owners {
+			stores[n.Store].DuplicateCovers = append(stores[n.Store].DuplicateCovers, n.ID)
+		}
+	}
+
+	report := make([]*StoreQuality, 0, len(stores))
+	for _, q := range stores {
+		report = append(report, q)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Store < report[j].Store })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRateLimit        = 120 // API requests per minute
+	defaultRateLimitBurst   = 60
+	defaultScrapeLimit      = 10 // scrapes per hour
+	defaultScrapeLimitBurst = 3
+)
+
+// tokenBucket holds the requests a client may still make
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter is a token bucket per client: every client may make burst
+// requests at once, refilled at rate per second
+type RateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+// NewRateLimiter allows limit requests per period with bursts of burst;
+// nil, which allows everything, when limit is 0
+func NewRateLimiter(limit int, period time.Duration, burst int) *RateLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &RateLimiter{
+		rate:    float64(limit) / period.Seconds(),
+		burst:   float64(max(burst, 1)),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// Allow takes a request from the bucket of key. When it is empty, it
+// returns how long until the next request is allowed.
+func (l *RateLimiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Buckets that refilled completely are the same as new ones
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.swept) > refill {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > refill {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// Refund gives back a request Allow took from the bucket of key
+func (l *RateLimiter) Refund(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[key]; ok {
+		b.tokens = math.Min(l.burst, b.tokens+1)
+	}
+}
+
+// rateLimits are the API's limiters, configured from env:
+//
+//	RATE_LIMIT               API requests per minute and client (default 120, 0 disables)
+//	RATE_LIMIT_BURST         requests a client may make at once (default 60)
+//	SCRAPE_RATE_LIMIT        scrapes and store discoveries per hour and client
+//	                         (default 10, 0 disables); they count against
+//	                         RATE_LIMIT too
+//	SCRAPE_RATE_LIMIT_BURST  scrapes a client may start at once (default 3)
+//	TRUST_PROXY              "true" to take the client address from the
+//	                         X-Forwarded-For header set by a proxy in front,
+//	                         and the scheme and host of absolute links from
+//	                         X-Forwarded-Proto and X-Forwarded-Host
+var rateLimits = struct {
+	api, scrape *RateLimiter
+	trustProxy  bool
+}{
+	api:        NewRateLimiter(envInt("RATE_LIMIT", defaultRateLimit), time.Minute, envInt("RATE_LIMIT_BURST", defaultRateLimitBurst)),
+	scrape:     NewRateLimiter(envInt("SCRAPE_RATE_LIMIT", defaultScrapeLimit), time.Hour, envInt("SCRAPE_RATE_LIMIT_BURST", defaultScrapeLimitBurst)),
+	trustProxy: os.Getenv("TRUST_PROXY") == "true",
+}
+
+// envInt reads a non-negative integer from env, falling back to def for
+// unset or invalid values
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		slog.Warn("invalid setting, using the default", "setting", name, "value", v, "default", def)
+		return def
+	}
+	return n
+}
+
+// clientIP returns the address requests are limited by: the peer address,
+// or with TRUST_PROXY the last address in X-Forwarded-For, which the proxy
+// appended itself and clients can't forge
+func clientIP(r *http.Request) string {
+	if rateLimits.trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			hops := strings.Split(forwarded, ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// startsChrome reports whether a request starts a browser on retailer sites
+func startsChrome(r *http.Request) bool {
+	return r.Method == "POST" && (strings.HasPrefix(r.URL.Path, "/api/scrape/") || r.URL.Path == "/api/stores/discover")
+}
+
+// limitRate rejects API requests of clients over their rate limit, with a
+// stricter limit on requests that start a browser. A request refused by
+// one limit doesn't count against the others.
+func limitRate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		now := time.Now()
+		limiters := []*RateLimiter{rateLimits.api}
+		if startsChrome(r) {
+			limiters = append(limiters, rateLimits.scrape)
+		}
+		for i, l := range limiters {
+			if l == nil {
+				continue
+			}
+			if ok, wait := l.Allow(ip, now); !ok {
+				for _, taken := range limiters[:i] {
+					if taken != nil {
+						taken.Refund(ip)
+					}
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
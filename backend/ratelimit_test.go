@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestRefusedScrapeKeepsAPIAllowance sends scrapes past the scrape limit;
+// the refused ones must not use up the general API allowance
+func TestRefusedScrapeKeepsAPIAllowance(t *testing.T) {
+	defer func(api, scrape *RateLimiter) { rateLimits.api, rateLimits.scrape = api, scrape }(rateLimits.api, rateLimits.scrape)
+	rateLimits.api = NewRateLimiter(3, time.Hour, 3)
+	rateLimits.scrape = NewRateLimiter(1, time.Hour, 1)
+
+	handler := limitRate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	send := func(method, path string) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w.Code
+	}
+
+	if code := send("POST", "/api/scrape/lidl"); code != http.StatusOK {
+		t.Fatalf("first scrape: status %d", code)
+	}
+	for i := 0; i < 5; i++ {
+		if code := send("POST", "/api/scrape/lidl"); code != http.StatusTooManyRequests {
+			t.Fatalf("scrape over the limit: status %d, want 429", code)
+		}
+	}
+	// The first scrape took one of three API requests
+	for i := 0; i < 2; i++ {
+		if code := send("GET", "/api/newsletters"); code != http.StatusOK {
+			t.Fatalf("API request %d after refused scrapes: status %d", i+1, code)
+		}
+	}
+	if code := send("GET", "/api/newsletters"); code != http.StatusTooManyRequests {
+		t.Fatalf("API request over the limit: status %d, want 429", code)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+var recordingsDir = dataPath(".recordings")
+
+// ScrapeOptions controls a single scrape run
+type ScrapeOptions struct {
+	// Record saves every response the scrape receives into a recording
+	Record bool
+	// Replay serves every request from a previous recording instead of the live site
+	Replay bool
+	// Progress, if set, is called with the number of pages downloaded so far
+	Progress func(downloaded, total int)
+	// Force scrapes a catalog even if it is already downloaded
+	Force bool
+	// CoverOnly only checks whether the catalog is new or changed, see
+	// probeCatalog
+	CoverOnly bool
+	// RequestID is the API request the scrape was started by, for the logs
+	RequestID string
+}
+
+// RecordedResponse is one archived HTTP response; the body is stored in a
+// separate file next to the index
+type RecordedResponse struct {
+	URL      string            `json:"url"`
+	Status   int               `json:"status"`
+	Headers  map[string]string `json:"headers"`
+	BodyFile string            `json:"bodyFile"`
+}
+
+// Recording is a HAR-like archive of the responses seen during a scrape
+type Recording struct {
+	ConfigID   string                       `json:"configId"`
+	RecordedAt time.Time                    `json:"recordedAt"`
+	Entries    map[string]*RecordedResponse `json:"entries"`
+
+	mu  sync.Mutex
+	dir string
+}
+
+// NewRecording starts an empty recording for a config
+func NewRecording(configID string) (*Recording, error) {
+	dir := filepath.Join(recordingsDir, configID)
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "bodies"), dirPerm); err != nil {
+		return nil, err
+	}
+	return &Recording{
+		ConfigID:   configID,
+		RecordedAt: time.Now(),
+		Entries:    make(map[string]*RecordedResponse),
+		dir:        dir,
+	}, nil
+}
+
+// LoadRecording opens the recording previously saved for a config
+func LoadRecording(configID string) (*Recording, error) {
+	dir := filepath.Join(recordingsDir, configID)
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		return nil, fmt.Errorf("no recording for %s: %v", configID, err)
+	}
+
+	rec := &Recording{dir: dir}
+	if err := json.Unmarshal(data, rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Save writes the recording index to disk
+func (rec *Recording) Save() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(rec.dir, "index.json"), data, filePerm)
+}
+
+// add archives a response body
+func (rec *Recording) add(url string, status int, headers map[string]string, body []byte) error {
+	sum := sha256.Sum256([]byte(url))
+	bodyFile := hex.EncodeToString(sum[:])
+	if err := os.WriteFile(filepath.Join(rec.dir, "bodies", bodyFile), body, filePerm); err != nil {
+		return err
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.Entries[url] = &RecordedResponse{URL: url, Status: status, Headers: headers, BodyFile: bodyFile}
+	return nil
+}
+
+// lookup returns the archived response and body for a URL
+func (rec *Recording) lookup(url string) (*RecordedResponse, []byte, error) {
+	rec.mu.Lock()
+	entry, ok := rec.Entries[url]
+	rec.mu.Unlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("%s not in recording", url)
+	}
+
+	body, err := os.ReadFile(filepath.Join(rec.dir, "bodies", entry.BodyFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	return entry, body, nil
+}
+
+// Attach intercepts the browser's network traffic on ctx: in record mode
+// responses are archived on their way to the page, in replay mode requests
+// are answered from the archive and never reach the network
+func (rec *Recording) Attach(ctx context.Context, replay bool) error {
+	stage := fetch.RequestStageResponse
+	if replay {
+		stage = fetch.RequestStageRequest
+	}
+
+	chromedp.ListenTarget(ctx, func(ev any) {
+		e, ok := ev.(*fetch.EventRequestPaused)
+		if !ok {
+			return
+		}
+		go func() {
+			c := chromedp.FromContext(ctx)
+			execCtx := cdp.WithExecutor(ctx, c.Target)
+
+			var err error
+			if replay {
+				err = rec.replayRequest(execCtx, e)
+			} else {
+				err = rec.recordResponse(execCtx, e)
+			}
+			if err != nil {
+				logFrom(ctx).Warn("failed to record request", "url", e.Request.URL, "err", err)
+			}
+		}()
+	})
+
+	return chromedp.Run(ctx, fetch.Enable().WithPatterns([]*fetch.RequestPattern{
+		{URLPattern: "*", RequestStage: stage},
+	}))
+}
+
+func (rec *Recording) recordResponse(ctx context.Context, e *fetch.EventRequestPaused) error {
+	// Redirects and failed requests have no body to archive
+	if e.ResponseErrorReason != "" || (e.ResponseStatusCode >= 300 && e.ResponseStatusCode < 400) {
+		return fetch.ContinueRequest(e.RequestID).Do(ctx)
+	}
+
+	body, err := fetch.GetResponseBody(e.RequestID).Do(ctx)
+	if err == nil {
+		headers := make(map[string]string, len(e.ResponseHeaders))
+		for _, h := range e.ResponseHeaders {
+			headers[h.Name] = h.Value
+		}
+		err = rec.add(e.Request.URL, int(e.ResponseStatusCode), headers, body)
+	}
+
+	if contErr := fetch.ContinueRequest(e.RequestID).Do(ctx); contErr != nil {
+		return contErr
+	}
+	return err
+}
+
+func (rec *Recording) replayRequest(ctx context.Context, e *fetch.EventRequestPaused) error {
+	entry, body, err := rec.lookup(e.Request.URL)
+	if err != nil {
+		return fetch.FailRequest(e.RequestID, network.ErrorReasonInternetDisconnected).Do(ctx)
+	}
+
+	var headers []*fetch.HeaderEntry
+	for name, value := range entry.Headers {
+		headers = append(headers, &fetch.HeaderEntry{Name: name, Value: value})
+	}
+	return fetch.FulfillRequest(e.RequestID, int64(entry.Status)).
+		WithResponseHeaders(headers).
+		WithBody(base64.StdEncoding.EncodeToString(body)).
+		Do(ctx)
+}
+
+// DownloadImage downloads an image like downloadImage, archiving the
+// response in record mode and reading it from the archive in replay mode
+func (rec *Recording) DownloadImage(imageURL, filePath string, replay bool) error {
+	if replay {
+		entry, body, err := rec.lookup(imageURL)
+		if err != nil {
+			return err
+		}
+		if entry.Status != http.StatusOK {
+			return fmt.Errorf("HTTP %d", entry.Status)
+		}
+		return os.WriteFile(filePath, body, filePerm)
+	}
+
+	resp, err := http.Get(imageURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	imageBytes.add(float64(len(body)))
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{"Content-Type": resp.Header.Get("Content-Type")}
+	if err := rec.add(imageURL, resp.StatusCode, headers, body); err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, body, filePerm)
+}
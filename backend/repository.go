@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// Storage backends, selected by STORAGE_BACKEND
+const (
+	BackendSQLite = "sqlite"
+	BackendJSON   = "json"
+)
+
+// Repository persists newsletters
+type Repository interface {
+	// Load returns every stored newsletter
+	Load() ([]Newsletter, error)
+	// Upsert stores a newsletter, replacing the one with the same ID
+	Upsert(n Newsletter) error
+	// ReplaceStore swaps all newsletters of a store for list
+	ReplaceStore(store string, list []Newsletter) error
+	// SaveAll replaces everything stored with list
+	SaveAll(list []Newsletter) error
+}
+
+var (
+	repoOnce sync.Once
+	repo     Repository
+	repoErr  error
+)
+
+// repository opens the backend named by STORAGE_BACKEND once: "sqlite" (the
+// default, ../newsletters/bestdeal.db) or "json" (newsletters.json)
+func repository() (Repository, error) {
+	repoOnce.Do(func() {
+		switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+		case "", BackendSQLite:
+			repo, repoErr = openSQLiteRepository(databaseFile)
+		case BackendJSON:
+			repo = jsonRepository{path: newslettersFile}
+		default:
+			repoErr = fmt.Errorf("unknown STORAGE_BACKEND %q", backend)
+		}
+	})
+	return repo, repoErr
+}
+
+// jsonRepository keeps all newsletters in a single JSON file
+type jsonRepository struct {
+	path string
+}
+
+// Load implements Repository
+func (r jsonRepository) Load() ([]Newsletter, error) {
+	data, err := os.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Newsletter
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Upsert implements Repository
+func (r jsonRepository) Upsert(n Newsletter) error {
+	list, err := r.Load()
+	if err != nil {
+		return err
+	}
+	for i := range list {
+		if list[i].ID == n.ID {
+			list[i] = n
+			return r.SaveAll(list)
+		}
+	}
+	return r.SaveAll(append(list, n))
+}
+
+// ReplaceStore implements Repository
+func (r jsonRepository) ReplaceStore(store string, list []Newsletter) error {
+	current, err := r.Load()
+	if err != nil {
+		return err
+	}
+	kept := current[:0]
+	for _, n := range current {
+		if n.Store != store {
+			kept = append(kept, n)
+		}
+	}
+	return r.SaveAll(append(kept, list...))
+}
+
+// SaveAll implements Repository
+func (r jsonRepository) SaveAll(list []Newsletter) error {
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, data, filePerm)
+}
+
+// runImport loads newsletters from a JSON export, such as a newsletters.json
+// from an older installation, into the configured repository. Newsletters
+// with the same ID are replaced.
+func runImport(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: import <newsletters.json>")
+	}
+	list, err := jsonRepository{path: args[0]}.Load()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", args[0], err)
+	}
+	if list == nil {
+		return fmt.Errorf("%s not found", args[0])
+	}
+
+	repo, err := repository()
+	if err != nil {
+		return err
+	}
+	for _, n := range list {
+		if n.ConfigID == "" {
+			n.ConfigID = n.ID
+		}
+		if err := repo.Upsert(n); err != nil {
+			return fmt.Errorf("failed to import %s: %v", n.ID, err)
+		}
+	}
+	slog.Info("imported newsletters", "count", len(list), "from", args[0])
+	return nil
+}
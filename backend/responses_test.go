@@ -0,0 +1,170 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// listAt returns the list at key in a JSON object, or the value itself
+// when key is empty, failing unless it is a list (null isn't)
+func listAt(t *testing.T, v interface{}, key string) []interface{} {
+	t.Helper()
+	if key != "" {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			t.Fatalf("response is %T, want an object", v)
+		}
+		v = obj[key]
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		t.Fatalf("%q is %v, want a list", key, v)
+	}
+	return list
+}
+
+func TestEmptyListsAreArrays(t *testing.T) {
+	withNewsletters(t, []Newsletter{})
+
+	tests := []struct {
+		path, key string
+	}{
+		{"/api/newsletters", "items"},
+		{"/api/newsletters?limit=5", "items"},
+		{"/api/newsletters?page=3&pageSize=5", "items"},
+		{"/api/newsletters?store=lidl&activeOnly=true", "items"},
+		{"/api/groups/schwarz/newsletters", "items"},
+		{"/api/schedule", ""},
+		{"/api/stores", "stores"},
+		{"/api/stores", "configs"},
+		{"/api/search?q=lapte", "results"},
+		{"/api/widget/latest", ""},
+		{"/api/config/client", "stores"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.key, func(t *testing.T) {
+			v := decodeJSON(t, request(t, "GET", tt.path, ""), 200)
+			if list := listAt(t, v, tt.key); len(list) != 0 {
+				t.Errorf("got %d items, want none", len(list))
+			}
+		})
+	}
+}
+
+func TestListingEnvelope(t *testing.T) {
+	now := time.Now()
+	withNewsletters(t, []Newsletter{
+		{ID: "lidl-a", Store: "lidl", Title: "A", Pages: []Page{}, LastUpdated: now},
+		{ID: "lidl-b", Store: "lidl", Title: "B", Pages: []Page{}, LastUpdated: now.Add(-time.Hour)},
+		{ID: "lidl-c", Store: "lidl", Title: "C", Pages: []Page{}, LastUpdated: now.Add(-2 * time.Hour)},
+	})
+
+	tests := []struct {
+		path       string
+		items      int
+		limit      int
+		nextCursor bool
+		numbered   bool
+	}{
+		{"/api/newsletters", 3, 3, false, false},
+		{"/api/newsletters?limit=2", 2, 2, true, false},
+		{"/api/newsletters?limit=5", 3, 5, false, false},
+		{"/api/newsletters?page=2&pageSize=2", 1, 2, false, true},
+		{"/api/newsletters?page=9&pageSize=2", 0, 2, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := request(t, "GET", tt.path, "")
+			page := decodeJSON(t, w, 200).(map[string]interface{})
+			if got := w.Header().Get("X-Total-Count"); got != "3" {
+				t.Errorf("X-Total-Count %q, want 3", got)
+			}
+			for _, key := range []string{"items", "nextCursor", "limit", "total"} {
+				if _, ok := page[key]; !ok {
+					t.Errorf("missing %s", key)
+				}
+			}
+			if got := len(listAt(t, page, "items")); got != tt.items {
+				t.Errorf("%d items, want %d", got, tt.items)
+			}
+			if page["total"] != 3.0 || page["limit"] != float64(tt.limit) {
+				t.Errorf("total %v and limit %v, want 3 and %d", page["total"], page["limit"], tt.limit)
+			}
+			if _, ok := page["nextCursor"].(string); ok != tt.nextCursor {
+				t.Errorf("nextCursor %v, want a cursor: %v", page["nextCursor"], tt.nextCursor)
+			}
+			if _, ok := page["page"]; ok != tt.numbered {
+				t.Errorf("page %v, want one: %v", page["page"], tt.numbered)
+			}
+		})
+	}
+
+	t.Run("cursor", func(t *testing.T) {
+		first := decodeJSON(t, request(t, "GET", "/api/newsletters?limit=2", ""), 200).(map[string]interface{})
+		next := decodeJSON(t, request(t, "GET", "/api/newsletters?limit=2&cursor="+first["nextCursor"].(string), ""), 200).(map[string]interface{})
+		items := listAt(t, next, "items")
+		if len(items) != 1 || items[0].(map[string]interface{})["id"] != "lidl-c" || next["nextCursor"] != nil {
+			t.Errorf("second page %v, want only lidl-c and no cursor", next)
+		}
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		w := request(t, "GET", "/api/newsletters?limit=2", "", "Accept", ndjsonContentType)
+		if lines := strings.Count(w.Body.String(), "\n"); lines != 2 {
+			t.Errorf("%d lines, want 2", lines)
+		}
+		if w.Header().Get("X-Next-Cursor") == "" {
+			t.Error("missing X-Next-Cursor")
+		}
+	})
+}
+
+func TestErrorShapes(t *testing.T) {
+	withNewsletters(t, []Newsletter{})
+
+	t.Run("validation errors are JSON", func(t *testing.T) {
+		tests := []struct {
+			method, path, body, field string
+		}{
+			{"POST", "/api/share", `{}`, "newsletterId"},
+			{"POST", "/api/tokens", `{"scopes": ["read:newsletters"]}`, "name"},
+			{"POST", "/api/tokens", `{`, ""},
+			{"POST", "/api/tokens", `{"name": "x", "unknown": 1}`, "unknown"},
+		}
+		for _, tt := range tests {
+			v := decodeJSON(t, request(t, tt.method, tt.path, tt.body), 400)
+			obj, _ := v.(map[string]interface{})
+			if msg, _ := obj["error"].(string); msg == "" {
+				t.Errorf("%s %s %s: no error message in %v", tt.method, tt.path, tt.body, v)
+			}
+			if field, _ := obj["field"].(string); field != tt.field {
+				t.Errorf("%s %s %s: field %q, want %q", tt.method, tt.path, tt.body, field, tt.field)
+			}
+		}
+	})
+
+	t.Run("other errors are text", func(t *testing.T) {
+		tests := []struct {
+			method, path string
+			status       int
+		}{
+			{"GET", "/api/newsletters/missing", 404},
+			{"GET", "/api/stores/missing/newsletters", 404},
+			{"GET", "/api/groups/missing/newsletters", 404},
+			{"GET", "/api/newsletters?limit=0", 400},
+			{"GET", "/api/newsletters?limit=2&pageSize=2", 400},
+			{"GET", "/api/newsletters?cursor=not-a-cursor", 400},
+			{"GET", "/api/admin/costs", 401},
+		}
+		for _, tt := range tests {
+			w := request(t, tt.method, tt.path, "")
+			if w.Code != tt.status {
+				t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, w.Code, tt.status)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") || strings.TrimSpace(w.Body.String()) == "" {
+				t.Errorf("%s %s: %q body %q, want a text message", tt.method, tt.path, ct, w.Body)
+			}
+		}
+	})
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var rollbackDir = dataPath(".rollback")
+
+// storeLocks serializes scrapes and rollbacks per store, so a snapshot
+// always describes the store as the next scrape found it
+var storeLocks sync.Map
+
+func storeLock(store string) *sync.Mutex {
+	mu, _ := storeLocks.LoadOrStore(store, &sync.Mutex{})
+	return mu.(*sync.Mutex)
+}
+
+// StoreSnapshot is a store's newsletter set before its last scrape. When
+// the scrape replaced an archived newsletter, that newsletter's directory
+// is kept in the snapshot as "data".
+type StoreSnapshot struct {
+	Store       string       `json:"store"`
+	TakenAt     time.Time    `json:"takenAt"`
+	Newsletters []Newsletter `json:"newsletters"`
+	ReplacedID  string       `json:"replacedId,omitempty"`
+	ReplacedDir string       `json:"replacedDir,omitempty"`
+
+	dir       string
+	scrapeDir string
+}
+
+// snapshotStore records a store's newsletters before a scrape of id into
+// baseDir and moves an existing baseDir aside, so the scrape writes into an
+// empty directory. The snapshot must be finished with commit or restore.
+func snapshotStore(store, id, baseDir string) (*StoreSnapshot, error) {
+	s := &StoreSnapshot{
+		Store:       store,
+		TakenAt:     time.Now(),
+		Newsletters: []Newsletter{},
+		dir:         filepath.Join(rollbackDir, store+".pending"),
+		scrapeDir:   baseDir,
+	}
+	for _, n := range newsletters.List() {
+		if n.Store == store {
+			s.Newsletters = append(s.Newsletters, n)
+		}
+	}
+
+	if err := os.RemoveAll(s.dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(s.dir, dirPerm); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(baseDir); err == nil {
+		if err := os.Rename(baseDir, filepath.Join(s.dir, "data")); err != nil {
+			return nil, err
+		}
+		s.ReplacedID, s.ReplacedDir = id, baseDir
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return s, os.WriteFile(filepath.Join(s.dir, "snapshot.json"), data, filePerm)
+}
+
+// commit keeps the snapshot after a successful scrape, replacing the
+// store's previous one
+func (s *StoreSnapshot) commit() {
+	final := filepath.Join(rollbackDir, s.Store)
+	err := os.RemoveAll(final)
+	if err == nil {
+		err = os.Rename(s.dir, final)
+	}
+	if err != nil {
+		slog.Warn("failed to keep rollback snapshot", "store", s.Store, "err", err)
+	}
+}
+
+// restore removes what a failed scrape wrote, puts back the directory it
+// replaced and drops the snapshot. Data of stores that opted out meanwhile
+// is not restored.
+func (s *StoreSnapshot) restore() {
+	os.RemoveAll(s.scrapeDir)
+	if s.ReplacedDir != "" && !optOuts.IsOptedOut(s.Store) {
+		if err := os.Rename(filepath.Join(s.dir, "data"), s.ReplacedDir); err != nil {
+			slog.Error("failed to restore after failed scrape", "dir", s.ReplacedDir, "err", err)
+			return
+		}
+	}
+	os.RemoveAll(s.dir)
+}
+
+// loadStoreSnapshot reads the kept snapshot of a store
+func loadStoreSnapshot(store string) (*StoreSnapshot, error) {
+	dir := filepath.Join(rollbackDir, store)
+	data, err := os.ReadFile(filepath.Join(dir, "snapshot.json"))
+	if err != nil {
+		return nil, err
+	}
+	var s StoreSnapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	s.dir = dir
+	return &s, nil
+}
+
+// removeStoreSnapshot forgets a store's snapshot
+func removeStoreSnapshot(store string) {
+	os.RemoveAll(filepath.Join(rollbackDir, store))
+}
+
+// rollbackStore restores a store's newsletter set from its snapshot:
+// newsletters added by the last scrape are deleted and a replaced
+// newsletter gets its previous pages back, with events for both. There is
+// one level of undo, so the snapshot is used up.
+func rollbackStore(store string) (*StoreSnapshot, error) {
+	s, err := loadStoreSnapshot(store)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := map[string]bool{}
+	for _, n := range s.Newsletters {
+		kept[n.ID] = true
+	}
+	for _, n := range newsletters.List() {
+		if n.Store == store && !kept[n.ID] && n.ID != s.ReplacedID {
+			if err := os.RemoveAll(dataDir(n)); err != nil {
+				return nil, fmt.Errorf("failed to remove %s: %v", n.ID, err)
+			}
+		}
+	}
+
+	if s.ReplacedDir != "" {
+		if err := os.RemoveAll(s.ReplacedDir); err != nil {
+			return nil, fmt.Errorf("failed to remove %s: %v", s.ReplacedID, err)
+		}
+		if err := os.Rename(filepath.Join(s.dir, "data"), s.ReplacedDir); err != nil {
+			return nil, fmt.Errorf("failed to restore %s: %v", s.ReplacedID, err)
+		}
+	}
+
+	if err := replaceStoreNewsletters(store, s.Newsletters); err != nil {
+		return nil, fmt.Errorf("failed to save newsletters: %v", err)
+	}
+	removeStoreSnapshot(store)
+	return s, nil
+}
+
+// API Handlers
+
+func rollbackStoreHandler(w http.ResponseWriter, r *http.Request) {
+	store := mux.Vars(r)["store"]
+	if optOuts.IsOptedOut(store) {
+		http.Error(w, fmt.Sprintf("Store %s opted out of archiving", store), http.StatusConflict)
+		return
+	}
+
+	lock := storeLock(store)
+	if !lock.TryLock() {
+		http.Error(w, "A scrape of this store is running", http.StatusConflict)
+		return
+	}
+	defer lock.Unlock()
+
+	s, err := rollbackStore(store)
+	if os.IsNotExist(err) {
+		http.Error(w, "No previous version to roll back to", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logFrom(r.Context()).Error("failed to roll back store", "store", store, "err", err)
+		http.Error(w, "Error rolling back store", http.StatusInternalServerError)
+		return
+	}
+	logFrom(r.Context()).Info("rolled back store", "store", store, "taken_at", s.TakenAt.Format(time.RFC3339))
+
+	ids := []string{}
+	for _, n := range s.Newsletters {
+		ids = append(ids, n.ID)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"store":       store,
+		"restoredTo":  s.TakenAt,
+		"newsletters": ids,
+	})
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schedule is a parsed five-field cron expression: minute, hour, day of
+// month, month and day of week. Fields accept *, numbers, ranges (1-5),
+// steps (*/15, 1-10/2), lists (1,15) and month and weekday names (JAN, MON).
+type Schedule struct {
+	minute, hour, dom, month, dow uint64 // bit sets of matching values
+	domAny, dowAny                bool
+}
+
+var (
+	monthNames   = []string{"", "JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+	weekdayNames = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+)
+
+// ParseSchedule parses a cron expression such as "0 6 * * MON"
+func ParseSchedule(expr string) (*Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	}
+
+	var s Schedule
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute: %v", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour: %v", err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day of month: %v", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("month: %v", err)
+	}
+	// 7 is Sunday as well
+	if s.dow, err = parseCronField(fields[4], 0, 7, weekdayNames); err != nil {
+		return nil, fmt.Errorf("day of week: %v", err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = strings.HasPrefix(fields[2], "*")
+	s.dowAny = strings.HasPrefix(fields[4], "*")
+	return &s, nil
+}
+
+// parseCronField parses one comma-separated field into a bit set
+func parseCronField(field string, low, high int, names []string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rangePart, step = part[:i], n
+		}
+
+		start, end := low, high
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if start, err = cronValue(bounds[0], names); err != nil {
+				return 0, err
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = cronValue(bounds[1], names); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// "5/15" means from 5 to the end in steps of 15
+				end = high
+			}
+		}
+		if start < low || end > high || start > end {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, low, high)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// cronValue parses a number or a name from names
+func cronValue(s string, names []string) (int, error) {
+	for i, name := range names {
+		if name != "" && strings.EqualFold(s, name) {
+			return i, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return n, nil
+}
+
+// dayMatches applies cron's rule that when both day of month and day of
+// week are restricted, a day matching either one matches
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// Next returns the first time after t the schedule fires, or the zero time
+// if it never does (such as "0 0 30 FEB *")
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// ScheduledScrape is a config with a schedule, as reported by /api/schedule
+type ScheduledScrape struct {
+	Config   string     `json:"config"`
+	Store    string     `json:"store"`
+	Schedule string     `json:"schedule"`
+	NextRun  *time.Time `json:"nextRun"`
+	LastRun  *time.Time `json:"lastRun,omitempty"`
+	LastJob  string     `json:"lastJob,omitempty"`
+	OptedOut bool       `json:"optedOut,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// Scheduler starts scrapes of configs with a schedule as jobs
+type Scheduler struct {
+	mu        sync.Mutex
+	lastCheck time.Time
+	lastRun   map[string]time.Time
+	lastJob   map[string]string
+}
+
+var scheduler = &Scheduler{lastRun: map[string]time.Time{}, lastJob: map[string]string{}}
+
+// scheduledConfigs returns the configs that have a schedule, keyed by
+// config name (the file name without .json)
+func scheduledConfigs() map[string]*ScraperConfig {
+	result := map[string]*ScraperConfig{}
+	configs, err := ListAvailableConfigs()
+	if err != nil {
+		return result
+	}
+	for _, name := range configs {
+		config, err := LoadScraperConfig(configFile(name))
+		if err != nil || config.Schedule == "" {
+			continue
+		}
+		result[strings.TrimSuffix(name, ".json")] = config
+	}
+	return result
+}
+
+// tick starts every scrape that fell due since the previous tick. Scheduled
+// runs are cover-only, so frequent schedules stay cheap and only new or
+// changed catalogs are scraped in full. A scrape whose previous run is
+// still queued or running is skipped.
+func (s *Scheduler) tick(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	since := s.lastCheck
+	s.lastCheck = now
+	if since.IsZero() {
+		return
+	}
+
+	for name, config := range scheduledConfigs() {
+		schedule, err := ParseSchedule(config.Schedule)
+		if err != nil {
+			continue
+		}
+		if next := schedule.Next(since); next.IsZero() || next.After(now) {
+			continue
+		}
+		if optOuts.IsOptedOut(config.StoreName()) {
+			continue
+		}
+		if scrapeJobs.Active(s.lastJob[name]) {
+			slog.Info("scheduler: skipping config, previous job still running", "config", name, "job", s.lastJob[name])
+			continue
+		}
+
+		job, err := scrapeJobs.Start(name, configFile(name+".json"), ScrapeOptions{CoverOnly: true})
+		if err != nil {
+			slog.Error("scheduler: failed to start job", "config", name, "err", err)
+			continue
+		}
+		slog.Info("scheduler: started job", "config", name, "job", job.ID)
+		s.lastRun[name] = now
+		s.lastJob[name] = job.ID
+	}
+}
+
+// Scrapes lists every scheduled config with its next run
+func (s *Scheduler) Scrapes(now time.Time) []ScheduledScrape {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := []ScheduledScrape{}
+	for name, config := range scheduledConfigs() {
+		entry := ScheduledScrape{
+			Config:   name,
+			Store:    config.StoreName(),
+			Schedule: config.Schedule,
+			LastJob:  s.lastJob[name],
+			OptedOut: optOuts.IsOptedOut(config.StoreName()),
+		}
+		if last, ok := s.lastRun[name]; ok {
+			entry.LastRun = &last
+		}
+		if schedule, err := ParseSchedule(config.Schedule); err != nil {
+			entry.Error = err.Error()
+		} else if next := schedule.Next(now); !next.IsZero() && !entry.OptedOut {
+			entry.NextRun = &next
+		}
+		result = append(result, entry)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Config < result[j].Config })
+	return result
+}
+
+// startScheduler checks the schedules every minute. SCHEDULER=off disables
+// automatic scraping, for example when -once runs from cron instead.
+func startScheduler() {
+	if os.Getenv("SCHEDULER") == "off" {
+		return
+	}
+	for name, config := range scheduledConfigs() {
+		if _, err := ParseSchedule(config.Schedule); err != nil {
+			slog.Warn("invalid schedule", "config", name, "schedule", config.Schedule, "err", err)
+		}
+	}
+
+	scheduler.tick(time.Now())
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			scheduler.tick(now)
+		}
+	}()
+}
+
+// API Handlers
+
+func getSchedule(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scheduler.Scrapes(time.Now()))
+}
@@ -2,9 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
 	"os"
@@ -17,99 +17,445 @@ import (
 	"github.com/chromedp/chromedp"
 )
 
-// ScrapeAndDownloadFromConfig scrapes a catalog based on config file
-func ScrapeAndDownloadFromConfig(configPath string) error {
+// ScrapeAndDownloadFromConfig scrapes a catalog based on config file.
+// Cancelling ctx stops the scrape after the current page; nothing it wrote
+// is kept.
+func ScrapeAndDownloadFromConfig(ctx context.Context, configPath string, opts ScrapeOptions) (err error) {
+	inFlight.Add(1)
+	defer inFlight.Done()
+
+	started := time.Now()
 	config, err := LoadScraperConfig(configPath)
 	if err != nil {
 		return fmt.Errorf("failed to load config: %v", err)
 	}
+	defer func() { observeScrape(config.StoreName(), started, err) }()
+
+	logger := logFrom(ctx).With("config", config.ID)
+	ctx = withLogger(ctx, logger)
+
+	if err := config.Scripts.Check(); err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+	imageScript, err := config.imageScript()
+	if err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+	strategy, err := config.strategy()
+	if err == nil {
+		err = strategy.Check(config)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
 
-	log.Printf("Starting scraper for config: %s", config.ID)
+	if opts.CoverOnly {
+		return probeCatalog(ctx, config, strategy, imageScript)
+	}
+
+	// Catalogs already downloaded in full are not fetched again
+	if !opts.Force && !opts.Record && !opts.Replay {
+		if id, err := config.NewsletterID(); err == nil && catalogDownloaded(id) {
+			logger.Info("skipping scrape, catalog already downloaded", "newsletter", id)
+			return errCatalogUnchanged
+		}
+	}
+
+	logger.Info("scrape started")
+
+	publishEvent(EventScrapeStarted, map[string]interface{}{"config": config.ID, "store": config.StoreName()})
+	defer func() {
+		finished := map[string]interface{}{
+			"config":   config.ID,
+			"store":    config.StoreName(),
+			"duration": time.Since(started).Seconds(),
+			"success":  err == nil,
+		}
+		if err != nil {
+			finished["error"] = err.Error()
+		}
+		publishEvent(EventScrapeFinished, finished)
+	}()
 
 	// Create output directory structure
-	baseDir := filepath.Join("../newsletters", config.ID)
+	if optOuts.IsOptedOut(config.StoreName()) {
+		return fmt.Errorf("store %s opted out of archiving", config.StoreName())
+	}
+
+	newsletterID, err := config.NewsletterID()
+	if err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+	baseDir := newsletterDir(dataLayout(), config.StoreName(), newsletterID, config.ValidFrom)
 	pagesDir := filepath.Join(baseDir, "pages")
 
-	if err := os.MkdirAll(pagesDir, 0755); err != nil {
+	// Keep the store's current state so a bad scrape can be rolled back;
+	// a failed scrape puts it back right away
+	lock := storeLock(config.StoreName())
+	lock.Lock()
+	defer lock.Unlock()
+	snapshot, err := snapshotStore(config.StoreName(), newsletterID, baseDir)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot %s: %v", config.StoreName(), err)
+	}
+	defer func() {
+		if err != nil {
+			snapshot.restore()
+		} else {
+			snapshot.commit()
+		}
+	}()
+
+	if err := os.MkdirAll(pagesDir, dirPerm); err != nil {
 		return fmt.Errorf("failed to create directories: %v", err)
 	}
 
 	// Create chromedp context
-	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Second)
+	scrapeCtx, cancel := context.WithTimeout(ctx, 300*time.Second)
 	defer cancel()
+	scrapeCtx, abort := context.WithCancelCause(scrapeCtx)
+	defer abort(nil)
 
-	opts := append(chromedp.DefaultExecAllocatorOptions[:],
-		chromedp.Flag("headless", true),
-		chromedp.Flag("disable-gpu", true),
-		chromedp.Flag("no-sandbox", true),
-	)
+	taskCtx, taskCancel := newBrowserContext(scrapeCtx)
+	defer taskCancel()
 
-	allocCtx, allocCancel := chromedp.NewExecAllocator(ctx, opts...)
-	defer allocCancel()
+	// Runs over their store's budget are aborted and fail, which rolls
+	// them back
+	meter := newCostMeter(config, abort)
+	meter.watch(taskCtx)
+	defer func() {
+		if over := meter.err(); over != nil {
+			err = fmt.Errorf("scrape aborted: %w", over)
+		}
+		meter.finish(ctx, err)
+	}()
+
+	download := downloadImage
+	if opts.Record || opts.Replay {
+		var rec *Recording
+		if opts.Replay {
+			rec, err = LoadRecording(config.ID)
+			logger.Info("replaying recorded session")
+		} else {
+			rec, err = NewRecording(config.ID)
+			logger.Info("recording session")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to open recording: %v", err)
+		}
+		if err := rec.Attach(taskCtx, opts.Replay); err != nil {
+			return fmt.Errorf("failed to intercept browser traffic: %v", err)
+		}
+		download = func(imageURL, filePath string) error {
+			return rec.DownloadImage(imageURL, filePath, opts.Replay)
+		}
+		if opts.Record {
+			defer func() {
+				if err := rec.Save(); err != nil {
+					logger.Warn("failed to save recording", "err", err)
+				}
+			}()
+		}
+	}
 
-	taskCtx, taskCancel := chromedp.NewContext(allocCtx)
-	defer taskCancel()
+	if !opts.Replay {
+		fetch := download
+		download = func(imageURL, filePath string) error {
+			err := fetch(imageURL, filePath)
+			if err == nil {
+				meter.countDownload(filePath)
+			}
+			return err
+		}
+	}
+
+	var provenance *Provenance
+	if config.ArchiveProvenance {
+		provenance = &Provenance{
+			NewsletterID: newsletterID,
+			ConfigID:     config.ID,
+			SourceURL:    config.FirstPage,
+			RetrievedAt:  time.Now(),
+			Replayed:     opts.Replay,
+			Pages:        []PageProvenance{},
+		}
+	}
+
+	coverPath := filepath.Join(baseDir, "cover-image.jpg")
+	autoCover := config.CoverImage == "" || config.CoverImage == coverAuto
 
 	// Extract cover image
-	log.Printf("Extracting cover image from: %s", config.CoverImage)
-	coverImageURL, err := extractImageFromPage(taskCtx, config.CoverImage)
-	if err != nil {
-		log.Printf("Warning: failed to extract cover image: %v", err)
-	} else {
-		coverPath := filepath.Join(baseDir, "cover-image.jpg")
-		if err := downloadImage(coverImageURL, coverPath); err != nil {
-			log.Printf("Warning: failed to download cover image: %v", err)
+	if !autoCover {
+		logger.Info("extracting cover image", "url", config.CoverImage)
+		coverImageURL, err := extractImageFromPage(taskCtx, config.CoverImage, imageScript)
+		if err != nil {
+			logger.Warn("failed to extract cover image", "err", err)
 		} else {
-			log.Printf("Downloaded cover image")
+			if err := download(coverImageURL, coverPath); err != nil {
+				logger.Warn("failed to download cover image", "err", err)
+			} else {
+				logger.Info("downloaded cover image")
+				if provenance != nil {
+					cover := pageProvenance(0, config.CoverImage, coverImageURL, coverPath)
+					provenance.Cover = &cover
+				}
+			}
 		}
 	}
 
-	// Parse page range from first_page and last_page URLs
-	firstPageNum, err := extractPageNumber(config.FirstPage)
+	session := &scrapeSession{ctx: taskCtx, config: config, imageScript: imageScript, download: download}
+	defer session.close()
+	pages, err := strategy.Pages(session)
 	if err != nil {
-		return fmt.Errorf("failed to parse first page number: %v", err)
+		return err
 	}
 
-	lastPageNum, err := extractPageNumber(config.LastPage)
-	if err != nil {
-		return fmt.Errorf("failed to parse last page number: %v", err)
-	}
+	logger.Info("extracting pages", "pages", len(pages))
 
-	log.Printf("Extracting pages %d to %d", firstPageNum, lastPageNum)
+	progress := func(downloaded int) {
+		if opts.Progress != nil {
+			opts.Progress(downloaded, len(pages))
+		}
+	}
+	progress(0)
 
 	// Extract and download all page images (sequentially to avoid rate limiting)
-	for pageNum := firstPageNum; pageNum <= lastPageNum; pageNum++ {
-		pageURL := buildPageURL(config.FirstPage, pageNum)
-		log.Printf("Processing page %d/%d: %s", pageNum-firstPageNum+1, lastPageNum-firstPageNum+1, pageURL)
+	// Pages unchanged since an earlier version share its files
+	prior := priorPages(config, newsletterID, snapshot)
+	reused := 0
+
+	// Extracted prices are checked against those of earlier catalogs
+	var history priceHistory
+	if config.ExtractProducts && ocrEngine != nil {
+		history = loadPriceHistory(newsletterID)
+	}
 
-		imageURL, err := extractImageFromPage(taskCtx, pageURL)
-		if err != nil {
-			log.Printf("Warning: failed to extract image from page %d: %v", pageNum, err)
-			continue
+	var downloaded []string
+	for i, page := range pages {
+		if ctx.Err() != nil {
+			return fmt.Errorf("scrape cancelled after %d pages: %v", len(downloaded), errShuttingDown)
 		}
+		if meter.err() != nil {
+			return errOverBudget
+		}
+		pageNum := page.Number
+		logger.Debug("processing page", "page", pageNum, "index", i+1, "of", len(pages), "url", page.URL)
 
 		filename := fmt.Sprintf("page-%03d.jpg", pageNum)
 		imagePath := filepath.Join(pagesDir, filename)
 
-		if err := downloadImage(imageURL, imagePath); err != nil {
-			log.Printf("Warning: failed to download page %d: %v", pageNum, err)
+		imageURL, err := strategy.Download(session, page, imagePath)
+		if err != nil {
+			logger.Warn("failed to download page", "page", pageNum, "err", err)
+			pageFailures.inc(config.StoreName())
 			continue
 		}
+		pagesDownloaded.inc(config.StoreName())
+
+		unchanged := prior.linkUnchanged(imagePath)
+		if unchanged != "" {
+			reused++
+			logger.Info("downloaded page", "page", pageNum, "unchanged_since", unchanged)
+		} else {
+			logger.Info("downloaded page", "page", pageNum)
+		}
+		if err := storeVariants(imagePath, unchanged); err != nil {
+			logger.Warn("failed to resize page", "page", pageNum, "err", err)
+		}
+		downloaded = append(downloaded, imagePath)
+		progress(len(downloaded))
+		if provenance != nil {
+			provenance.Pages = append(provenance.Pages, pageProvenance(pageNum, page.URL, imageURL, imagePath))
+		}
 
-		log.Printf("Downloaded page %d", pageNum)
+		if config.DetectTiles && !copySidecar(tilesPath, unchanged, imagePath) {
+			tiles, err := segmentPageTiles(imagePath)
+			if err != nil {
+				logger.Warn("failed to segment page", "page", pageNum, "err", err)
+			} else if err := saveTiles(imagePath, tiles); err != nil {
+				logger.Warn("failed to save tiles", "page", pageNum, "err", err)
+			} else {
+				logger.Info("detected tiles", "page", pageNum, "tiles", len(tiles))
+			}
+		}
+
+		if config.ExtractProducts && ocrEngine != nil && !copySidecar(productsPath, unchanged, imagePath) {
+			products, err := extractPageProducts(ocrEngine, history, newsletterID, pageNum, imagePath)
+			if err != nil {
+				logger.Warn("failed to extract products", "page", pageNum, "err", err)
+			} else {
+				logger.Info("extracted products", "page", pageNum, "products", len(products))
+			}
+		}
 
 		// Small delay between pages to be respectful
-		time.Sleep(500 * time.Millisecond)
+		select {
+		case <-time.After(500 * time.Millisecond):
+		case <-ctx.Done():
+		}
 	}
-	log.Printf("Scraping complete for %s", config.ID)
+
+	if len(downloaded) == 0 {
+		return fmt.Errorf("no pages downloaded out of %d", len(pages))
+	}
+	if reused > 0 {
+		logger.Info("unchanged pages share files with an earlier version", "changed", len(downloaded)-reused, "unchanged", reused)
+	}
+
+	if autoCover {
+		if coverPage, err := selectCover(config, downloaded, coverPath); err != nil {
+			logger.Warn("failed to detect cover image", "err", err)
+		} else {
+			logger.Info("detected cover page", "file", filepath.Base(coverPage))
+		}
+	}
+	if _, err := os.Stat(coverPath); err == nil {
+		if err := generateVariants(coverPath); err != nil {
+			logger.Warn("failed to resize cover image", "err", err)
+		}
+	}
+
+	// The store may have opted out while the scrape was running
+	if optOuts.IsOptedOut(config.StoreName()) {
+		os.RemoveAll(baseDir)
+		return fmt.Errorf("store %s opted out of archiving", config.StoreName())
+	}
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("scrape cancelled: %v", errShuttingDown)
+	}
+
+	if provenance != nil {
+		if err := provenance.Save(baseDir); err != nil {
+			logger.Warn("failed to save provenance", "err", err)
+		}
+	}
+
+	newsletter := buildNewsletter(config, newsletterID, baseDir, downloaded)
+	newsletter.PageCount = len(pages)
+	prewarmImages(newsletter)
+	_, existed := newsletters.Get(newsletterID)
+	if err := registerNewsletter(newsletter); err != nil {
+		return fmt.Errorf("failed to save newsletter metadata: %v", err)
+	}
+	if !existed {
+		catalogsFound.inc(config.StoreName())
+	}
+
+	logger.Info("scrape complete", "newsletter", newsletterID, "duration", time.Since(started))
 
 	return nil
 }
 
+// pageRange returns the last page number of the catalog and, when an
+// image_urls script lists them, the image URLs of its pages. The viewer's
+// page count bounds the scrape; last_page is the fallback.
+func pageRange(ctx context.Context, config *ScraperConfig, firstPageNum int) (int, []string, error) {
+	switch {
+	case config.Scripts != nil && config.Scripts.ImageURLs != "":
+		listed, err := evaluateImageURLs(ctx, config.FirstPage, config.Scripts.ImageURLs)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to list page images: %v", err)
+		}
+		return firstPageNum + len(listed) - 1, listed, nil
+	case config.Scripts != nil && config.Scripts.PageCount != "":
+		count, err := evaluatePageCount(ctx, config.FirstPage, config.Scripts.PageCount)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to count pages: %v", err)
+		}
+		return firstPageNum + count - 1, nil, nil
+	default:
+		last, err := detectLastPage(ctx, config, firstPageNum)
+		return last, nil, err
+	}
+}
+
+// detectLastPage returns the last page number from the page count the
+// viewer reports, falling back to last_page. Catalogs often change length
+// after their config was written, so a differing last_page is only logged.
+func detectLastPage(ctx context.Context, config *ScraperConfig, firstPageNum int) (int, error) {
+	configured, configErr := extractPageNumber(config.LastPage)
+
+	count, err := evaluatePageCount(ctx, config.FirstPage, pageCountJS)
+	if err != nil {
+		if configErr != nil {
+			return 0, fmt.Errorf("failed to detect page count (%v) and to parse last page number: %v", err, configErr)
+		}
+		logFrom(ctx).Warn("failed to detect page count, using last_page", "err", err)
+		return configured, nil
+	}
+
+	last := firstPageNum + count - 1
+	if configErr == nil && configured != last {
+		logFrom(ctx).Info("viewer page count differs from last_page", "pages", count, "last_page", configured, "using", last)
+	}
+	return last, nil
+}
+
+// errCatalogUnchanged is returned for scrapes skipped because their
+// catalog is already stored
+var errCatalogUnchanged = errors.New("catalog already downloaded")
+
+// catalogDownloaded reports whether the newsletter id was stored by the
+// current pipeline with all the pages its viewer reported, all of them on
+// disk
+func catalogDownloaded(id string) bool {
+	n, ok := newsletters.Get(id)
+	if !ok || n.ExtractorVersion < ExtractorVersion || n.PageCount == 0 || len(n.Pages) != n.PageCount {
+		return false
+	}
+	for _, page := range n.Pages {
+		path, ok := localImagePath(page.ImageURL)
+		if !ok {
+			return false
+		}
+		if _, err := os.Stat(path); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// newBrowserContext starts a headless Chrome bound to parent
+func newBrowserContext(parent context.Context) (context.Context, context.CancelFunc) {
+	allocOpts := append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.Flag("headless", true),
+		chromedp.Flag("disable-gpu", true),
+		chromedp.Flag("no-sandbox", true),
+	)
+
+	allocCtx, allocCancel := chromedp.NewExecAllocator(parent, allocOpts...)
+	taskCtx, taskCancel := chromedp.NewContext(allocCtx)
+	return taskCtx, func() {
+		taskCancel()
+		allocCancel()
+	}
+}
+
+// selectCover detects the cover among the first downloaded pages, copies it
+// to coverPath and returns the page it picked
+func selectCover(config *ScraperConfig, downloaded []string, coverPath string) (string, error) {
+	candidates := config.CoverCandidates
+	if candidates <= 0 {
+		candidates = defaultCoverCandidates
+	}
+	if len(downloaded) > candidates {
+		downloaded = downloaded[:candidates]
+	}
+
+	coverPage, err := detectCoverPage(downloaded, config.LogoTemplate)
+	if err != nil {
+		return "", err
+	}
+	return coverPage, copyFile(coverPage, coverPath)
+}
+
+// pageNumberRe matches the page segment of catalog viewer URLs
+var pageNumberRe = regexp.MustCompile(`/page/(\d+)`)
+
 // extractPageNumber extracts the page number from a URL
 func extractPageNumber(pageURL string) (int, error) {
-	re := regexp.MustCompile(`/page/(\d+)`)
-	matches := re.FindStringSubmatch(pageURL)
+	matches := pageNumberRe.FindStringSubmatch(pageURL)
 	if len(matches) < 2 {
 		return 0, fmt.Errorf("page number not found in URL: %s", pageURL)
 	}
@@ -118,69 +464,15 @@ func extractPageNumber(pageURL string) (int, error) {
 
 // buildPageURL builds a page URL for a specific page number
 func buildPageURL(templateURL string, pageNum int) string {
-	re := regexp.MustCompile(`/page/\d+`)
-	return re.ReplaceAllString(templateURL, fmt.Sprintf("/page/%d", pageNum))
+	return pageNumberRe.ReplaceAllString(templateURL, fmt.Sprintf("/page/%d", pageNum))
 }
 
 // extractImageFromPage navigates to a page and extracts the main image URL
-func extractImageFromPage(ctx context.Context, pageURL string) (string, error) {
+// with script, see ScraperConfig.imageScript
+func extractImageFromPage(ctx context.Context, pageURL, script string) (string, error) {
 	var imageURL string
 
-	// JavaScript to find the catalog image - try to get the largest/highest resolution image
-	selectorJS := `
-		(() => {
-			// First, try to find images by size (catalog images are usually large)
-			const allImages = Array.from(document.querySelectorAll('img'));
-			
-			// Filter out small images (icons, logos, etc) and get the largest
-			const largeImages = allImages.filter(img => {
-				const width = img.naturalWidth || img.width || 0;
-				const height = img.naturalHeight || img.height || 0;
-				return width > 500 && height > 500;
-			});
-			
-			if (largeImages.length > 0) {
-				// Sort by size and get the largest
-				largeImages.sort((a, b) => {
-					const sizeA = (a.naturalWidth || a.width) * (a.naturalHeight || a.height);
-					const sizeB = (b.naturalWidth || b.width) * (b.naturalHeight || b.height);
-					return sizeB - sizeA;
-				});
-				return largeImages[0].src;
-			}
-			
-			// Fallback: try specific selectors
-			const selectors = [
-				'img.flyer-image',
-				'img[class*="flyer"]',
-				'img[class*="catalog"]',
-				'div.flyer-container img',
-				'div[class*="flyer"] img',
-				'div[class*="catalog"] img',
-				'main img',
-				'article img'
-			];
-			
-			for (const selector of selectors) {
-				try {
-					const img = document.querySelector(selector);
-					if (img && img.src && !img.src.includes('.svg')) {
-						return img.src;
-					}
-				} catch (e) {}
-			}
-			return '';
-		})()
-	`
-
-	err := chromedp.Run(ctx,
-		chromedp.Navigate(pageURL),
-		chromedp.WaitReady("body"),
-		chromedp.Sleep(5*time.Second), // Increased wait time for images to load
-		chromedp.Evaluate(selectorJS, &imageURL),
-	)
-
-	if err != nil {
+	if err := evaluateOnPage(ctx, pageURL, script, &imageURL); err != nil {
 		return "", err
 	}
 
@@ -189,19 +481,28 @@ func extractImageFromPage(ctx context.Context, pageURL string) (string, error) {
 		return "", fmt.Errorf("no image found on page")
 	}
 
-	// Ensure the URL is absolute
-	if !strings.HasPrefix(imageURL, "http") {
-		parsedURL, err := url.Parse(pageURL)
-		if err == nil {
-			baseURL := fmt.Sprintf("%s://%s", parsedURL.Scheme, parsedURL.Host)
-			imageURL = baseURL + imageURL
-		}
-	}
+	return absoluteURL(pageURL, imageURL), nil
+}
 
-	return imageURL, nil
+// absoluteURL resolves an image URL found on pageURL, which viewer state
+// often holds as a path or a protocol-relative URL
+func absoluteURL(pageURL, imageURL string) string {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return imageURL
+	}
+	ref, err := url.Parse(imageURL)
+	if err != nil {
+		return imageURL
+	}
+	return base.ResolveReference(ref).String()
 }
 
-// downloadImage downloads an image from URL to the specified path
+// maxImageSize caps an image downloaded from a URL given to the API
+const maxImageSize = 20 << 20
+
+// downloadImage downloads a JPEG or PNG image from URL to the specified
+// path, rejecting other content and images over maxImageSize
 func downloadImage(imageURL, filePath string) error {
 	resp, err := http.Get(imageURL)
 	if err != nil {
@@ -213,12 +514,18 @@ func downloadImage(imageURL, filePath string) error {
 		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
 	}
 
-	out, err := os.Create(filePath)
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	imageBytes.add(float64(len(data)))
 	if err != nil {
 		return err
 	}
-	defer out.Close()
+	if len(data) > maxImageSize {
+		return fmt.Errorf("image larger than %d bytes", maxImageSize)
+	}
+	// The server's Content-Type is often wrong for images, so sniff
+	if contentType := http.DetectContentType(data); contentType != "image/jpeg" && contentType != "image/png" {
+		return fmt.Errorf("got %s, want a JPEG or PNG image", contentType)
+	}
 
-	_, err = io.Copy(out, resp.Body)
-	return err
+	return replaceFile(filePath, data, filePerm)
 }
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// ScriptConfig holds JavaScript expressions evaluated in a store's viewer,
+// for viewers that expose their data more reliably than the DOM, such as
+// window.__INITIAL_STATE__. Each is a single expression, see checkScript.
+type ScriptConfig struct {
+	// PageCount returns the number of pages, evaluated on first_page; it
+	// replaces last_page
+	PageCount string `json:"page_count,omitempty"`
+	// ImageURLs returns the image URLs of all pages in order, evaluated on
+	// first_page; pages are then downloaded without visiting each one
+	ImageURLs string `json:"image_urls,omitempty"`
+	// ImageURL returns the image URL of the page it is evaluated on,
+	// replacing the largest-image heuristic
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+// scriptGlobals are the globals a script may read
+var scriptGlobals = map[string]bool{
+	"window": true, "document": true, "JSON": true, "Array": true, "Object": true,
+	"Number": true, "String": true, "Boolean": true, "Math": true,
+	"parseInt": true, "parseFloat": true, "isNaN": true,
+	"true": true, "false": true, "null": true, "undefined": true,
+	"typeof": true, "instanceof": true, "in": true,
+}
+
+// scriptForbidden are properties that send requests, change the page or
+// escape the checks; they may not be accessed, not even by a literal index
+var scriptForbidden = map[string]bool{
+	"fetch": true, "XMLHttpRequest": true, "WebSocket": true, "EventSource": true,
+	"sendBeacon": true, "open": true, "postMessage": true, "importScripts": true,
+	"eval": true, "Function": true, "constructor": true, "prototype": true, "__proto__": true,
+	"setTimeout": true, "setInterval": true, "cookie": true, "localStorage": true,
+	"sessionStorage": true, "indexedDB": true, "location": true, "navigator": true,
+	"write": true, "writeln": true, "innerHTML": true, "outerHTML": true,
+	"insertAdjacentHTML": true, "createElement": true, "appendChild": true,
+	"setAttribute": true, "click": true, "submit": true, "remove": true, "Reflect": true,
+}
+
+var (
+	scriptStringRe     = regexp.MustCompile(`"(?:[^"\\\n]|\\.)*"|'(?:[^'\\\n]|\\.)*'`)
+	scriptIdentRe      = regexp.MustCompile(`[A-Za-z_$][\w$]*`)
+	scriptNameRe       = regexp.MustCompile(`^[A-Za-z_$][\w$]*$`)
+	scriptParamsRe     = regexp.MustCompile(`\(([^()]*)\)\s*=>|([A-Za-z_$][\w$]*)\s*=>`)
+	scriptAssignRe     = regexp.MustCompile(`(^|[^=!<>])=($|[^=>])|\+\+|--|[-+*/%&|^]=`)
+	scriptIndexRe      = regexp.MustCompile(`\[\s*(\d+|"[^"]*"|'[^']*')\s*\]`)
+	scriptNumberRe     = regexp.MustCompile(`\b\d+(\.\d+)?([eE][-+]?\d+)?\b`)
+	scriptForbiddenOps = []string{";", "`", "//", "/*"}
+)
+
+// checkScript enforces the safety allowlist on a snippet: a single
+// expression without assignments, reading only scriptGlobals and the
+// parameters of its arrow functions, never touching scriptForbidden, and
+// indexing only with literals such as [0] or ["page-data"]. It guards
+// against mistakes and careless copy-paste in configs; it is not a sandbox.
+func checkScript(script string) error {
+	if strings.TrimSpace(script) == "" {
+		return fmt.Errorf("empty script")
+	}
+	// Literal indexes become properties, so they are checked like them
+	code := scriptIndexRe.ReplaceAllStringFunc(script, func(index string) string {
+		if name := strings.Trim(index, "[]\"' \t"); scriptNameRe.MatchString(name) {
+			return "." + name
+		}
+		return ".x"
+	})
+	code = scriptStringRe.ReplaceAllString(code, `""`)
+	if strings.Count(code, `"`)%2 != 0 || strings.Contains(code, "'") {
+		return fmt.Errorf("unterminated string")
+	}
+	for _, op := range scriptForbiddenOps {
+		if strings.Contains(code, op) {
+			return fmt.Errorf("%q is not allowed", op)
+		}
+	}
+	if scriptAssignRe.MatchString(code) {
+		return fmt.Errorf("assignments are not allowed")
+	}
+	// Any other [ must start an array literal
+	for i, c := range code {
+		if c != '[' {
+			continue
+		}
+		before := strings.TrimRight(code[:i], " \t\n")
+		if strings.HasSuffix(before, ")") || strings.HasSuffix(before, "]") || strings.HasSuffix(before, `"`) || endsWithIdent(before) {
+			return fmt.Errorf("computed index is not allowed")
+		}
+	}
+
+	bound := map[string]bool{}
+	for _, m := range scriptParamsRe.FindAllStringSubmatch(code, -1) {
+		for _, name := range scriptIdentRe.FindAllString(m[1]+" "+m[2], -1) {
+			bound[name] = true
+		}
+	}
+
+	code = scriptNumberRe.ReplaceAllString(code, "0")
+	for _, loc := range scriptIdentRe.FindAllStringIndex(code, -1) {
+		name := code[loc[0]:loc[1]]
+		if scriptForbidden[name] {
+			return fmt.Errorf("%q is not allowed", name)
+		}
+		if before := strings.TrimRight(code[:loc[0]], " \t\n"); strings.HasSuffix(before, ".") && !strings.HasSuffix(before, "...") {
+			continue // a property
+		}
+		if !scriptGlobals[name] && !bound[name] {
+			return fmt.Errorf("%q is not an allowed global", name)
+		}
+	}
+	return nil
+}
+
+// endsWithIdent reports whether s ends with an identifier other than a
+// keyword that may precede an array literal
+func endsWithIdent(s string) bool {
+	idents := scriptIdentRe.FindAllStringIndex(s, -1)
+	if len(idents) == 0 || idents[len(idents)-1][1] != len(s) {
+		return false
+	}
+	last := s[idents[len(idents)-1][0]:]
+	return last != "in" && last != "typeof" && last != "instanceof"
+}
+
+// Check verifies every snippet against the allowlist
+func (s *ScriptConfig) Check() error {
+	if s == nil {
+		return nil
+	}
+	for _, script := range []struct{ name, code string }{
+		{"page_count", s.PageCount},
+		{"image_urls", s.ImageURLs},
+		{"image_url", s.ImageURL},
+	} {
+		if script.code == "" {
+			continue
+		}
+		if err := checkScript(script.code); err != nil {
+			return fmt.Errorf("scripts.%s: %v", script.name, err)
+		}
+	}
+	return nil
+}
+
+// evaluateOnPage navigates to pageURL, waits for the viewer to load and
+// evaluates script into res
+func evaluateOnPage(ctx context.Context, pageURL, script string, res interface{}) error {
+	return chromedp.Run(ctx,
+		chromedp.Navigate(pageURL),
+		chromedp.WaitReady("body"),
+		chromedp.Sleep(5*time.Second), // Viewers fill their state after load
+		chromedp.Evaluate("("+script+")", res),
+	)
+}
+
+// evaluatePageCount runs the page_count snippet on pageURL
+func evaluatePageCount(ctx context.Context, pageURL, script string) (int, error) {
+	var count float64
+	if err := evaluateOnPage(ctx, pageURL, script, &count); err != nil {
+		return 0, err
+	}
+	if count < 1 || count != float64(int(count)) {
+		return 0, fmt.Errorf("page count %v is not a positive integer", count)
+	}
+	return int(count), nil
+}
+
+// evaluateImageURLs runs the image_urls snippet on pageURL and makes the
+// URLs absolute
+func evaluateImageURLs(ctx context.Context, pageURL, script string) ([]string, error) {
+	var urls []string
+	if err := evaluateOnPage(ctx, pageURL, script, &urls); err != nil {
+		return nil, err
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no image URLs returned")
+	}
+	for i, u := range urls {
+		u = strings.TrimSpace(u)
+		if u == "" {
+			return nil, fmt.Errorf("image URL %d is empty", i+1)
+		}
+		urls[i] = absoluteURL(pageURL, u)
+	}
+	return urls, nil
+}
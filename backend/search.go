@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSearchLimit = 50
+	minSearchQuery     = 2
+)
+
+// SearchResult is a product found in a current catalog
+type SearchResult struct {
+	Name         string      `json:"name"`
+	Price        ParsedPrice `json:"price"`
+	UnitPrice    float64     `json:"unitPrice"`
+	Store        string      `json:"store"`
+	NewsletterID string      `json:"newsletterId"`
+	Title        string      `json:"title"`
+	ValidFrom    string      `json:"validFrom"`
+	ValidUntil   string      `json:"validUntil"`
+	PageNumber   int         `json:"pageNumber"`
+	PageImage    string      `json:"pageImage"`
+	URL          string      `json:"url"`
+}
+
+// currentNewsletters returns the canonical newsletters that have not expired
+func currentNewsletters(today string) []Newsletter {
+	var current []Newsletter
+	for _, n := range withoutSuperseded(newsletters.List()) {
+		if n.ValidUntil == "" || n.ValidUntil >= today {
+			current = append(current, n)
+		}
+	}
+	return current
+}
+
+// matchesQuery reports whether every word of the query occurs in name,
+// ignoring case and Romanian diacritics
+func matchesQuery(name string, words []string) bool {
+	name = normalizeTitle(name)
+	for _, word := range words {
+		if !strings.Contains(name, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// searchProducts finds products of current catalogs, cheapest first by
+// the price of one item once its promo applies. Prices flagged as
+// anomalies are left out unless includeFlagged is set.
+func searchProducts(query, store string, today string, includeFlagged bool) []SearchResult {
+	words := strings.Fields(normalizeTitle(query))
+
+	results := []SearchResult{}
+	for _, n := range currentNewsletters(today) {
+		if store != "" && !strings.EqualFold(n.Store, store) {
+			continue
+		}
+		for _, page := range n.Pages {
+			for _, p := range loadPageProducts(page) {
+				if !matchesQuery(p.Name, words) || (p.Excluded() && !includeFlagged) {
+					continue
+				}
+				results = append(results, SearchResult{
+					Name:         p.Name,
+					Price:        p.Price,
+					UnitPrice:    p.Price.EffectiveUnitPrice(p.Price.Price),
+					Store:        n.Store,
+					NewsletterID: n.ID,
+					Title:        n.Title,
+					ValidFrom:    n.ValidFrom,
+					ValidUntil:   n.ValidUntil,
+					PageNumber:   page.PageNumber,
+					PageImage:    page.ImageURL,
+					URL:          fmt.Sprintf("/newsletter.html?id=%s&page=%d", n.ID, page.PageNumber),
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].UnitPrice != results[j].UnitPrice {
+			return results[i].UnitPrice < results[j].UnitPrice
+		}
+		return results[i].Store < results[j].Store
+	})
+	return results
+}
+
+// API Handlers
+
+// SearchResponse is the response to GET /api/search
+type SearchResponse struct {
+	Query   string         `json:"query"`
+	Results []SearchResult `json:"results"`
+	Total   int            `json:"total"`
+}
+
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if len([]rune(query)) < minSearchQuery {
+		http.Error(w, fmt.Sprintf("Query q must have at least %d characters", minSearchQuery), http.StatusBadRequest)
+		return
+	}
+	limit, err := positiveParam(r, "limit", defaultSearchLimit)
+	if err != nil {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	limit = min(limit, maxPageLimit)
+
+	results := searchProducts(query, r.URL.Query().Get("store"), time.Now().Format("2006-01-02"), r.URL.Query().Get("includeFlagged") == "true")
+	total := len(results)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SearchResponse{Query: query, Results: results, Total: total})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const defaultPort = "8080"
+
+// ServerConfig holds where the server listens and keeps its files, so it
+// can be deployed outside the repository layout. Relative directories are
+// resolved against the working directory.
+//
+//	PORT             port to listen on (default 8080)
+//	DATA_DIR         newsletter data and state (default ../newsletters)
+//	FRONTEND_DIR     static frontend files (default ../frontend)
+//	CONFIG_DIR       scraper configs (default configs)
+//	ALLOWED_ORIGINS  origins allowed on restricted routes, comma separated
+//	                 (default http://localhost:8080)
+//	ADMIN_TOKEN      bearer token of the /api/admin routes, which are
+//	                 disabled while unset
+type ServerConfig struct {
+	Port           string
+	DataDir        string
+	FrontendDir    string
+	ConfigDir      string
+	AllowedOrigins []string
+	AdminToken     string
+}
+
+var serverConfig = LoadServerConfig()
+
+// LoadServerConfig reads the server settings from env, falling back to
+// the defaults for unset or invalid values
+func LoadServerConfig() ServerConfig {
+	c := ServerConfig{
+		Port:        defaultPort,
+		DataDir:     envOr("DATA_DIR", "../newsletters"),
+		FrontendDir: envOr("FRONTEND_DIR", "../frontend"),
+		ConfigDir:   envOr("CONFIG_DIR", "configs"),
+		AdminToken:  os.Getenv("ADMIN_TOKEN"),
+	}
+
+	if v := os.Getenv("PORT"); v != "" {
+		if port, err := strconv.Atoi(v); err == nil && port > 0 && port <= 65535 {
+			c.Port = v
+		} else {
+			slog.Warn("invalid PORT, using the default", "value", v, "default", defaultPort)
+		}
+	}
+
+	// CORS_ALLOWED_ORIGINS is the older name of ALLOWED_ORIGINS
+	origins := os.Getenv("ALLOWED_ORIGINS")
+	if origins == "" {
+		origins = os.Getenv("CORS_ALLOWED_ORIGINS")
+	}
+	c.AllowedOrigins = splitList(origins, "http://localhost:8080")
+	return c
+}
+
+// envOr returns the value of an env variable or def when it is unset
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// dataPath returns the path of name in the data directory
+func dataPath(name string) string {
+	return filepath.Join(serverConfig.DataDir, name)
+}
+
+// configFile returns the path of a scraper config file
+func configFile(name string) string {
+	return filepath.Join(serverConfig.ConfigDir, name)
+}
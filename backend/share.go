@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var sharesFile = dataPath("shares.json")
+
+// ShareLink is a short link to one page of a newsletter. It points at the
+// locally stored copy, so it keeps working after the store's own URL is gone.
+type ShareLink struct {
+	Token        string    `json:"token"`
+	NewsletterID string    `json:"newsletterId"`
+	Page         int       `json:"page"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// ShareRegistry holds share links and persists them to disk
+type ShareRegistry struct {
+	mu    sync.Mutex
+	path  string
+	links map[string]*ShareLink
+}
+
+var shareLinks *ShareRegistry
+
+// LoadShareRegistry loads share links from path, starting empty if it doesn't exist
+func LoadShareRegistry(path string) (*ShareRegistry, error) {
+	reg := &ShareRegistry{path: path, links: make(map[string]*ShareLink)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return reg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var links []*ShareLink
+	if err := json.Unmarshal(data, &links); err != nil {
+		return nil, err
+	}
+	for _, l := range links {
+		reg.links[l.Token] = l
+	}
+	return reg, nil
+}
+
+// save writes all links to disk; the caller must hold mu
+func (r *ShareRegistry) save() error {
+	links := make([]*ShareLink, 0, len(r.links))
+	for _, l := range r.links {
+		links = append(links, l)
+	}
+	data, err := json.MarshalIndent(links, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, data, filePerm)
+}
+
+// Create returns the link for a newsletter page, reusing an existing one so
+// sharing the same page twice yields the same URL
+func (r *ShareRegistry) Create(newsletterID string, page int) (*ShareLink, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, l := range r.links {
+		if l.NewsletterID == newsletterID && l.Page == page {
+			return l, nil
+		}
+	}
+
+	token, err := randomHex(5)
+	if err != nil {
+		return nil, err
+	}
+	link := &ShareLink{Token: token, NewsletterID: newsletterID, Page: page, CreatedAt: time.Now()}
+	r.links[token] = link
+	if err := r.save(); err != nil {
+		delete(r.links, token)
+		return nil, err
+	}
+	return link, nil
+}
+
+// Rename points the links of renamed newsletters at their new IDs; renames
+// maps old IDs to new ones. It returns how many links changed.
+func (r *ShareRegistry) Rename(renames map[string]string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed := 0
+	for _, l := range r.links {
+		if to, ok := renames[l.NewsletterID]; ok {
+			l.NewsletterID = to
+			changed++
+		}
+	}
+	if changed == 0 {
+		return 0, nil
+	}
+	return changed, r.save()
+}
+
+// Get returns the link with the given token
+func (r *ShareRegistry) Get(token string) (*ShareLink, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l, ok := r.links[token]
+	return l, ok
+}
+
+// shareTarget returns the frontend URL a link opens
+func shareTarget(l *ShareLink) string {
+	return fmt.Sprintf("/newsletter.html?id=%s&page=%d", url.QueryEscape(l.NewsletterID), l.Page)
+}
+
+// API Handlers
+
+// createShareRequest is the body of POST /api/share
+type createShareRequest struct {
+	NewsletterID string `json:"newsletterId"`
+	Page         int    `json:"page"`
+}
+
+// Validate checks that the newsletter and page exist
+func (req *createShareRequest) Validate() *ValidationError {
+	if req.NewsletterID == "" {
+		return fieldError("newsletterId", "is required")
+	}
+	n, ok := newsletters.Get(req.NewsletterID)
+	if !ok {
+		return fieldError("newsletterId", "unknown newsletter %s", req.NewsletterID)
+	}
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	for _, p := range n.Pages {
+		if p.PageNumber == req.Page {
+			return nil
+		}
+	}
+	return fieldError("page", "newsletter has no page %d", req.Page)
+}
+
+// ShareResponse is the response to POST /api/share
+type ShareResponse struct {
+	URL     string    `json:"url"`
+	Details ShareLink `json:"details"`
+}
+
+func createShare(w http.ResponseWriter, r *http.Request) {
+	var req createShareRequest
+	if err := decodeJSONBody(w, r, &req); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	link, err := shareLinks.Create(req.NewsletterID, req.Page)
+	if err != nil {
+		http.Error(w, "Error creating share link", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ShareResponse{URL: baseURL(r) + "/s/" + link.Token, Details: *link})
+}
+
+// openShare redirects a short link to the newsletter page it points at
+func openShare(w http.ResponseWriter, r *http.Request) {
+	if !ready.Load() {
+		http.Error(w, "Server is warming up", http.StatusServiceUnavailable)
+		return
+	}
+	link, ok := shareLinks.Get(mux.Vars(r)["token"])
+	if !ok {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+	http.Redirect(w, r, shareTarget(link), http.StatusFound)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestShareRename renames a shared newsletter, as migrate-ids does, and
+// reloads the links from disk
+func TestShareRename(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shares.json")
+	reg, err := LoadShareRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved, err := reg.Create("lidl-09-02-15-02-2026", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := reg.Create("kaufland-09-02-15-02-2026", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := reg.Rename(map[string]string{"lidl-09-02-15-02-2026": "lidl-2026-w07"})
+	if err != nil || changed != 1 {
+		t.Fatalf("Rename = %d, %v; want 1 link changed", changed, err)
+	}
+
+	reloaded, err := LoadShareRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l, ok := reloaded.Get(moved.Token); !ok || l.NewsletterID != "lidl-2026-w07" || l.Page != 7 {
+		t.Errorf("renamed link = %+v, want lidl-2026-w07 page 7", l)
+	}
+	if l, ok := reloaded.Get(kept.Token); !ok || l.NewsletterID != "kaufland-09-02-15-02-2026" {
+		t.Errorf("other link = %+v, want it unchanged", l)
+	}
+}
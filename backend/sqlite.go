@@ -0,0 +1,252 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+var databaseFile = dataPath("bestdeal.db")
+
+// sqliteMigrations are applied in order on startup; append, never edit
+var sqliteMigrations = []string{
+	`CREATE TABLE stores (
+		name TEXT PRIMARY KEY
+	);
+	CREATE TABLE newsletters (
+		id                TEXT PRIMARY KEY,
+		config_id         TEXT NOT NULL DEFAULT '',
+		store             TEXT NOT NULL REFERENCES stores(name),
+		title             TEXT NOT NULL DEFAULT '',
+		original_title    TEXT NOT NULL DEFAULT '',
+		title_en          TEXT NOT NULL DEFAULT '',
+		valid_from        TEXT NOT NULL DEFAULT '',
+		valid_until       TEXT NOT NULL DEFAULT '',
+		cover_image       TEXT NOT NULL DEFAULT '',
+		viewer_url        TEXT NOT NULL DEFAULT '',
+		category          TEXT NOT NULL DEFAULT '',
+		theme             TEXT NOT NULL DEFAULT '',
+		last_updated      TEXT NOT NULL,
+		extractor_version INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX newsletters_store ON newsletters(store);
+	CREATE TABLE pages (
+		newsletter_id TEXT NOT NULL REFERENCES newsletters(id) ON DELETE CASCADE,
+		position      INTEGER NOT NULL,
+		page_number   INTEGER NOT NULL,
+		image_url     TEXT NOT NULL,
+		PRIMARY KEY (newsletter_id, position)
+	);`,
+	`ALTER TABLE newsletters ADD COLUMN page_count INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE newsletters ADD COLUMN cover_thumbnail TEXT NOT NULL DEFAULT '';
+	ALTER TABLE pages ADD COLUMN thumbnail_url TEXT NOT NULL DEFAULT '';
+	ALTER TABLE pages ADD COLUMN medium_url TEXT NOT NULL DEFAULT '';`,
+}
+
+// sqliteRepository stores newsletters in a SQLite database
+type sqliteRepository struct {
+	db *sql.DB
+}
+
+// openSQLiteRepository opens the database, applies pending migrations and,
+// on first use, imports an existing newsletters.json
+func openSQLiteRepository(path string) (*sqliteRepository, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer; a single connection also serializes transactions
+	db.SetMaxOpenConns(1)
+
+	r := &sqliteRepository{db: db}
+	if err := r.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %v", err)
+	}
+	if err := r.importLegacyJSON(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to import %s: %v", newslettersFile, err)
+	}
+	return r, nil
+}
+
+// migrate applies the migrations newer than the database's version
+func (r *sqliteRepository) migrate() error {
+	var version int
+	if err := r.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(sqliteMigrations); i++ {
+		tx, err := r.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %v", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		slog.Info("applied database migration", "version", i+1)
+	}
+	return nil
+}
+
+// importLegacyJSON loads newsletters.json into an empty database and renames
+// it, so data saved before the switch to SQLite is kept
+func (r *sqliteRepository) importLegacyJSON() error {
+	var count int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM newsletters`).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	list, err := jsonRepository{path: newslettersFile}.Load()
+	if err != nil || list == nil {
+		return err
+	}
+	if err := r.SaveAll(list); err != nil {
+		return err
+	}
+	slog.Info("imported newsletters", "count", len(list), "from", newslettersFile)
+	return os.Rename(newslettersFile, newslettersFile+".imported")
+}
+
+// Load implements Repository
+func (r *sqliteRepository) Load() ([]Newsletter, error) {
+	rows, err := r.db.Query(`SELECT id, config_id, store, title, original_title, title_en,
+		valid_from, valid_until, cover_image, cover_thumbnail, viewer_url, category, theme, last_updated, extractor_version, page_count
+		FROM newsletters ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Newsletter
+	index := map[string]int{}
+	for rows.Next() {
+		var n Newsletter
+		var updated string
+		if err := rows.Scan(&n.ID, &n.ConfigID, &n.Store, &n.Title, &n.OriginalTitle, &n.TitleEN,
+			&n.ValidFrom, &n.ValidUntil, &n.CoverImage, &n.CoverThumbnail, &n.ViewerURL, &n.Category, &n.Theme, &updated, &n.ExtractorVersion, &n.PageCount); err != nil {
+			return nil, err
+		}
+		n.LastUpdated, _ = time.Parse(time.RFC3339Nano, updated)
+		n.Pages = []Page{}
+		index[n.ID] = len(list)
+		list = append(list, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	pages, err := r.db.Query(`SELECT newsletter_id, page_number, image_url, thumbnail_url, medium_url FROM pages ORDER BY newsletter_id, position`)
+	if err != nil {
+		return nil, err
+	}
+	defer pages.Close()
+	for pages.Next() {
+		var id string
+		var p Page
+		if err := pages.Scan(&id, &p.PageNumber, &p.ImageURL, &p.ThumbnailURL, &p.MediumURL); err != nil {
+			return nil, err
+		}
+		if i, ok := index[id]; ok {
+			list[i].Pages = append(list[i].Pages, p)
+		}
+	}
+	return list, pages.Err()
+}
+
+// upsert writes one newsletter and its pages within tx
+func upsertNewsletter(tx *sql.Tx, n Newsletter) error {
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO stores (name) VALUES (?)`, n.Store); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO newsletters (id, config_id, store, title, original_title, title_en,
+		valid_from, valid_until, cover_image, cover_thumbnail, viewer_url, category, theme, last_updated, extractor_version, page_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET config_id = excluded.config_id, store = excluded.store,
+			title = excluded.title, original_title = excluded.original_title, title_en = excluded.title_en,
+			valid_from = excluded.valid_from, valid_until = excluded.valid_until,
+			cover_image = excluded.cover_image, cover_thumbnail = excluded.cover_thumbnail, viewer_url = excluded.viewer_url,
+			category = excluded.category, theme = excluded.theme,
+			last_updated = excluded.last_updated, extractor_version = excluded.extractor_version,
+			page_count = excluded.page_count`,
+		n.ID, n.ConfigID, n.Store, n.Title, n.OriginalTitle, n.TitleEN,
+		n.ValidFrom, n.ValidUntil, n.CoverImage, n.CoverThumbnail, n.ViewerURL, n.Category, n.Theme,
+		n.LastUpdated.Format(time.RFC3339Nano), n.ExtractorVersion, n.PageCount); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM pages WHERE newsletter_id = ?`, n.ID); err != nil {
+		return err
+	}
+	for i, p := range n.Pages {
+		if _, err := tx.Exec(`INSERT INTO pages (newsletter_id, position, page_number, image_url, thumbnail_url, medium_url) VALUES (?, ?, ?, ?, ?, ?)`,
+			n.ID, i, p.PageNumber, p.ImageURL, p.ThumbnailURL, p.MediumURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inTx runs fn in a transaction
+func (r *sqliteRepository) inTx(fn func(*sql.Tx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Upsert implements Repository
+func (r *sqliteRepository) Upsert(n Newsletter) error {
+	return r.inTx(func(tx *sql.Tx) error {
+		return upsertNewsletter(tx, n)
+	})
+}
+
+// ReplaceStore implements Repository
+func (r *sqliteRepository) ReplaceStore(store string, list []Newsletter) error {
+	return r.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM newsletters WHERE store = ?`, store); err != nil {
+			return err
+		}
+		for _, n := range list {
+			if err := upsertNewsletter(tx, n); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SaveAll implements Repository
+func (r *sqliteRepository) SaveAll(list []Newsletter) error {
+	return r.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM newsletters`); err != nil {
+			return err
+		}
+		for _, n := range list {
+			if err := upsertNewsletter(tx, n); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
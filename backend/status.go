@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// staleAfter is how long after its last successful scrape a store's data
+// counts as stale; stores publish weekly
+const staleAfter = 8 * 24 * time.Hour
+
+// Overall instance health reported by /status
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusStarting = "starting"
+)
+
+// StoreStatus is the freshness of one store's data
+type StoreStatus struct {
+	Store       string     `json:"store"`
+	LastScraped *time.Time `json:"lastScraped"`
+	Stale       bool       `json:"stale"`
+	OptedOut    bool       `json:"optedOut,omitempty"`
+	CanaryOK    *bool      `json:"canaryOk,omitempty"`
+}
+
+// InstanceStatus is the public status of the instance
+type InstanceStatus struct {
+	Status      string        `json:"status"`
+	CheckedAt   time.Time     `json:"checkedAt"`
+	JobsQueued  int           `json:"jobsQueued"`
+	JobsRunning int           `json:"jobsRunning"`
+	Stores      []StoreStatus `json:"stores"`
+}
+
+// instanceStatus collects per-store freshness for every configured store
+// and every store with archived newsletters. A newsletter is only recorded
+// after a successful scrape, so the newest LastUpdated of a store is its
+// last successful scrape.
+func instanceStatus(now time.Time) InstanceStatus {
+	stores := map[string]*StoreStatus{}
+	storeStatus := func(name string) *StoreStatus {
+		if stores[name] == nil {
+			stores[name] = &StoreStatus{Store: name}
+		}
+		return stores[name]
+	}
+
+	if configs, err := ListAvailableConfigs(); err == nil {
+		for _, name := range configs {
+			if config, err := LoadScraperConfig(configFile(name)); err == nil {
+				storeStatus(config.StoreName())
+			}
+		}
+	}
+	for _, n := range newsletters.List() {
+		s := storeStatus(n.Store)
+		if s.LastScraped == nil || n.LastUpdated.After(*s.LastScraped) {
+			updated := n.LastUpdated
+			s.LastScraped = &updated
+		}
+	}
+
+	canaryMu.Lock()
+	for store, result := range canaryResults {
+		ok := result.OK
+		storeStatus(store).CanaryOK = &ok
+	}
+	canaryMu.Unlock()
+
+	status := InstanceStatus{Status: StatusOK, CheckedAt: now, Stores: []StoreStatus{}}
+	status.JobsQueued, status.JobsRunning = scrapeJobs.Depth()
+	for _, s := range stores {
+		s.OptedOut = optOuts.IsOptedOut(s.Store)
+		if !s.OptedOut {
+			s.Stale = s.LastScraped == nil || now.Sub(*s.LastScraped) > staleAfter
+			if s.Stale || (s.CanaryOK != nil && !*s.CanaryOK) {
+				status.Status = StatusDegraded
+			}
+		}
+		status.Stores = append(status.Stores, *s)
+	}
+	sort.Slice(status.Stores, func(i, j int) bool { return status.Stores[i].Store < status.Stores[j].Store })
+
+	if !ready.Load() {
+		status.Status = StatusStarting
+	}
+	return status
+}
+
+var statusPage = template.Must(template.New("status").Funcs(template.FuncMap{
+	"ago":    func(t *time.Time, now time.Time) string { return now.Sub(*t).Round(time.Minute).String() },
+	"failed": func(ok *bool) bool { return ok != nil && !*ok },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>bestDeal status</title>
+<style>
+body { font-family: sans-serif; max-width: 720px; margin: 2em auto; }
+table { border-collapse: collapse; width: 100%; }
+td, th { padding: .4em; border-bottom: 1px solid #ddd; text-align: left; }
+.ok { color: #2a7d2a; } .degraded, .stale { color: #b33; } .starting { color: #a60; }
+</style>
+</head>
+<body>
+<h1>Status: <span class="{{.Status}}">{{.Status}}</span></h1>
+<p>Scrape jobs: {{.JobsRunning}} running, {{.JobsQueued}} queued</p>
+<table>
+<tr><th>Store</th><th>Last successful scrape</th><th>Data</th></tr>
+{{range .Stores}}<tr>
+<td>{{.Store}}</td>
+<td>{{if .LastScraped}}{{.LastScraped.Format "2006-01-02 15:04 MST"}} ({{ago .LastScraped $.CheckedAt}} ago){{else}}never{{end}}</td>
+<td>{{if .OptedOut}}opted out{{else if .Stale}}<span class="stale">stale</span>{{else}}<span class="ok">fresh</span>{{end}}{{if failed .CanaryOK}}, <span class="stale">site changed</span>{{end}}</td>
+</tr>
+{{end}}</table>
+<p><small>Checked {{.CheckedAt.Format "2006-01-02 15:04:05 MST"}}</small></p>
+</body>
+</html>
+`))
+
+func getStatus(w http.ResponseWriter, r *http.Request) {
+	status := instanceStatus(time.Now())
+
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set("Cache-Control", "no-cache")
+	if strings.Contains(r.Header.Get("Accept"), "text/html") || r.URL.Query().Get("format") == "html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		statusPage.Execute(w, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,92 @@
+package main
+
+import "sync"
+
+// NewsletterStore holds the newsletter list shared by the API handlers and
+// the scraper goroutines. Reads take a snapshot under a read lock; writes
+// build a new list, persist it and only then swap it in, so readers never
+// see a half-applied change and a failed save leaves memory untouched.
+type NewsletterStore struct {
+	mu   sync.RWMutex
+	list []Newsletter
+}
+
+// newsletters is the store behind every API handler, filled during warmup
+var newsletters = &NewsletterStore{}
+
+// load replaces the contents without saving, for data just read from disk
+func (s *NewsletterStore) load(list []Newsletter) {
+	s.mu.Lock()
+	s.list = list
+	s.mu.Unlock()
+}
+
+// List returns a snapshot of all newsletters. The returned slice is the
+// caller's; the newsletters in it must be treated as read-only.
+func (s *NewsletterStore) List() []Newsletter {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Newsletter{}, s.list...)
+}
+
+// Get returns the newsletter with the given ID
+func (s *NewsletterStore) Get(id string) (Newsletter, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, n := range s.list {
+		if n.ID == id {
+			return n, true
+		}
+	}
+	return Newsletter{}, false
+}
+
+// update applies change to a copy of the list, then persists it and swaps
+// it in
+func (s *NewsletterStore) update(change func([]Newsletter) []Newsletter, persist func(Repository) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updated := change(append([]Newsletter{}, s.list...))
+	resolveOverlaps(updated)
+	repo, err := repository()
+	if err != nil {
+		return err
+	}
+	if err := persist(repo); err != nil {
+		return err
+	}
+	s.list = updated
+	apiCache.invalidate()
+	return nil
+}
+
+// Upsert adds a newsletter or replaces the one with the same ID
+func (s *NewsletterStore) Upsert(n Newsletter) error {
+	return s.update(func(list []Newsletter) []Newsletter {
+		for i := range list {
+			if list[i].ID == n.ID {
+				list[i] = n
+				return list
+			}
+		}
+		return append(list, n)
+	}, func(repo Repository) error {
+		return repo.Upsert(n)
+	})
+}
+
+// Replace swaps all newsletters of a store for list
+func (s *NewsletterStore) Replace(store string, list []Newsletter) error {
+	return s.update(func(current []Newsletter) []Newsletter {
+		kept := current[:0]
+		for _, n := range current {
+			if n.Store != store {
+				kept = append(kept, n)
+			}
+		}
+		return append(kept, list...)
+	}, func(repo Repository) error {
+		return repo.ReplaceStore(store, list)
+	})
+}
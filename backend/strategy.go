@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Scraper strategies, selected by strategy in a scraper config
+const (
+	// StrategyPageByPage visits one viewer page per catalog page (the default)
+	StrategyPageByPage = "page-by-page"
+	// StrategyGallery reads every page image from a single page
+	StrategyGallery = "gallery"
+	// StrategyAPI reads the page images from a JSON API, without a browser
+	StrategyAPI = "api"
+	// StrategyPDF renders the pages of a catalog published as a PDF
+	StrategyPDF = "pdf"
+)
+
+// CatalogPage is a page of a catalog as found by a strategy
+type CatalogPage struct {
+	Number   int
+	URL      string // where the page was found, kept in provenance
+	ImageURL string // empty when Download has to look it up
+}
+
+// scrapeSession is what a strategy works with during one scrape
+type scrapeSession struct {
+	ctx         context.Context // browser context, started on first use
+	config      *ScraperConfig
+	imageScript string
+	// download fetches a URL into a file, from the recording when replaying
+	download func(url, filePath string) error
+	// tempDir holds files kept between calls, see tempFile
+	tempDir string
+}
+
+// tempFile returns a path for name in a directory that lives as long as
+// the session
+func (s *scrapeSession) tempFile(name string) (string, error) {
+	if s.tempDir == "" {
+		dir, err := os.MkdirTemp("", "scrape-*")
+		if err != nil {
+			return "", err
+		}
+		s.tempDir = dir
+	}
+	return filepath.Join(s.tempDir, name), nil
+}
+
+// close removes the session's temporary files
+func (s *scrapeSession) close() {
+	if s.tempDir != "" {
+		os.RemoveAll(s.tempDir)
+	}
+}
+
+// ScraperStrategy finds and downloads the pages of a catalog in one kind of
+// viewer. Supporting a new kind of viewer means adding a strategy to
+// scraperStrategies; the scraper itself stores, deduplicates and analyzes
+// the pages the same way for all of them.
+type ScraperStrategy interface {
+	// Check verifies that the config has what the strategy needs
+	Check(config *ScraperConfig) error
+	// Pages lists the catalog's pages in order
+	Pages(s *scrapeSession) ([]CatalogPage, error)
+	// Download saves the image of page to path and returns its URL
+	Download(s *scrapeSession, page CatalogPage, path string) (string, error)
+}
+
+var scraperStrategies = map[string]ScraperStrategy{
+	StrategyPageByPage: PageByPage{},
+	StrategyGallery:    SinglePageGallery{},
+	StrategyAPI:        APIBased{},
+	StrategyPDF:        PDFCatalog{},
+}
+
+// strategy returns the config's scraper strategy
+func (c *ScraperConfig) strategy() (ScraperStrategy, error) {
+	name := c.Strategy
+	if name == "" {
+		name = StrategyPageByPage
+	}
+	s, ok := scraperStrategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q", c.Strategy)
+	}
+	return s, nil
+}
+
+// downloadListed downloads a page whose image URL is known
+func downloadListed(s *scrapeSession, page CatalogPage, path string) (string, error) {
+	if page.ImageURL == "" {
+		return "", fmt.Errorf("no image URL")
+	}
+	return page.ImageURL, s.download(page.ImageURL, path)
+}
+
+// PageByPage scrapes viewers with one URL per page, such as
+// .../view/flyer/page/3, from first_page up to the page count the viewer
+// reports
+type PageByPage struct{}
+
+// Check implements ScraperStrategy
+func (PageByPage) Check(config *ScraperConfig) error {
+	first, err := extractPageNumber(config.FirstPage)
+	if err != nil {
+		return fmt.Errorf("first_page: %v", err)
+	}
+	if config.LastPage == "" {
+		return nil
+	}
+	last, err := extractPageNumber(config.LastPage)
+	if err != nil {
+		return fmt.Errorf("last_page: %v", err)
+	}
+	if last < first {
+		return fmt.Errorf("last_page %d is before first_page %d", last, first)
+	}
+	return nil
+}
+
+// Pages implements ScraperStrategy
+func (PageByPage) Pages(s *scrapeSession) ([]CatalogPage, error) {
+	first, err := extractPageNumber(s.config.FirstPage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse first page number: %v", err)
+	}
+	last, listed, err := pageRange(s.ctx, s.config, first)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := []CatalogPage{}
+	for n := first; n <= last; n++ {
+		page := CatalogPage{Number: n, URL: buildPageURL(s.config.FirstPage, n)}
+		if listed != nil {
+			page.ImageURL = listed[n-first]
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// Download implements ScraperStrategy
+func (PageByPage) Download(s *scrapeSession, page CatalogPage, path string) (string, error) {
+	if page.ImageURL == "" {
+		imageURL, err := extractImageFromPage(s.ctx, page.URL, s.imageScript)
+		if err != nil {
+			return "", fmt.Errorf("failed to extract image: %v", err)
+		}
+		page.ImageURL = imageURL
+	}
+	return downloadListed(s, page, path)
+}
+
+// galleryImagesJS lists the large images of a page in document order,
+// including lazy-loaded ones that have not loaded yet
+const galleryImagesJS = `
+	(() => {
+		const urls = [];
+		for (const img of document.querySelectorAll('img')) {
+			const url = img.dataset.src || img.dataset.lazySrc || img.currentSrc || img.src || '';
+			if (!url || url.startsWith('data:') || url.includes('.svg')) continue;
+			const width = img.naturalWidth || img.width || 0;
+			const height = img.naturalHeight || img.height || 0;
+			const pending = !img.complete || width === 0;
+			if ((pending || (width > 500 && height > 500)) && !urls.includes(url)) {
+				urls.push(url);
+			}
+		}
+		return urls;
+	})()
+`
+
+// SinglePageGallery scrapes viewers that show every page of the catalog
+// as an image on first_page. An image_urls script replaces the default of
+// taking every large image.
+type SinglePageGallery struct{}
+
+// Check implements ScraperStrategy
+func (SinglePageGallery) Check(config *ScraperConfig) error {
+	if config.FirstPage == "" {
+		return fmt.Errorf("first_page is required")
+	}
+	return nil
+}
+
+// Pages implements ScraperStrategy
+func (SinglePageGallery) Pages(s *scrapeSession) ([]CatalogPage, error) {
+	script := galleryImagesJS
+	if s.config.Scripts != nil && s.config.Scripts.ImageURLs != "" {
+		script = s.config.Scripts.ImageURLs
+	}
+	urls, err := evaluateImageURLs(s.ctx, s.config.FirstPage, script)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list page images: %v", err)
+	}
+
+	pages := make([]CatalogPage, len(urls))
+	for i, u := range urls {
+		pages[i] = CatalogPage{Number: i + 1, URL: s.config.FirstPage, ImageURL: u}
+	}
+	return pages, nil
+}
+
+// Download implements ScraperStrategy
+func (SinglePageGallery) Download(s *scrapeSession, page CatalogPage, path string) (string, error) {
+	return downloadListed(s, page, path)
+}
+
+// APIConfig locates the page images of a catalog in a JSON API response
+type APIConfig struct {
+	URL string `json:"url"`
+	// Images is the path of the image URLs in the response: keys separated
+	// by dots, with * for every element of an array, e.g.
+	// "data.flyer.pages.*.image.large"
+	Images string `json:"images"`
+}
+
+// APIBased scrapes catalogs whose viewer loads its pages from a JSON API,
+// reading the API directly
+type APIBased struct{}
+
+// Check implements ScraperStrategy
+func (APIBased) Check(config *ScraperConfig) error {
+	if config.API == nil || config.API.URL == "" || config.API.Images == "" {
+		return fmt.Errorf("api.url and api.images are required")
+	}
+	return nil
+}
+
+// Pages implements ScraperStrategy
+func (APIBased) Pages(s *scrapeSession) ([]CatalogPage, error) {
+	api := s.config.API
+	tmp, err := os.CreateTemp("", "api-*.json")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	// Fetched like an image, so recordings include the response
+	if err := s.download(api.URL, tmp.Name()); err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %v", api.URL, err)
+	}
+	data, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid API response: %v", err)
+	}
+
+	pages := []CatalogPage{}
+	for _, v := range jsonPath(doc, strings.Split(api.Images, ".")) {
+		if u, ok := v.(string); ok && strings.TrimSpace(u) != "" {
+			pages = append(pages, CatalogPage{Number: len(pages) + 1, URL: api.URL, ImageURL: absoluteURL(api.URL, strings.TrimSpace(u))})
+		}
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("no image URLs at %s in the API response", api.Images)
+	}
+	return pages, nil
+}
+
+// Download implements ScraperStrategy
+func (APIBased) Download(s *scrapeSession, page CatalogPage, path string) (string, error) {
+	return downloadListed(s, page, path)
+}
+
+// jsonPath returns the values at path in a decoded JSON document, where
+// "*" stands for every element of an array
+func jsonPath(v interface{}, path []string) []interface{} {
+	if len(path) == 0 {
+		return []interface{}{v}
+	}
+	var out []interface{}
+	switch node := v.(type) {
+	case map[string]interface{}:
+		if child, ok := node[path[0]]; ok {
+			out = jsonPath(child, path[1:])
+		}
+	case []interface{}:
+		if path[0] == "*" {
+			for _, child := range node {
+				out = append(out, jsonPath(child, path[1:])...)
+			}
+		}
+	}
+	return out
+}
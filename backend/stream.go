@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	ndjsonContentType = "application/x-ndjson"
+	// streamFlushEvery is how many items are written between flushes
+	streamFlushEvery = 50
+)
+
+// wantsNDJSON reports whether the client asked for newline-delimited JSON
+func wantsNDJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), ndjsonContentType)
+}
+
+// streamNewsletters encodes newsletters one at a time instead of marshalling
+// the whole list, flushing regularly so memory stays flat for big archives.
+// As NDJSON every newsletter is its own line, otherwise a JSON array is written.
+func streamNewsletters(w io.Writer, list []Newsletter, lang string, ndjson bool) error {
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+
+	if !ndjson {
+		if _, err := io.WriteString(w, "["); err != nil {
+			return err
+		}
+	}
+	for i, n := range list {
+		if !ndjson && i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(localizeNewsletter(n, lang)); err != nil {
+			return err
+		}
+		if flusher != nil && (i+1)%streamFlushEvery == 0 {
+			flusher.Flush()
+		}
+	}
+	if !ndjson {
+		if _, err := io.WriteString(w, "]"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeNewsletterList streams a listing in the paginated envelope, with all
+// newsletters on one page unless the client asked for pages. Superseded
+// newsletters are left out unless ?superseded=true.
+func writeNewsletterList(w http.ResponseWriter, r *http.Request, list []Newsletter) {
+	if r.URL.Query().Get("superseded") != "true" {
+		list = withoutSuperseded(list)
+	}
+	total := len(list)
+	all := list
+	lang := preferredLanguage(r.Header.Get("Accept-Language"))
+
+	page := NewsletterPage{Items: list, Limit: total, Total: total}
+	if wantsPagination(r) {
+		var err error
+		page, err = paginateNewsletters(list, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		list = page.Items
+	}
+	var next string
+	if page.NextCursor != nil {
+		next = *page.NextCursor
+	}
+
+	w.Header().Add("Vary", "Accept, Accept-Language")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	// Pages carry the total, so they depend on the whole listing
+	setValidators(w, all, lang+" "+r.Header.Get("Accept")+" "+r.URL.RawQuery)
+
+	if wantsNDJSON(r) {
+		// NDJSON has no envelope, so the cursor travels in a header
+		if next != "" {
+			w.Header().Set("X-Next-Cursor", next)
+		}
+		w.Header().Set("Content-Type", ndjsonContentType)
+		streamNewsletters(w, list, lang, true)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// Every key is always present; nextCursor is null on the last page
+	io.WriteString(w, `{"items":`)
+	streamNewsletters(w, list, lang, false)
+	cursorJSON := []byte("null")
+	if next != "" {
+		cursorJSON, _ = json.Marshal(next)
+	}
+	fmt.Fprintf(w, `,"nextCursor":%s,"limit":%d,"total":%d`, cursorJSON, page.Limit, page.Total)
+	if page.Page > 0 {
+		fmt.Fprintf(w, `,"page":%d,"pageSize":%d`, page.Page, page.PageSize)
+	}
+	io.WriteString(w, "}\n")
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+)
+
+// Page image sizes stored next to every page and cover; the full size is
+// the downloaded image itself
+const (
+	SizeThumbnail = "thumb"
+	SizeMedium    = "medium"
+)
+
+// imageVariants are the widths the sizes are scaled down to
+var imageVariants = []struct {
+	size  string
+	width int
+}{
+	{SizeThumbnail, 200},
+	{SizeMedium, 600},
+}
+
+// variantQuality is the JPEG quality of the resized images
+const variantQuality = 80
+
+// variantPath returns the path of a size variant of an image, such as
+// page-001.thumb.jpg for page-001.jpg
+func variantPath(imagePath, size string) string {
+	return strings.TrimSuffix(imagePath, ".jpg") + "." + size + ".jpg"
+}
+
+// isVariant reports whether path is a size variant rather than an original
+func isVariant(path string) bool {
+	for _, v := range imageVariants {
+		if strings.HasSuffix(path, "."+v.size+".jpg") {
+			return true
+		}
+	}
+	return false
+}
+
+// generateVariants writes every size variant of an image. Images narrower
+// than a variant are re-encoded at their own size, never scaled up.
+func generateVariants(imagePath string) error {
+	img, err := decodeImageFile(imagePath)
+	if err != nil {
+		return err
+	}
+	for _, v := range imageVariants {
+		if err := writeJPEG(variantPath(imagePath, v.size), resizeImage(img, v.width)); err != nil {
+			return fmt.Errorf("failed to write %s variant: %v", v.size, err)
+		}
+	}
+	return nil
+}
+
+// storeVariants gives a downloaded page its size variants: linked from the
+// earlier version of an unchanged page when it has them, generated otherwise
+func storeVariants(imagePath, prior string) error {
+	linked := true
+	for _, v := range imageVariants {
+		size := v.size
+		if !linkVariant(func(p string) string { return variantPath(p, size) }, prior, imagePath) {
+			linked = false
+		}
+	}
+	if linked {
+		return nil
+	}
+	return generateVariants(imagePath)
+}
+
+// variantURL returns the URL of a size variant of imageURL, or "" when the
+// variant file at path doesn't exist
+func variantURL(imageURL, imagePath, size string) string {
+	if _, err := os.Stat(variantPath(imagePath, size)); err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(imageURL, ".jpg") + "." + size + ".jpg"
+}
+
+// setVariantURLs fills in the variant URLs of a page stored at imagePath
+func setVariantURLs(page *Page, imagePath string) {
+	page.ThumbnailURL = variantURL(page.ImageURL, imagePath, SizeThumbnail)
+	page.MediumURL = variantURL(page.ImageURL, imagePath, SizeMedium)
+}
+
+// resizeImage scales img down to width, keeping the aspect ratio, by
+// box-averaging the source pixels
+func resizeImage(img image.Image, width int) *image.RGBA {
+	b := img.Bounds()
+	if width > b.Dx() {
+		width = b.Dx()
+	}
+	height := max(1, int(math.Round(float64(b.Dy())*float64(width)/float64(b.Dx()))))
+
+	out := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := b.Min.Y + y*b.Dy()/height
+		y1 := max(y0+1, b.Min.Y+(y+1)*b.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := b.Min.X + x*b.Dx()/width
+			x1 := max(x0+1, b.Min.X+(x+1)*b.Dx()/width)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			out.SetRGBA(x, y, color.RGBA{uint8(r / n >> 8), uint8(g / n >> 8), uint8(bl / n >> 8), uint8(a / n >> 8)})
+		}
+	}
+	return out
+}
+
+// writeJPEG encodes img to path
+func writeJPEG(path string, img image.Image) error {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: variantQuality}); err != nil {
+		return err
+	}
+	// Variants of unchanged pages are linked to their earlier version's
+	return replaceFile(path, buf.Bytes(), filePerm)
+}
+
+// runThumbnailsCommand generates the missing size variants of stored
+// newsletters, for catalogs scraped before variants existed
+func runThumbnailsCommand(args []string) error {
+	fs := flag.NewFlagSet("thumbnails", flag.ExitOnError)
+	store := fs.String("store", "", "only process this store")
+	dryRun := fs.Bool("dry-run", false, "only print the newsletters to process")
+	fs.Parse(args)
+
+	if err := warmup(); err != nil {
+		return err
+	}
+
+	updated := 0
+	for _, n := range newsletters.List() {
+		if *store != "" && n.Store != *store {
+			continue
+		}
+		changed, err := addVariants(&n, *dryRun)
+		if err != nil {
+			slog.Warn("failed to generate variants", "newsletter", n.ID, "err", err)
+		}
+		if !changed {
+			continue
+		}
+		updated++
+		if *dryRun {
+			slog.Info("would generate variants", "newsletter", n.ID)
+			continue
+		}
+		if err := newsletters.Upsert(n); err != nil {
+			return fmt.Errorf("failed to save %s: %v", n.ID, err)
+		}
+		slog.Info("generated variants", "newsletter", n.ID)
+	}
+	if *dryRun {
+		slog.Info("newsletters to update", "count", updated)
+	} else {
+		slog.Info("newsletters updated", "count", updated)
+	}
+	return nil
+}
+
+// addVariants generates the missing variants of a newsletter's cover and
+// pages and records their URLs, reporting whether any was missing
+func addVariants(n *Newsletter, dryRun bool) (bool, error) {
+	var firstErr error
+	ensure := func(imageURL string) (string, bool) {
+		path, ok := localImagePath(imageURL)
+		if !ok {
+			return "", false
+		}
+		if _, err := os.Stat(variantPath(path, SizeThumbnail)); err == nil {
+			return path, false
+		}
+		if !dryRun {
+			if err := generateVariants(path); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return path, true
+	}
+
+	changed := false
+	if path, missing := ensure(n.CoverImage); path != "" {
+		changed = changed || missing
+		n.CoverThumbnail = variantURL(n.CoverImage, path, SizeThumbnail)
+	}
+	for i := range n.Pages {
+		path, missing := ensure(n.Pages[i].ImageURL)
+		if path == "" {
+			continue
+		}
+		changed = changed || missing || n.Pages[i].ThumbnailURL == ""
+		setVariantURLs(&n.Pages[i], path)
+	}
+	return changed, firstErr
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// API token scopes
+const (
+	ScopeReadNewsletters = "read:newsletters"
+	ScopeReadOffers      = "read:offers"
+)
+
+var tokensFile = dataPath("api-tokens.json")
+
+const (
+	defaultTokenQuota = 1000
+	maxTokenQuota     = 10000
+)
+
+// tokenFlushInterval is how often token usage is saved; usage counted since
+// the last flush is lost if the process dies
+const tokenFlushInterval = 30 * time.Second
+
+var validScopes = map[string]bool{
+	ScopeReadNewsletters: true,
+	ScopeReadOffers:      true,
+}
+
+// scopedRoutes maps API path prefixes to the scope a token needs to call them
+var scopedRoutes = map[string]string{
+	"/api/newsletters": ScopeReadNewsletters,
+	"/api/offers":      ScopeReadOffers,
+	"/api/search":      ScopeReadOffers,
+}
+
+// APIToken is a self-service token for third-party API consumers
+type APIToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	DailyQuota int        `json:"dailyQuota"`
+	Hash       string     `json:"hash,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	Usage      TokenUsage `json:"usage"`
+}
+
+// TokenUsage tracks how much a token has been used
+type TokenUsage struct {
+	Day           string    `json:"day"`
+	RequestsToday int       `json:"requestsToday"`
+	TotalRequests int64     `json:"totalRequests"`
+	LastUsed      time.Time `json:"lastUsed,omitempty"`
+}
+
+// TokenRegistry holds issued API tokens and persists them to disk. Usage
+// is counted in memory and saved by Flush.
+type TokenRegistry struct {
+	mu     sync.Mutex
+	path   string
+	tokens map[string]*APIToken
+	dirty  bool // usage changed since the last save
+}
+
+var apiTokens *TokenRegistry
+
+var (
+	errInvalidToken  = errors.New("invalid API token")
+	errQuotaExceeded = errors.New("daily quota exceeded")
+)
+
+// LoadTokenRegistry loads issued tokens from path, starting empty if it doesn't exist
+func LoadTokenRegistry(path string) (*TokenRegistry, error) {
+	reg := &TokenRegistry{path: path, tokens: make(map[string]*APIToken)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return reg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []*APIToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, err
+	}
+	for _, t := range tokens {
+		reg.tokens[t.ID] = t
+	}
+	return reg, nil
+}
+
+// save writes all tokens to disk; the caller must hold mu
+func (r *TokenRegistry) save() error {
+	tokens := make([]*APIToken, 0, len(r.tokens))
+	for _, t := range r.tokens {
+		tokens = append(tokens, t)
+	}
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), dirPerm); err != nil {
+		return err
+	}
+	if err := replaceFile(r.path, data, 0600); err != nil {
+		return err
+	}
+	r.dirty = false
+	return nil
+}
+
+// Flush saves usage counted since the last save
+func (r *TokenRegistry) Flush() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.dirty {
+		return nil
+	}
+	return r.save()
+}
+
+// Start flushes usage every tokenFlushInterval until background work stops;
+// shutdown flushes what is left
+func (r *TokenRegistry) Start() {
+	go func() {
+		ticker := time.NewTicker(tokenFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.Flush(); err != nil {
+					slog.Warn("failed to save API token usage", "err", err)
+				}
+			case <-background.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Issue creates a new token and returns it along with its secret value,
+// which is only ever shown once
+func (r *TokenRegistry) Issue(name string, scopes []string, quota int) (*APIToken, string, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token := &APIToken{
+		ID:         id,
+		Name:       name,
+		Scopes:     scopes,
+		DailyQuota: quota,
+		Hash:       hashSecret(secret),
+		CreatedAt:  time.Now(),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens[id] = token
+	if err := r.save(); err != nil {
+		delete(r.tokens, id)
+		return nil, "", err
+	}
+	return token.public(), id + "." + secret, nil
+}
+
+// Revoke deletes a token
+func (r *TokenRegistry) Revoke(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tokens, id)
+	return r.save()
+}
+
+// lookup returns the token a raw value belongs to; the caller must hold mu
+func (r *TokenRegistry) lookup(raw string) (*APIToken, error) {
+	id, secret, ok := strings.Cut(raw, ".")
+	if !ok {
+		return nil, errInvalidToken
+	}
+	token, ok := r.tokens[id]
+	if !ok || subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hashSecret(secret))) != 1 {
+		return nil, errInvalidToken
+	}
+	return token, nil
+}
+
+// Verify checks a raw token value without counting a request and returns a
+// copy of the token
+func (r *TokenRegistry) Verify(raw string) (*APIToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, err := r.lookup(raw)
+	if err != nil {
+		return nil, err
+	}
+	return token.public(), nil
+}
+
+// Authenticate checks a raw token value, counts the request against its
+// quota and returns a copy of the token
+func (r *TokenRegistry) Authenticate(raw string) (*APIToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, err := r.lookup(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	today := now.Format("2006-01-02")
+	if token.Usage.Day != today {
+		token.Usage.Day = today
+		token.Usage.RequestsToday = 0
+	}
+	if token.Usage.RequestsToday >= token.DailyQuota {
+		return token.public(), errQuotaExceeded
+	}
+
+	token.Usage.RequestsToday++
+	token.Usage.TotalRequests++
+	token.Usage.LastUsed = now
+	r.dirty = true
+	return token.public(), nil
+}
+
+// public returns a copy of the token without its secret hash
+func (t *APIToken) public() *APIToken {
+	c := *t
+	c.Hash = ""
+	return &c
+}
+
+// HasScope reports whether the token was granted scope
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// bearerToken extracts the token from an Authorization: Bearer header
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+}
+
+// requiredScope returns the scope needed to call path, if any
+func requiredScope(path string) string {
+	for prefix, scope := range scopedRoutes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return scope
+		}
+	}
+	return ""
+}
+
+// tokenAuth validates API tokens sent as bearer tokens, enforcing scopes and
+// daily quotas. Requests without a token are passed through unchanged.
+func tokenAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := bearerToken(r)
+		// Token management and admin routes authenticate the token
+		// themselves
+		if raw == "" || strings.HasPrefix(r.URL.Path, "/api/tokens") || strings.HasPrefix(r.URL.Path, "/api/admin") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, err := apiTokens.Authenticate(raw)
+		switch {
+		case errors.Is(err, errQuotaExceeded):
+			tomorrow := time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+			w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(tomorrow).Seconds())+1))
+			http.Error(w, "Daily quota exceeded", http.StatusTooManyRequests)
+			return
+		case errors.Is(err, errInvalidToken):
+			http.Error(w, "Invalid API token", http.StatusUnauthorized)
+			return
+		case err != nil:
+			http.Error(w, "Error checking API token", http.StatusInternalServerError)
+			return
+		}
+
+		if scope := requiredScope(r.URL.Path); scope != "" && !token.HasScope(scope) {
+			http.Error(w, fmt.Sprintf("Token lacks scope %s", scope), http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("X-Quota-Remaining", strconv.Itoa(token.DailyQuota-token.Usage.RequestsToday))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// API Handlers
+
+// createTokenRequest is the body of POST /api/tokens
+type createTokenRequest struct {
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	DailyQuota int      `json:"dailyQuota"`
+}
+
+// Validate checks the request and applies quota defaults
+func (req *createTokenRequest) Validate() *ValidationError {
+	if strings.TrimSpace(req.Name) == "" {
+		return fieldError("name", "is required")
+	}
+	if len(req.Scopes) == 0 {
+		return fieldError("scopes", "at least one scope is required")
+	}
+	for _, s := range req.Scopes {
+		if !validScopes[s] {
+			return fieldError("scopes", "unknown scope %s", s)
+		}
+	}
+	if req.DailyQuota < 0 {
+		return fieldError("dailyQuota", "must not be negative")
+	}
+	if req.DailyQuota == 0 {
+		req.DailyQuota = defaultTokenQuota
+	}
+	if req.DailyQuota > maxTokenQuota {
+		req.DailyQuota = maxTokenQuota
+	}
+	return nil
+}
+
+func createToken(w http.ResponseWriter, r *http.Request) {
+	var req createTokenRequest
+	if err := decodeJSONBody(w, r, &req); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	token, secret, err := apiTokens.Issue(req.Name, req.Scopes, req.DailyQuota)
+	if err != nil {
+		http.Error(w, "Error issuing token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":   secret,
+		"details": token,
+	})
+}
+
+// ownToken verifies the bearer token and checks that it matches the {id}
+// route var. Managing a token doesn't count against its quota.
+func ownToken(w http.ResponseWriter, r *http.Request) (*APIToken, bool) {
+	token, err := apiTokens.Verify(bearerToken(r))
+	if err != nil {
+		http.Error(w, "Invalid API token", http.StatusUnauthorized)
+		return nil, false
+	}
+	if token.ID != mux.Vars(r)["id"] {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return nil, false
+	}
+	return token, true
+}
+
+// requireAdmin rejects requests whose bearer token isn't ADMIN_TOKEN, and
+// all of them while it is unset
+func requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if serverConfig.AdminToken == "" {
+			http.Error(w, "Admin API disabled, set ADMIN_TOKEN to enable it", http.StatusForbidden)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(bearerToken(r)), []byte(serverConfig.AdminToken)) != 1 {
+			http.Error(w, "Invalid admin token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func getTokenUsage(w http.ResponseWriter, r *http.Request) {
+	token, ok := ownToken(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(token)
+}
+
+func revokeToken(w http.ResponseWriter, r *http.Request) {
+	token, ok := ownToken(w, r)
+	if !ok {
+		return
+	}
+
+	if err := apiTokens.Revoke(token.ID); err != nil {
+		http.Error(w, "Error revoking token", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestTokenUsageFlush counts requests in memory and saves them on Flush
+func TestTokenUsageFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-tokens.json")
+	reg, err := LoadTokenRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, raw, err := reg.Issue("test", []string{ScopeReadNewsletters}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := reg.Authenticate(raw); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != string(saved) {
+		t.Errorf("Authenticate wrote the token file")
+	}
+
+	if err := reg.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := LoadTokenRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reloaded.Verify(raw)
+	if err != nil || got.ID != token.ID || got.Usage.RequestsToday != 1 {
+		t.Fatalf("reloaded token %+v, %v; want 1 request today", got, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("token file mode %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+}
+
+// TestOwnTokenDoesntCount checks a token through GET /api/tokens/{id},
+// which must neither use up its quota nor be refused once it is used up
+func TestOwnTokenDoesntCount(t *testing.T) {
+	w := request(t, "POST", "/api/tokens", `{"name": "own", "scopes": ["read:newsletters"], "dailyQuota": 1}`)
+	created := decodeJSON(t, w, 201).(map[string]interface{})
+	raw := created["token"].(string)
+	id, _, _ := strings.Cut(raw, ".")
+
+	for i := 0; i < 3; i++ {
+		decodeJSON(t, request(t, "GET", "/api/tokens/"+id, "", "Authorization", "Bearer "+raw), 200)
+	}
+	usage := decodeJSON(t, request(t, "GET", "/api/tokens/"+id, "", "Authorization", "Bearer "+raw), 200).(map[string]interface{})["usage"].(map[string]interface{})
+	if n := usage["requestsToday"].(float64); n != 0 {
+		t.Fatalf("requestsToday %v after checking the token, want 0", n)
+	}
+
+	if w := request(t, "GET", "/api/newsletters", "", "Authorization", "Bearer "+raw); w.Code != 200 {
+		t.Fatalf("first request: status %d", w.Code)
+	}
+	if w := request(t, "GET", "/api/newsletters", "", "Authorization", "Bearer "+raw); w.Code != 429 {
+		t.Fatalf("request over quota: status %d, want 429", w.Code)
+	}
+	if w := request(t, "DELETE", "/api/tokens/"+id, "", "Authorization", "Bearer "+raw); w.Code != 204 {
+		t.Fatalf("revoking a token over quota: status %d, want 204", w.Code)
+	}
+}
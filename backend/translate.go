@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Translator translates short texts such as newsletter titles
+type Translator interface {
+	Translate(text, from, to string) (string, error)
+}
+
+// NewTranslator returns the provider named by TRANSLATION_PROVIDER:
+// "libretranslate" (TRANSLATE_URL, optional TRANSLATE_API_KEY), "glossary"
+// (built-in word list, the default) or "none"
+func NewTranslator() Translator {
+	switch os.Getenv("TRANSLATION_PROVIDER") {
+	case "none":
+		return nil
+	case "libretranslate":
+		return &LibreTranslator{
+			URL:    strings.TrimSuffix(os.Getenv("TRANSLATE_URL"), "/"),
+			APIKey: os.Getenv("TRANSLATE_API_KEY"),
+			client: &http.Client{Timeout: 10 * time.Second},
+		}
+	default:
+		return GlossaryTranslator{}
+	}
+}
+
+// LibreTranslator uses a LibreTranslate-compatible HTTP API
+type LibreTranslator struct {
+	URL    string
+	APIKey string
+	client *http.Client
+}
+
+// Translate implements Translator
+func (t *LibreTranslator) Translate(text, from, to string) (string, error) {
+	body, _ := json.Marshal(map[string]string{
+		"q":       text,
+		"source":  from,
+		"target":  to,
+		"format":  "text",
+		"api_key": t.APIKey,
+	})
+	resp, err := t.client.Post(t.URL+"/translate", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+	}
+
+	var result struct {
+		TranslatedText string `json:"translatedText"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	return result.TranslatedText, nil
+}
+
+// GlossaryTranslator translates the handful of words catalog titles are
+// made of, without any external service
+type GlossaryTranslator struct{}
+
+var roToEnGlossary = []struct{ ro, en string }{
+	{"catalogul saptamanal", "weekly catalog"},
+	{"pentru perioada", "for the period"},
+	{"oferte saptamanale", "weekly offers"},
+	{"oferta saptamanii", "offer of the week"},
+	{"saptamanal", "weekly"},
+	{"catalogul", "catalog"},
+	{"catalog", "catalog"},
+	{"oferte", "offers"},
+	{"oferta", "offer"},
+	{"craciun", "Christmas"},
+	{"pastele", "Easter"},
+	{"de paste", "Easter"},
+	{"inapoi la scoala", "back to school"},
+	{"bricolaj", "DIY"},
+	{"gradina", "garden"},
+	{"valabil", "valid"},
+}
+
+// Translate implements Translator
+func (GlossaryTranslator) Translate(text, from, to string) (string, error) {
+	if from != "ro" || to != "en" {
+		return "", fmt.Errorf("glossary only translates ro to en")
+	}
+	out := normalizeTitle(text)
+	for _, entry := range roToEnGlossary {
+		out = strings.ReplaceAll(out, entry.ro, entry.en)
+	}
+	if out == normalizeTitle(text) {
+		return "", fmt.Errorf("no glossary terms in %q", text)
+	}
+	return strings.ToUpper(out[:1]) + out[1:], nil
+}
+
+// supportedLanguages are the title languages clients can ask for
+var supportedLanguages = []string{"ro", "en"}
+
+// preferredLanguage picks the first supported language from an
+// Accept-Language header, honouring q-values
+func preferredLanguage(header string) string {
+	type choice struct {
+		lang string
+		q    float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		lang, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		choices = append(choices, choice{lang, q})
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+
+	for _, c := range choices {
+		for _, supported := range supportedLanguages {
+			if c.lang == supported {
+				return supported
+			}
+		}
+	}
+	return ""
+}
+
+// localizeNewsletter returns the newsletter with its title in the language
+// the client asked for, when a translation is available, and its validity
+// phrased in that language
+func localizeNewsletter(n Newsletter, lang string) Newsletter {
+	if lang == "en" && n.TitleEN != "" {
+		n.Title = n.TitleEN
+	}
+	n.Validity = newsletterValidity(n, lang, time.Now())
+	return n
+}
+
+// localizeNewsletters applies localizeNewsletter to a list
+func localizeNewsletters(list []Newsletter, r *http.Request) []Newsletter {
+	lang := preferredLanguage(r.Header.Get("Accept-Language"))
+	localized := make([]Newsletter, len(list))
+	for i, n := range list {
+		localized[i] = localizeNewsletter(n, lang)
+	}
+	return localized
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxJSONBodySize caps request bodies of JSON endpoints
+const maxJSONBodySize = 1 << 20
+
+// ValidationError reports a problem with one field of a request body
+type ValidationError struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"error"`
+	status  int
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// fieldError returns a validation error for a single field
+func fieldError(field, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{Field: field, Message: fmt.Sprintf(format, args...), status: http.StatusBadRequest}
+}
+
+// decodeJSONBody strictly decodes a size-limited JSON request body into dst:
+// unknown fields, trailing data and wrong types are all rejected
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) *ValidationError {
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBodySize)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err == nil {
+		if dec.Decode(&struct{}{}) != io.EOF {
+			return &ValidationError{Message: "body must contain a single JSON object", status: http.StatusBadRequest}
+		}
+		return nil
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var sizeErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &sizeErr):
+		return &ValidationError{Message: fmt.Sprintf("body larger than %d bytes", sizeErr.Limit), status: http.StatusRequestEntityTooLarge}
+	case errors.As(err, &syntaxErr):
+		return &ValidationError{Message: fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset), status: http.StatusBadRequest}
+	case errors.As(err, &typeErr):
+		return fieldError(typeErr.Field, "must be of type %s", typeErr.Type)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &ValidationError{Message: "malformed JSON", status: http.StatusBadRequest}
+	case errors.Is(err, io.EOF):
+		return &ValidationError{Message: "body must not be empty", status: http.StatusBadRequest}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return fieldError(field, "unknown field")
+	default:
+		return &ValidationError{Message: err.Error(), status: http.StatusBadRequest}
+	}
+}
+
+// writeValidationError sends a validation error as JSON
+func writeValidationError(w http.ResponseWriter, err *ValidationError) {
+	status := err.status
+	if status == 0 {
+		status = http.StatusBadRequest
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(err)
+}
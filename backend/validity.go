@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+	_ "time/tzdata" // store timezones must resolve on hosts without zoneinfo
+)
+
+// defaultTimezone is the timezone of stores whose configs set none
+const defaultTimezone = "Europe/Bucharest"
+
+// expiresSoonDays is how many days before its end a newsletter expires soon
+const expiresSoonDays = 1
+
+// Validity statuses
+const (
+	ValidityUpcoming = "upcoming"
+	ValidityActive   = "active"
+	ValidityExpired  = "expired"
+)
+
+// Validity describes how long a newsletter is valid, counted in days of
+// its store's timezone, so clients don't have to do the date math
+type Validity struct {
+	Status string `json:"status"`
+	// Days is the number of days until the newsletter starts when it is
+	// upcoming, after today it stays valid when it is active and since it
+	// ended when it is expired
+	Days        int    `json:"days"`
+	ExpiresSoon bool   `json:"expiresSoon"`
+	Text        string `json:"text"` // e.g. "valid 3 more days", in the response language
+}
+
+// validityTexts phrase a validity per language
+var validityTexts = map[string]func(status string, days int) string{
+	"en": func(status string, days int) string {
+		switch {
+		case status == ValidityUpcoming && days == 1:
+			return "starts tomorrow"
+		case status == ValidityUpcoming:
+			return fmt.Sprintf("starts in %d days", days)
+		case status == ValidityActive && days == 0:
+			return "last day today"
+		case status == ValidityActive && days == 1:
+			return "valid until tomorrow"
+		case status == ValidityActive:
+			return fmt.Sprintf("valid %d more days", days)
+		case days == 1:
+			return "expired yesterday"
+		default:
+			return fmt.Sprintf("expired %d days ago", days)
+		}
+	},
+	"ro": func(status string, days int) string {
+		switch {
+		case status == ValidityUpcoming && days == 1:
+			return "începe mâine"
+		case status == ValidityUpcoming:
+			return "începe în " + roDays(days)
+		case status == ValidityActive && days == 0:
+			return "ultima zi azi"
+		case status == ValidityActive && days == 1:
+			return "valabil până mâine"
+		case status == ValidityActive:
+			return "valabil încă " + roDays(days)
+		case days == 1:
+			return "a expirat ieri"
+		default:
+			return "a expirat acum " + roDays(days)
+		}
+	},
+}
+
+// roDays counts days in Romanian, where 20 and up take "de"
+func roDays(n int) string {
+	if rest := n % 100; rest == 0 || rest >= 20 {
+		return fmt.Sprintf("%d de zile", n)
+	}
+	return fmt.Sprintf("%d zile", n)
+}
+
+// storeZones caches the timezones of the stores, read from their configs
+var storeZones struct {
+	sync.Mutex
+	zones  map[string]*time.Location
+	loaded time.Time
+}
+
+// storeZonesTTL is how long config changes take to affect validities
+const storeZonesTTL = time.Minute
+
+// storeLocation returns the timezone of a store
+func storeLocation(store string) *time.Location {
+	storeZones.Lock()
+	defer storeZones.Unlock()
+	if time.Since(storeZones.loaded) > storeZonesTTL {
+		storeZones.zones = map[string]*time.Location{}
+		stores, _ := ListAvailableStores()
+		for _, s := range stores {
+			if s.Timezone == "" {
+				continue
+			}
+			loc, err := time.LoadLocation(s.Timezone)
+			if err != nil {
+				slog.Warn("invalid store timezone, using the default", "store", s.Name, "timezone", s.Timezone, "default", defaultTimezone)
+				continue
+			}
+			storeZones.zones[s.Name] = loc
+		}
+		storeZones.loaded = time.Now()
+	}
+	if loc, ok := storeZones.zones[store]; ok {
+		return loc
+	}
+	loc, _ := time.LoadLocation(defaultTimezone)
+	return loc
+}
+
+// newsletterValidity describes the validity of n on the day now falls on
+// in its store's timezone, phrased in lang; nil when its dates are invalid
+func newsletterValidity(n Newsletter, lang string, now time.Time) *Validity {
+	if invalidDates(n) {
+		return nil
+	}
+	from, _ := time.Parse("2006-01-02", n.ValidFrom)
+	until, _ := time.Parse("2006-01-02", n.ValidUntil)
+	y, m, d := now.In(storeLocation(n.Store)).Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	days := func(a, b time.Time) int { return int(b.Sub(a).Hours() / 24) }
+
+	v := &Validity{Status: ValidityActive, Days: days(today, until)}
+	switch {
+	case today.Before(from):
+		v.Status, v.Days = ValidityUpcoming, days(today, from)
+	case today.After(until):
+		v.Status, v.Days = ValidityExpired, days(until, today)
+	default:
+		v.ExpiresSoon = v.Days <= expiresSoonDays
+	}
+
+	phrase, ok := validityTexts[lang]
+	if !ok {
+		phrase = validityTexts[defaultLocale]
+	}
+	v.Text = phrase(v.Status, v.Days)
+	return v
+}
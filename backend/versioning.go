@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// ExtractorVersion identifies the extraction pipeline (image selection JS,
+// page count detection, cover detection, tile segmentation). Bump it
+// whenever a change would produce different results for the same catalog.
+//
+// Version 2 takes Schwarz viewer pages in full resolution and bounds
+// scrapes by the page count the viewer reports.
+const ExtractorVersion = 2
+
+// OutdatedNewsletter is a newsletter produced by an older pipeline version
+type OutdatedNewsletter struct {
+	ID               string `json:"id"`
+	Store            string `json:"store"`
+	ExtractorVersion int    `json:"extractorVersion"`
+	ConfigPath       string `json:"configPath,omitempty"`
+	HasRecording     bool   `json:"hasRecording"`
+}
+
+// findConfigPath returns the config file with the given config ID
+func findConfigPath(id string) (string, bool) {
+	configs, err := ListAvailableConfigs()
+	if err != nil {
+		return "", false
+	}
+	for _, name := range configs {
+		path := configFile(name)
+		config, err := LoadScraperConfig(path)
+		if err == nil && config.ID == id {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// outdatedNewsletters lists newsletters extracted by an older pipeline version
+func outdatedNewsletters() []OutdatedNewsletter {
+	result := []OutdatedNewsletter{}
+	for _, n := range newsletters.List() {
+		if n.ExtractorVersion >= ExtractorVersion || optOuts.IsOptedOut(n.Store) {
+			continue
+		}
+		o := OutdatedNewsletter{ID: n.ID, Store: n.Store, ExtractorVersion: n.ExtractorVersion}
+		o.ConfigPath, _ = findConfigPath(n.ConfigID)
+		if _, err := os.Stat(filepath.Join(recordingsDir, n.ConfigID, "index.json")); err == nil {
+			o.HasRecording = true
+		}
+		result = append(result, o)
+	}
+	return result
+}
+
+// API Handlers
+
+func getOutdatedNewsletters(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"currentVersion": ExtractorVersion,
+		"outdated":       outdatedNewsletters(),
+	})
+}
+
+// rescrapeOutdated re-runs the current pipeline for every outdated newsletter,
+// replaying its recorded session when there is one so the live site isn't hit
+func rescrapeOutdated(w http.ResponseWriter, r *http.Request) {
+	outdated := outdatedNewsletters()
+	logger := logFrom(r.Context())
+	ctx := withLogger(background, logger)
+
+	go func() {
+		for _, o := range outdated {
+			if background.Err() != nil {
+				return
+			}
+			if o.ConfigPath == "" {
+				logger.Warn("skipping outdated newsletter, no config found", "newsletter", o.ID)
+				continue
+			}
+			opts := ScrapeOptions{Replay: o.HasRecording}
+			if err := ScrapeAndDownloadFromConfig(ctx, o.ConfigPath, opts); err != nil {
+				logger.Error("failed to re-scrape outdated newsletter", "newsletter", o.ID, "err", err)
+			}
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Re-scraping outdated newsletters in background.",
+		"count":   len(outdated),
+		"status":  "processing",
+	})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultWidgetLimit = 3
+	maxWidgetLimit     = 10
+)
+
+// WidgetLeaflet is the compact newsletter summary served to embeds
+type WidgetLeaflet struct {
+	ID         string    `json:"id"`
+	Store      string    `json:"store"`
+	Title      string    `json:"title"`
+	ValidFrom  string    `json:"validFrom"`
+	ValidUntil string    `json:"validUntil"`
+	CoverImage string    `json:"coverImage"`
+	URL        string    `json:"url"`
+	Validity   *Validity `json:"validity,omitempty"`
+}
+
+// hostRe matches a host name or IP address with an optional port
+var hostRe = regexp.MustCompile(`^(?:[a-z0-9.-]+|\[[0-9a-f:.]+\])(?::\d{1,5})?$`)
+
+// baseURL returns the scheme and host the request was made to, so embeds
+// on other sites get absolute links. The X-Forwarded-Proto and
+// X-Forwarded-Host headers of a proxy are only honoured with TRUST_PROXY,
+// since clients can set them too.
+func baseURL(r *http.Request) string {
+	scheme, host := "http", strings.ToLower(r.Host)
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if rateLimits.trustProxy {
+		// A chain of proxies lists the first one's value first
+		proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+		if proto = strings.ToLower(strings.TrimSpace(proto)); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		forwarded, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Host"), ",")
+		if forwarded = strings.ToLower(strings.TrimSpace(forwarded)); hostRe.MatchString(forwarded) {
+			host = forwarded
+		}
+	}
+	if !hostRe.MatchString(host) {
+		host = "localhost"
+	}
+	return fmt.Sprintf("%s://%s", scheme, host)
+}
+
+func getWidgetLatest(w http.ResponseWriter, r *http.Request) {
+	store := r.URL.Query().Get("store")
+
+	limit := defaultWidgetLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxWidgetLimit)
+	}
+
+	var matches []Newsletter
+	for _, n := range newsletters.List() {
+		if n.SupersededBy == "" && (store == "" || strings.EqualFold(n.Store, store)) {
+			matches = append(matches, n)
+		}
+	}
+
+	// Newest leaflets first
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].ValidFrom != matches[j].ValidFrom {
+			return matches[i].ValidFrom > matches[j].ValidFrom
+		}
+		return matches[i].LastUpdated.After(matches[j].LastUpdated)
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	matches = localizeNewsletters(matches, r)
+
+	base := baseURL(r)
+	leaflets := make([]WidgetLeaflet, 0, len(matches))
+	for _, n := range matches {
+		cover := n.CoverImage
+		if strings.HasPrefix(cover, "/") {
+			cover = base + cover
+		}
+		leaflets = append(leaflets, WidgetLeaflet{
+			ID:         n.ID,
+			Store:      n.Store,
+			Title:      n.Title,
+			ValidFrom:  n.ValidFrom,
+			ValidUntil: n.ValidUntil,
+			CoverImage: cover,
+			URL:        fmt.Sprintf("%s/newsletter.html?id=%s", base, n.ID),
+			Validity:   n.Validity,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Header().Add("Vary", "Accept-Language")
+	json.NewEncoder(w).Encode(leaflets)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBaseURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		host       string
+		header     []string
+		want       string
+	}{
+		{"plain", false, "deals.example", nil, "http://deals.example"},
+		{"port", false, "localhost:8080", nil, "http://localhost:8080"},
+		{"forwarded ignored", false, "deals.example", []string{"X-Forwarded-Proto", "https", "X-Forwarded-Host", "evil.example"}, "http://deals.example"},
+		{"trusted proxy", true, "backend:8080", []string{"X-Forwarded-Proto", "https", "X-Forwarded-Host", "deals.example"}, "https://deals.example"},
+		{"proxy chain", true, "backend:8080", []string{"X-Forwarded-Proto", "https, http", "X-Forwarded-Host", "deals.example, backend"}, "https://deals.example"},
+		{"bad scheme", true, "deals.example", []string{"X-Forwarded-Proto", "javascript"}, "http://deals.example"},
+		{"bad forwarded host", true, "deals.example", []string{"X-Forwarded-Host", "evil.example/x?"}, "http://deals.example"},
+		{"bad host", false, "evil.example/\"><script>", nil, "http://localhost"},
+		{"ipv6", false, "[::1]:8080", nil, "http://[::1]:8080"},
+	}
+	defer func(trust bool) { rateLimits.trustProxy = trust }(rateLimits.trustProxy)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rateLimits.trustProxy = tt.trustProxy
+			r := httptest.NewRequest("GET", "/api/widget/latest", nil)
+			r.Host = tt.host
+			for i := 0; i+1 < len(tt.header); i += 2 {
+				r.Header.Set(tt.header[i], tt.header[i+1])
+			}
+			if got := baseURL(r); got != tt.want {
+				t.Errorf("baseURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestWidgetCachePerHost requests the widget through two hosts, which must
+// not get each other's cached links
+func TestWidgetCachePerHost(t *testing.T) {
+	defer func(trust bool) { rateLimits.trustProxy = trust }(rateLimits.trustProxy)
+	rateLimits.trustProxy = true
+	withNewsletters(t, []Newsletter{{ID: "lidl-widget", Store: "Lidl", ValidFrom: "2026-02-09", CoverImage: "/newsletters/lidl-widget/page_1.jpg", LastUpdated: time.Now()}})
+
+	first := request(t, "GET", "/api/widget/latest", "", "X-Forwarded-Host", "evil.example")
+	decodeJSON(t, first, 200)
+	second := request(t, "GET", "/api/widget/latest", "")
+	decodeJSON(t, second, 200)
+	if !strings.Contains(first.Body.String(), "http://evil.example/") {
+		t.Fatalf("forwarded host not used: %s", first.Body)
+	}
+	if strings.Contains(second.Body.String(), "evil.example") {
+		t.Fatalf("response cached for another host: %s", second.Body)
+	}
+}
+
+// TestCachedVary requests a cached route twice from a browser; both the
+// response of the handler and the one from the cache must vary by origin
+func TestCachedVary(t *testing.T) {
+	withNewsletters(t, nil)
+	for i := 0; i < 2; i++ {
+		w := request(t, "GET", "/api/widget/latest", "", "Origin", "https://blog-a.example")
+		vary := strings.Join(w.Header().Values("Vary"), ", ")
+		if !strings.Contains(vary, "Origin") || !strings.Contains(vary, "Accept-Language") {
+			t.Errorf("request %d: Vary %q, want Origin and Accept-Language", i+1, vary)
+		}
+	}
+}
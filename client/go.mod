@@ -0,0 +1,3 @@
+module github.com/domolitom/bestDeal/client
+
+go 1.24